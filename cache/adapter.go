@@ -0,0 +1,117 @@
+package cache
+
+import (
+	"fmt"
+
+	"github.com/go-ee/utils/cache/typed"
+)
+
+// FromTyped adapts the typed cache to the untyped Cache, Put panics for values of other types than V.
+func FromTyped[V any](cache typed.Cache[string, V]) Cache {
+	return &untypedCache[V]{cache: cache}
+}
+
+// ToTyped adapts the untyped cache to the typed cache, values of other types than V are errors or misses.
+func ToTyped[V any](cache Cache) typed.Cache[string, V] {
+	return &typedCache[V]{cache: cache}
+}
+
+// FromTypedObject adapts the typed object cache to the untyped ObjectCache.
+func FromTypedObject[T any](cache typed.ObjectCache[T]) ObjectCache {
+	return &untypedObjectCache[T]{cache: cache}
+}
+
+// ToTypedObject adapts the untyped object cache to the typed object cache.
+func ToTypedObject[T any](cache ObjectCache) typed.ObjectCache[T] {
+	return &typedObjectCache[T]{cache: cache}
+}
+
+type untypedCache[V any] struct {
+	cache typed.Cache[string, V]
+}
+
+func (o *untypedCache[V]) Get(key string, _ func() interface{}) (value interface{}, ok bool) {
+	return o.cache.Get(key)
+}
+
+func (o *untypedCache[V]) GetOrBuild(key string, builder func() (interface{}, error)) (value interface{}, err error) {
+	return o.cache.GetOrBuild(key, func() (ret V, err error) {
+		var built interface{}
+		if built, err = builder(); err == nil {
+			ret, err = cast[V](built)
+		}
+		return
+	})
+}
+
+func (o *untypedCache[V]) Put(key string, value interface{}) {
+	typedValue, err := cast[V](value)
+	if err != nil {
+		panic(err)
+	}
+	o.cache.Put(key, typedValue)
+}
+
+func (o *untypedCache[V]) Clear() {
+	o.cache.Clear()
+}
+
+type typedCache[V any] struct {
+	cache Cache
+}
+
+func (o *typedCache[V]) Get(key string) (value V, ok bool) {
+	var item interface{}
+	if item, ok = o.cache.Get(key, nil); ok {
+		value, ok = item.(V)
+	}
+	return
+}
+
+func (o *typedCache[V]) GetOrBuild(key string, builder func() (V, error)) (value V, err error) {
+	var item interface{}
+	if item, err = o.cache.GetOrBuild(key, func() (interface{}, error) { return builder() }); err == nil {
+		value, err = cast[V](item)
+	}
+	return
+}
+
+func (o *typedCache[V]) Put(key string, value V) {
+	o.cache.Put(key, value)
+}
+
+func (o *typedCache[V]) Clear() {
+	o.cache.Clear()
+}
+
+type untypedObjectCache[T any] struct {
+	cache typed.ObjectCache[T]
+}
+
+func (o *untypedObjectCache[T]) Get() (ret interface{}, err error) {
+	return o.cache.Get()
+}
+
+type typedObjectCache[T any] struct {
+	cache ObjectCache
+}
+
+func (o *typedObjectCache[T]) Get() (ret T, err error) {
+	var item interface{}
+	if item, err = o.cache.Get(); err == nil {
+		ret, err = cast[T](item)
+	}
+	return
+}
+
+// cast returns the value as T, nil as the zero value of T.
+func cast[T any](value interface{}) (ret T, err error) {
+	if value == nil {
+		return
+	}
+	var ok bool
+	if ret, ok = value.(T); !ok {
+		err = fmt.Errorf("cache value of type %T is not %T", value, ret)
+	}
+	return
+}
@@ -0,0 +1,74 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-ee/utils/cache/typed"
+)
+
+func TestSimpleCache(t *testing.T) {
+	var cache Cache = NewCachePolicy(1, LRU, 0)
+	cache.Put("a", 1)
+	cache.Put("b", 2)
+	if _, ok := cache.Get("a", nil); ok {
+		t.Fatal("expected a evicted")
+	}
+	if value, err := cache.GetOrBuild("b", nil); err != nil || value != 2 {
+		t.Fatalf("expected b, got %v, %v", value, err)
+	}
+	cache.Clear()
+	if _, ok := cache.Get("b", nil); ok {
+		t.Fatal("expected b cleared")
+	}
+}
+
+func TestAdapters(t *testing.T) {
+	typedCache := typed.NewCache[string, int](10, LFU, 0)
+	untyped := FromTyped[int](typedCache)
+	untyped.Put("a", 1)
+	if value, ok := typedCache.Get("a"); !ok || value != 1 {
+		t.Fatalf("expected a, got %v", value)
+	}
+	if _, err := untyped.GetOrBuild("b", func() (interface{}, error) { return "b", nil }); err == nil {
+		t.Fatal("expected error for a value of another type")
+	}
+
+	roundTrip := ToTyped[int](NewCache())
+	if value, err := roundTrip.GetOrBuild("c", func() (int, error) { return 3, nil }); err != nil || value != 3 {
+		t.Fatalf("expected c, got %v, %v", value, err)
+	}
+	if value, ok := roundTrip.Get("c"); !ok || value != 3 {
+		t.Fatalf("expected c, got %v", value)
+	}
+
+	object := ToTypedObject[string](NewObjectCache(func() (interface{}, error) { return "object", nil }))
+	if value, err := object.Get(); err != nil || value != "object" {
+		t.Fatalf("expected object, got %v, %v", value, err)
+	}
+	if value, err := FromTypedObject[string](typed.NewObjectCache(func() (string, error) {
+		return "typed", nil
+	})).Get(); err != nil || value != "typed" {
+		t.Fatalf("expected typed, got %v, %v", value, err)
+	}
+}
+
+func TestZeroValueCaches(t *testing.T) {
+	var zero SimpleCache
+	zero.Put("a", 1)
+	if value, ok := zero.Get("a", nil); !ok || value != 1 {
+		t.Fatalf("expected a, got %v", value)
+	}
+
+	bounded := SimpleCache{MaxSize: 1}
+	bounded.Put("a", 1)
+	bounded.Put("b", 2)
+	if bounded.Len() != 1 {
+		t.Fatalf("expected 1 entry, got %v", bounded.Len())
+	}
+
+	object := &TimeoutObjectCache{Timeout: time.Minute, Builder: func() (interface{}, error) { return "object", nil }}
+	if value, err := object.Get(); err != nil || value != "object" {
+		t.Fatalf("expected object, got %v, %v", value, err)
+	}
+}
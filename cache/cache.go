@@ -1,5 +1,7 @@
 package cache
 
+import "github.com/go-ee/utils/cache/typed"
+
 type Cache interface {
 	Get(key string, builder func() interface{}) (value interface{}, ok bool)
 	GetOrBuild(key string, builder func() (interface{}, error)) (value interface{}, err error)
@@ -10,3 +12,26 @@ type Cache interface {
 type ObjectCache interface {
 	Get() (ret interface{}, err error)
 }
+
+type EvictionPolicy = typed.EvictionPolicy
+
+const (
+	LRU = typed.LRU
+	LFU = typed.LFU
+)
+
+type Stats = typed.Stats
+
+type Metrics = typed.Metrics
+
+type RemovalReason = typed.RemovalReason
+
+const (
+	Evicted     = typed.Evicted
+	Expired     = typed.Expired
+	Invalidated = typed.Invalidated
+	Cleared     = typed.Cleared
+)
+
+// RemovalListener is notified about the removed entries of a SimpleCache.
+type RemovalListener = typed.RemovalListener[string, interface{}]
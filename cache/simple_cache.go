@@ -1,85 +1,111 @@
 package cache
 
 import (
+	"context"
 	"sync"
 	"time"
+
+	"github.com/go-ee/utils/cache/typed"
 )
 
+// SimpleCache is the untyped typed.BoundedCache, see there for the eviction and the expiration.
+// The zero value is usable, the fields are taken over by the first use of the cache.
 type SimpleCache struct {
+	// Name of the cache in the debug logs.
+	Name    string
 	MaxSize int
-	data    map[string]interface{}
-	lock    sync.Mutex
+	Policy  EvictionPolicy
+	// TTL is the time to live of the entries, 0 for no expiration. PutTTL sets the TTL per entry.
+	TTL time.Duration
+	// ErrorTTL caches the errors of the builder for the time, 0 for not caching errors.
+	ErrorTTL time.Duration
+	// Metrics receives the measurements, nil for none.
+	Metrics Metrics
+
+	cache *typed.BoundedCache[string, interface{}]
+	once  sync.Once
 }
 
 func NewCache() *SimpleCache {
-	return &SimpleCache{MaxSize: 1000, data: make(map[string]interface{}), lock: sync.Mutex{}}
+	return &SimpleCache{MaxSize: 1000}
 }
 
-func (o SimpleCache) Clear() {
-	o.lock.Lock()
-	o.data = make(map[string]interface{})
-	o.lock.Unlock()
-	return
+// NewCachePolicy creates a cache with the policy and the TTL for the entries, 0 for no expiration.
+func NewCachePolicy(maxSize int, policy EvictionPolicy, ttl time.Duration) *SimpleCache {
+	return &SimpleCache{MaxSize: maxSize, Policy: policy, TTL: ttl}
 }
 
-func (o SimpleCache) Get(key string, builder func() interface{}) (value interface{}, ok bool) {
-	o.lock.Lock()
-	value, ok = o.data[key]
-	o.lock.Unlock()
-	return
+// Subscribe adds the listener, which is notified about the removed entries.
+func (o *SimpleCache) Subscribe(listener RemovalListener) {
+	o.bounded().Subscribe(listener)
 }
 
-func (o SimpleCache) GetOrBuild(key string, builder func() (interface{}, error)) (value interface{}, err error) {
-	o.lock.Lock()
-	value, ok := o.data[key]
-	if !ok {
-		value, err = builder()
-		if err == nil {
-			o.put(key, value)
-		}
-	}
-	o.lock.Unlock()
-	return
+func (o *SimpleCache) Clear() {
+	o.bounded().Clear()
 }
 
-func (o SimpleCache) Put(key string, value interface{}) {
-	o.lock.Lock()
-	o.put(key, value)
-	o.lock.Unlock()
+func (o *SimpleCache) Get(key string, _ func() interface{}) (value interface{}, ok bool) {
+	return o.bounded().Get(key)
 }
 
-func (o SimpleCache) put(key string, value interface{}) {
-	//reset cache
-	if len(o.data) >= o.MaxSize {
-		o.data = make(map[string]interface{})
-	}
-	o.data[key] = value
+func (o *SimpleCache) GetOrBuild(key string, builder func() (interface{}, error)) (value interface{}, err error) {
+	return o.bounded().GetOrBuild(key, builder)
 }
 
-type TimeoutObjectCache struct {
-	Timeout time.Duration
-	Builder func() (interface{}, error)
+// GetOrBuildContext returns the value of the key or builds it, see typed.BoundedCache.
+func (o *SimpleCache) GetOrBuildContext(
+	ctx context.Context, key string, builder func(ctx context.Context) (interface{}, error)) (value interface{}, err error) {
 
-	buildAt time.Time
-	obj     interface{}
+	return o.bounded().GetOrBuildContext(ctx, key, builder)
+}
+
+func (o *SimpleCache) Put(key string, value interface{}) {
+	o.bounded().Put(key, value)
+}
+
+// PutTTL puts the value with its time to live, 0 for no expiration.
+func (o *SimpleCache) PutTTL(key string, value interface{}, ttl time.Duration) {
+	o.bounded().PutTTL(key, value, ttl)
+}
+
+// Remove removes the entry of the key and returns true, if it existed.
+func (o *SimpleCache) Remove(key string) bool {
+	return o.bounded().Remove(key)
+}
 
-	lock sync.Mutex
+// Len returns the count of the entries, including expired ones, which are not removed yet.
+func (o *SimpleCache) Len() int {
+	return o.bounded().Len()
 }
 
-func (o *TimeoutObjectCache) Get() (ret interface{}, err error) {
-	o.lock.Lock()
-	if o.obj == nil || time.Since(o.buildAt) > o.Timeout {
-		o.obj, err = o.Builder()
-		o.buildAt = time.Now()
-		if err != nil {
-			o.obj = nil
-		}
-	}
-	ret = o.obj
-	o.lock.Unlock()
-	return
+// Stats returns the statistics since the creation of the cache.
+func (o *SimpleCache) Stats() Stats {
+	return o.bounded().Stats()
 }
 
+func (o *SimpleCache) bounded() *typed.BoundedCache[string, interface{}] {
+	o.once.Do(func() {
+		o.cache = &typed.BoundedCache[string, interface{}]{
+			Name: o.Name, MaxSize: o.MaxSize, Policy: o.Policy, TTL: o.TTL, ErrorTTL: o.ErrorTTL, Metrics: o.Metrics}
+	})
+	return o.cache
+}
+
+// TimeoutObjectCache is the untyped typed.TimeoutObjectCache, the zero value is usable with a Builder.
+type TimeoutObjectCache = typed.TimeoutObjectCache[interface{}]
+
 func NewObjectCache(builder func() (interface{}, error)) *TimeoutObjectCache {
-	return &TimeoutObjectCache{Timeout: 3 * time.Second, Builder: builder}
+	return typed.NewObjectCache[interface{}](builder)
+}
+
+// NewRefreshObjectCache creates an object cache, which builds the object in the background, see typed.NewRefreshObjectCache.
+func NewRefreshObjectCache(
+	builder func() (interface{}, error), timeout time.Duration, maxStaleness time.Duration) *TimeoutObjectCache {
+
+	return typed.NewRefreshObjectCache[interface{}](builder, timeout, maxStaleness)
+}
+
+// NewDiskCache creates the untyped typed.DiskCache of the values of V, see typed.NewDiskCache.
+func NewDiskCache[V any](folder string, codec typed.Codec[V], maxDiskSize int64) Cache {
+	return FromTyped[V](typed.NewDiskCache[V](folder, codec, maxDiskSize))
 }
@@ -0,0 +1,359 @@
+package typed
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-ee/utils/lg"
+)
+
+// BoundedCache is a bounded cache, the entries are evicted by the Policy when MaxSize is reached
+// and expire after their TTL. It is safe for concurrent use.
+// GetOrBuild builds the value of a key once for concurrent callers, without blocking other keys.
+// The removed entries are passed to the subscribed listeners and the measurements to the Metrics.
+type BoundedCache[K comparable, V any] struct {
+	// Name of the cache in the debug logs.
+	Name    string
+	MaxSize int
+	Policy  EvictionPolicy
+	// TTL is the time to live of the entries, 0 for no expiration. PutTTL sets the TTL per entry.
+	TTL time.Duration
+	// ErrorTTL caches the errors of the builder for the time, 0 for not caching errors.
+	ErrorTTL time.Duration
+	// Metrics receives the measurements, nil for none.
+	Metrics Metrics
+
+	entries map[K]*entry[K, V]
+	evictor evictor[K, V]
+	errors  map[K]*buildError
+	calls   map[K]*call[V]
+	// generation is increased by Clear, so that running builds don't put their values into the cleared cache
+	generation uint64
+	stats      Stats
+	listeners  []RemovalListener[K, V]
+	// removed are the entries removed under the lock, to notify the listeners after it
+	removed []removal[K, V]
+	now     func() time.Time
+	lock    sync.Mutex
+}
+
+// call is the running build of a key with the count of the waiting callers.
+type call[V any] struct {
+	done    chan struct{}
+	value   V
+	err     error
+	waiters int
+	cancel  context.CancelFunc
+	// canceled is set, when all callers stopped waiting, the error of the build is not cached then
+	canceled bool
+	// invalidated is set by Remove during the build, the value of the build is not cached then
+	invalidated bool
+}
+
+type buildError struct {
+	err       error
+	expiresAt time.Time
+}
+
+// NewCache creates a cache with the policy and the TTL for the entries, 0 for no expiration.
+func NewCache[K comparable, V any](maxSize int, policy EvictionPolicy, ttl time.Duration) *BoundedCache[K, V] {
+	return &BoundedCache[K, V]{MaxSize: maxSize, Policy: policy, TTL: ttl}
+}
+
+// Subscribe adds the listener, which is notified about the removed entries.
+func (o *BoundedCache[K, V]) Subscribe(listener RemovalListener[K, V]) {
+	o.lock.Lock()
+	o.listeners = append(o.listeners, listener)
+	o.lock.Unlock()
+}
+
+func (o *BoundedCache[K, V]) Clear() {
+	o.lock.Lock()
+	if len(o.listeners) > 0 {
+		for _, item := range o.entries {
+			o.removed = append(o.removed, removal[K, V]{key: item.key, value: item.value, reason: Cleared})
+		}
+	}
+	o.entries = nil
+	o.evictor = nil
+	o.errors = nil
+	o.generation++
+	o.metrics().Size(0)
+	o.unlockAndNotify()
+	return
+}
+
+func (o *BoundedCache[K, V]) Get(key K) (value V, ok bool) {
+	o.lock.Lock()
+	value, ok = o.get(key)
+	o.unlockAndNotify()
+	return
+}
+
+func (o *BoundedCache[K, V]) GetOrBuild(key K, builder func() (V, error)) (value V, err error) {
+	return o.GetOrBuildContext(context.Background(), key, func(context.Context) (V, error) {
+		return builder()
+	})
+}
+
+// GetOrBuildContext returns the value of the key or builds it, concurrent callers of the key wait for
+// a single build. A caller stops waiting, when its context is done. The context of the builder has the values
+// of the context of the first caller and is canceled, when all callers stopped waiting.
+func (o *BoundedCache[K, V]) GetOrBuildContext(
+	ctx context.Context, key K, builder func(ctx context.Context) (V, error)) (value V, err error) {
+
+	o.lock.Lock()
+	var ok bool
+	if value, ok = o.get(key); ok {
+		o.unlockAndNotify()
+		return
+	}
+	if err = o.cachedError(key); err != nil {
+		o.unlockAndNotify()
+		return
+	}
+
+	current := o.calls[key]
+	if current == nil {
+		var buildCtx context.Context
+		current = &call[V]{done: make(chan struct{})}
+		buildCtx, current.cancel = context.WithCancel(valuesContext{Context: ctx})
+		if o.calls == nil {
+			o.calls = map[K]*call[V]{}
+		}
+		o.calls[key] = current
+		go o.build(buildCtx, key, current, o.generation, builder)
+	}
+	current.waiters++
+	o.unlockAndNotify()
+
+	select {
+	case <-current.done:
+		return current.value, current.err
+	case <-ctx.Done():
+		o.lock.Lock()
+		if current.waiters--; current.waiters == 0 {
+			// later callers start a new build instead of waiting for the canceled one
+			current.canceled = true
+			current.cancel()
+			if o.calls[key] == current {
+				delete(o.calls, key)
+			}
+		}
+		o.lock.Unlock()
+		err = ctx.Err()
+		return
+	}
+}
+
+func (o *BoundedCache[K, V]) build(
+	ctx context.Context, key K, current *call[V], generation uint64, builder func(ctx context.Context) (V, error)) {
+
+	start := time.Now()
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			current.err = fmt.Errorf("cache builder of %v panicked: %v", key, recovered)
+		}
+		current.cancel()
+		latency := time.Since(start)
+
+		o.lock.Lock()
+		o.metrics().Build(latency, current.err)
+		if current.err != nil {
+			lg.LOG.Debugf("cache %v: build of %v failed after %v: %v", o.Name, key, latency, current.err)
+		} else {
+			lg.LOG.Debugf("cache %v: built %v in %v", o.Name, key, latency)
+		}
+		if o.calls[key] == current {
+			delete(o.calls, key)
+		}
+		if generation == o.generation && !current.invalidated {
+			if current.err == nil {
+				o.put(key, current.value, o.TTL)
+			} else if o.ErrorTTL > 0 && !current.canceled {
+				if o.errors == nil {
+					o.errors = map[K]*buildError{}
+				}
+				o.errors[key] = &buildError{err: current.err, expiresAt: o.currentTime().Add(o.ErrorTTL)}
+			}
+		}
+		removed, listeners := o.takeRemoved()
+		o.lock.Unlock()
+		close(current.done)
+		notify(removed, listeners)
+	}()
+	current.value, current.err = builder(ctx)
+}
+
+// cachedError returns the cached error of the builder of the key, nil if there is none or it is expired.
+func (o *BoundedCache[K, V]) cachedError(key K) (err error) {
+	if item, ok := o.errors[key]; ok {
+		if o.currentTime().After(item.expiresAt) {
+			delete(o.errors, key)
+		} else {
+			err = item.err
+		}
+	}
+	return
+}
+
+// valuesContext keeps the values of the context without its cancellation.
+type valuesContext struct {
+	context.Context
+}
+
+func (valuesContext) Deadline() (deadline time.Time, ok bool) {
+	return
+}
+
+func (valuesContext) Done() <-chan struct{} {
+	return nil
+}
+
+func (valuesContext) Err() error {
+	return nil
+}
+
+func (o *BoundedCache[K, V]) Put(key K, value V) {
+	o.PutTTL(key, value, o.TTL)
+}
+
+// PutTTL puts the value with its time to live, 0 for no expiration.
+func (o *BoundedCache[K, V]) PutTTL(key K, value V, ttl time.Duration) {
+	o.lock.Lock()
+	o.put(key, value, ttl)
+	o.unlockAndNotify()
+}
+
+// Remove removes the entry of the key and returns true, if it existed.
+// A running build of the key doesn't put its value, the callers waiting for it still get the value,
+// later callers start a new build.
+func (o *BoundedCache[K, V]) Remove(key K) (ok bool) {
+	o.lock.Lock()
+	var item *entry[K, V]
+	if item, ok = o.entries[key]; ok {
+		o.remove(item, Invalidated)
+		lg.LOG.Debugf("cache %v: invalidated %v", o.Name, key)
+	}
+	if current := o.calls[key]; current != nil {
+		current.invalidated = true
+		delete(o.calls, key)
+	}
+	delete(o.errors, key)
+	o.unlockAndNotify()
+	return
+}
+
+// Len returns the count of the entries, including expired ones, which are not removed yet.
+func (o *BoundedCache[K, V]) Len() (ret int) {
+	o.lock.Lock()
+	ret = len(o.entries)
+	o.lock.Unlock()
+	return
+}
+
+// Stats returns the statistics since the creation of the cache.
+func (o *BoundedCache[K, V]) Stats() (ret Stats) {
+	o.lock.Lock()
+	ret = o.stats
+	ret.Size = len(o.entries)
+	o.lock.Unlock()
+	return
+}
+
+func (o *BoundedCache[K, V]) get(key K) (value V, ok bool) {
+	var item *entry[K, V]
+	if item, ok = o.entries[key]; ok && item.expired(o.currentTime()) {
+		o.remove(item, Expired)
+		o.stats.Expirations++
+		o.metrics().Expiration()
+		ok = false
+	}
+	if !ok {
+		o.stats.Misses++
+		o.metrics().Miss()
+		return
+	}
+	o.stats.Hits++
+	o.metrics().Hit()
+	o.evictor.touch(item)
+	value = item.value
+	return
+}
+
+func (o *BoundedCache[K, V]) put(key K, value V, ttl time.Duration) {
+	delete(o.errors, key)
+	if o.entries == nil {
+		o.entries = map[K]*entry[K, V]{}
+		o.evictor = newEvictor[K, V](o.Policy)
+	}
+
+	var expiresAt time.Time
+	if ttl > 0 {
+		expiresAt = o.currentTime().Add(ttl)
+	}
+	if item, ok := o.entries[key]; ok {
+		item.value, item.expiresAt = value, expiresAt
+		o.evictor.touch(item)
+		return
+	}
+
+	for o.MaxSize > 0 && len(o.entries) >= o.MaxSize {
+		victim := o.evictor.victim()
+		o.remove(victim, Evicted)
+		o.stats.Evictions++
+		o.metrics().Eviction()
+		lg.LOG.Debugf("cache %v: evicted %v", o.Name, victim.key)
+	}
+	item := &entry[K, V]{key: key, value: value, expiresAt: expiresAt}
+	o.entries[key] = item
+	o.evictor.add(item)
+	o.metrics().Size(len(o.entries))
+}
+
+func (o *BoundedCache[K, V]) remove(item *entry[K, V], reason RemovalReason) {
+	delete(o.entries, item.key)
+	o.evictor.remove(item)
+	o.metrics().Size(len(o.entries))
+	if len(o.listeners) > 0 {
+		o.removed = append(o.removed, removal[K, V]{key: item.key, value: item.value, reason: reason})
+	}
+}
+
+func (o *BoundedCache[K, V]) metrics() Metrics {
+	if o.Metrics != nil {
+		return o.Metrics
+	}
+	return nopMetrics{}
+}
+
+// takeRemoved returns the removed entries and the listeners to notify, must be called with the lock held.
+func (o *BoundedCache[K, V]) takeRemoved() (removed []removal[K, V], listeners []RemovalListener[K, V]) {
+	removed, listeners = o.removed, o.listeners
+	o.removed = nil
+	return
+}
+
+// unlockAndNotify releases the lock and notifies the listeners about the removed entries.
+func (o *BoundedCache[K, V]) unlockAndNotify() {
+	removed, listeners := o.takeRemoved()
+	o.lock.Unlock()
+	notify(removed, listeners)
+}
+
+func notify[K comparable, V any](removed []removal[K, V], listeners []RemovalListener[K, V]) {
+	for _, item := range removed {
+		for _, listener := range listeners {
+			listener(item.key, item.value, item.reason)
+		}
+	}
+}
+
+func (o *BoundedCache[K, V]) currentTime() time.Time {
+	if o.now != nil {
+		return o.now()
+	}
+	return time.Now()
+}
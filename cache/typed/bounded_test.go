@@ -0,0 +1,93 @@
+package typed
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBoundedCacheLRU(t *testing.T) {
+	cache := NewCache[string, int](2, LRU, 0)
+	cache.Put("a", 1)
+	cache.Put("b", 2)
+	cache.Get("a")
+	cache.Put("c", 3)
+
+	if _, ok := cache.Get("b"); ok {
+		t.Fatal("expected b evicted as least recently used")
+	}
+	if value, ok := cache.Get("a"); !ok || value != 1 {
+		t.Fatalf("expected a, got %v", value)
+	}
+	if stats := cache.Stats(); stats.Evictions != 1 || stats.Hits != 2 || stats.Misses != 1 || stats.Size != 2 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+
+	cache.Clear()
+	if cache.Len() != 0 {
+		t.Fatalf("expected empty cache after clear, got %v", cache.Len())
+	}
+}
+
+func TestBoundedCacheLFU(t *testing.T) {
+	cache := NewCache[string, int](2, LFU, 0)
+	cache.Put("a", 1)
+	cache.Put("b", 2)
+	cache.Get("a")
+	cache.Get("a")
+	cache.Get("b")
+	cache.Put("c", 3)
+
+	if _, ok := cache.Get("b"); ok {
+		t.Fatal("expected b evicted as least frequently used")
+	}
+	if _, ok := cache.Get("a"); !ok {
+		t.Fatal("expected a")
+	}
+}
+
+func TestBoundedCacheTTL(t *testing.T) {
+	now := time.Now()
+	cache := NewCache[string, int](10, LRU, time.Minute)
+	cache.now = func() time.Time { return now }
+	cache.Put("a", 1)
+	cache.PutTTL("b", 2, 0)
+
+	now = now.Add(2 * time.Minute)
+	if _, ok := cache.Get("a"); ok {
+		t.Fatal("expected a expired")
+	}
+	if _, ok := cache.Get("b"); !ok {
+		t.Fatal("expected b without expiration")
+	}
+	if stats := cache.Stats(); stats.Expirations != 1 || stats.Size != 1 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
+
+func TestBoundedCacheConcurrent(t *testing.T) {
+	for _, policy := range []EvictionPolicy{LRU, LFU} {
+		cache := NewCache[string, int](50, policy, 0)
+		var wg sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				for j := 0; j < 1000; j++ {
+					key := strconv.Itoa((i * j) % 100)
+					if _, err := cache.GetOrBuild(key, func() (int, error) { return j, nil }); err != nil {
+						t.Error(err)
+					}
+					if j%10 == 0 {
+						cache.Remove(key)
+					}
+				}
+			}(i)
+		}
+		wg.Wait()
+		if cache.Len() > 50 {
+			t.Fatalf("%v: expected at most 50 entries, got %v", policy, cache.Len())
+		}
+	}
+}
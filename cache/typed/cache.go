@@ -0,0 +1,13 @@
+// Package typed provides the type-safe caches, the untyped interfaces of the cache package are adapters of them.
+package typed
+
+type Cache[K comparable, V any] interface {
+	Get(key K) (value V, ok bool)
+	GetOrBuild(key K, builder func() (V, error)) (value V, err error)
+	Put(key K, value V)
+	Clear()
+}
+
+type ObjectCache[T any] interface {
+	Get() (ret T, err error)
+}
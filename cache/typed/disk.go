@@ -0,0 +1,286 @@
+package typed
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-ee/utils/eio"
+	"github.com/go-ee/utils/lg"
+)
+
+const diskFileSuffix = ".cache"
+
+// Codec encodes the values of the DiskCache.
+type Codec[V any] interface {
+	Marshal(value V) ([]byte, error)
+	Unmarshal(data []byte) (V, error)
+}
+
+// JSONCodec encodes the values as JSON.
+type JSONCodec[V any] struct{}
+
+func (JSONCodec[V]) Marshal(value V) ([]byte, error) {
+	return json.Marshal(value)
+}
+
+func (JSONCodec[V]) Unmarshal(data []byte) (ret V, err error) {
+	err = json.Unmarshal(data, &ret)
+	return
+}
+
+// BytesCodec stores the bytes as they are, e.g. for downloaded artifacts.
+type BytesCodec struct{}
+
+func (BytesCodec) Marshal(value []byte) ([]byte, error) {
+	return value, nil
+}
+
+func (BytesCodec) Unmarshal(data []byte) ([]byte, error) {
+	return data, nil
+}
+
+// Encryptor encrypts the files of the DiskCache with the key as additional data, like encrypt.Encryptor.
+type Encryptor interface {
+	EncryptWithData(data []byte, additionalData []byte) ([]byte, error)
+	DecryptWithData(data []byte, additionalData []byte) ([]byte, error)
+}
+
+// DiskCache layers the Memory cache over the files of a folder, so that the values survive restarts.
+// The least recently used files are removed, when their size exceeds MaxDiskSize.
+// Files, which can't be decoded or decrypted, are misses and removed.
+type DiskCache[V any] struct {
+	Memory *BoundedCache[string, V]
+	Folder string
+	Codec  Codec[V]
+	// Encryptor encrypts the files, nil for plain files.
+	Encryptor Encryptor
+	// MaxDiskSize is the maximum of the sizes of the files in bytes, 0 for no limit.
+	MaxDiskSize int64
+
+	files  map[string]*diskFile
+	order  *list.List
+	size   int64
+	loaded bool
+	lock   sync.Mutex
+}
+
+// diskFile is the index entry of a file, the order is by the last access.
+type diskFile struct {
+	name    string
+	size    int64
+	element *list.Element
+}
+
+// NewDiskCache creates a disk cache in the folder, with an LRU memory cache of 1000 entries.
+func NewDiskCache[V any](folder string, codec Codec[V], maxDiskSize int64) *DiskCache[V] {
+	return &DiskCache[V]{Memory: NewCache[string, V](1000, LRU, 0), Folder: folder, Codec: codec,
+		MaxDiskSize: maxDiskSize}
+}
+
+func (o *DiskCache[V]) Get(key string) (value V, ok bool) {
+	if value, ok = o.Memory.Get(key); !ok {
+		if value, ok = o.read(key); ok {
+			o.Memory.Put(key, value)
+		}
+	}
+	return
+}
+
+// GetOrBuild returns the value of the memory, of the disk or builds it, once for concurrent callers.
+// The built value is returned, also if it can't be written to the disk.
+func (o *DiskCache[V]) GetOrBuild(key string, builder func() (V, error)) (value V, err error) {
+	return o.Memory.GetOrBuild(key, func() (ret V, err error) {
+		var ok bool
+		if ret, ok = o.read(key); ok {
+			return
+		}
+		if ret, err = builder(); err == nil {
+			o.writeOrWarn(key, ret)
+		}
+		return
+	})
+}
+
+func (o *DiskCache[V]) Put(key string, value V) {
+	o.Memory.Put(key, value)
+	o.writeOrWarn(key, value)
+}
+
+// Remove removes the value of the key from the memory and the disk and returns true, if it existed.
+func (o *DiskCache[V]) Remove(key string) (ok bool) {
+	ok = o.Memory.Remove(key)
+	o.lock.Lock()
+	if err := o.loadIndex(); err == nil {
+		if file, indexed := o.files[o.fileName(key)]; indexed {
+			o.removeFile(file)
+			ok = true
+		}
+	}
+	o.lock.Unlock()
+	return
+}
+
+// Clear removes all values from the memory and the disk.
+func (o *DiskCache[V]) Clear() {
+	o.Memory.Clear()
+	o.lock.Lock()
+	if err := o.loadIndex(); err == nil {
+		for _, file := range o.files {
+			o.removeFile(file)
+		}
+	}
+	o.lock.Unlock()
+}
+
+// DiskSize returns the size of the files in bytes.
+func (o *DiskCache[V]) DiskSize() (ret int64, err error) {
+	o.lock.Lock()
+	if err = o.loadIndex(); err == nil {
+		ret = o.size
+	}
+	o.lock.Unlock()
+	return
+}
+
+func (o *DiskCache[V]) read(key string) (ret V, ok bool) {
+	name := o.fileName(key)
+	data, err := os.ReadFile(filepath.Join(o.Folder, name))
+	if err != nil {
+		return
+	}
+	if o.Encryptor != nil {
+		data, err = o.Encryptor.DecryptWithData(data, []byte(key))
+	}
+	if err == nil {
+		ret, err = o.Codec.Unmarshal(data)
+	}
+
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	if loadErr := o.loadIndex(); loadErr != nil {
+		return
+	}
+	file, indexed := o.files[name]
+	if err != nil {
+		lg.LOG.Warnf("remove cache file %v of %v: %v", name, key, err)
+		if indexed {
+			o.removeFile(file)
+		}
+		return
+	}
+	if indexed {
+		o.order.MoveToFront(file.element)
+		now := time.Now()
+		_ = os.Chtimes(filepath.Join(o.Folder, name), now, now)
+	}
+	ok = true
+	return
+}
+
+func (o *DiskCache[V]) writeOrWarn(key string, value V) {
+	if err := o.write(key, value); err != nil {
+		lg.LOG.Warnf("could not write the cache file of %v: %v", key, err)
+	}
+}
+
+func (o *DiskCache[V]) write(key string, value V) (err error) {
+	var data []byte
+	if data, err = o.Codec.Marshal(value); err != nil {
+		return
+	}
+	if o.Encryptor != nil {
+		if data, err = o.Encryptor.EncryptWithData(data, []byte(key)); err != nil {
+			return
+		}
+	}
+
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	if err = o.loadIndex(); err != nil {
+		return
+	}
+	name := o.fileName(key)
+	if err = eio.WriteFileAtomic(filepath.Join(o.Folder, name), data, 0600); err != nil {
+		return
+	}
+	if file, ok := o.files[name]; ok {
+		o.size -= file.size
+		file.size = int64(len(data))
+		o.order.MoveToFront(file.element)
+	} else {
+		file = &diskFile{name: name, size: int64(len(data))}
+		file.element = o.order.PushFront(file)
+		o.files[name] = file
+	}
+	o.size += int64(len(data))
+	o.evict()
+	return
+}
+
+// evict removes the least recently used files until the size is not above MaxDiskSize, except the last written.
+func (o *DiskCache[V]) evict() {
+	for o.MaxDiskSize > 0 && o.size > o.MaxDiskSize && o.order.Len() > 1 {
+		o.removeFile(o.order.Back().Value.(*diskFile))
+	}
+}
+
+func (o *DiskCache[V]) removeFile(file *diskFile) {
+	if err := os.Remove(filepath.Join(o.Folder, file.name)); err != nil && !os.IsNotExist(err) {
+		lg.LOG.Warnf("could not remove the cache file %v: %v", file.name, err)
+	}
+	o.order.Remove(file.element)
+	delete(o.files, file.name)
+	o.size -= file.size
+}
+
+// loadIndex loads the files of the folder ordered by their modification time, once.
+func (o *DiskCache[V]) loadIndex() (err error) {
+	if o.loaded {
+		return
+	}
+	if err = os.MkdirAll(o.Folder, 0700); err != nil {
+		return
+	}
+	var entries []os.DirEntry
+	if entries, err = os.ReadDir(o.Folder); err != nil {
+		return
+	}
+
+	var infos []os.FileInfo
+	for _, item := range entries {
+		if !item.Type().IsRegular() || !strings.HasSuffix(item.Name(), diskFileSuffix) {
+			continue
+		}
+		if info, infoErr := item.Info(); infoErr == nil {
+			infos = append(infos, info)
+		}
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].ModTime().After(infos[j].ModTime())
+	})
+
+	o.files, o.order, o.size = map[string]*diskFile{}, list.New(), 0
+	for _, info := range infos {
+		file := &diskFile{name: info.Name(), size: info.Size()}
+		file.element = o.order.PushBack(file)
+		o.files[file.name] = file
+		o.size += file.size
+	}
+	o.loaded = true
+	o.evict()
+	return
+}
+
+// fileName is the hash of the key, so that any key is a valid file name.
+func (o *DiskCache[V]) fileName(key string) string {
+	hash := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(hash[:]) + diskFileSuffix
+}
@@ -0,0 +1,77 @@
+package typed
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/go-ee/utils/encrypt"
+)
+
+func TestDiskCacheRestart(t *testing.T) {
+	folder := t.TempDir()
+	encryptor, err := encrypt.NewEncryptor("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cache := NewDiskCache[[]byte](folder, BytesCodec{}, 0)
+	cache.Encryptor = encryptor
+	cache.Put("artifact", []byte("content"))
+
+	files, _ := os.ReadDir(folder)
+	if len(files) != 1 {
+		t.Fatalf("expected 1 file, got %v", len(files))
+	}
+	if data, _ := os.ReadFile(folder + "/" + files[0].Name()); bytes.Contains(data, []byte("content")) {
+		t.Fatal("expected an encrypted file")
+	}
+
+	// a new cache reads the value of the disk without building it
+	restarted := NewDiskCache[[]byte](folder, BytesCodec{}, 0)
+	restarted.Encryptor = encryptor
+	if value, err := restarted.GetOrBuild("artifact", func() ([]byte, error) {
+		t.Fatal("unexpected build")
+		return nil, nil
+	}); err != nil || string(value) != "content" {
+		t.Fatalf("expected content, got %s, %v", value, err)
+	}
+
+	// the wrong key is a miss and removes the file
+	wrongKey, _ := encrypt.NewEncryptor("other")
+	restarted = NewDiskCache[[]byte](folder, BytesCodec{}, 0)
+	restarted.Encryptor = wrongKey
+	if _, ok := restarted.Get("artifact"); ok {
+		t.Fatal("expected a miss with the wrong key")
+	}
+	if size, err := restarted.DiskSize(); err != nil || size != 0 {
+		t.Fatalf("expected no files, got %v, %v", size, err)
+	}
+}
+
+func TestDiskCacheEviction(t *testing.T) {
+	cache := NewDiskCache[string](t.TempDir(), JSONCodec[string]{}, 30)
+	cache.Put("a", "0123456789")
+	cache.Put("b", "0123456789")
+	// a is used more recently than b
+	cache.Memory.Clear()
+	if _, ok := cache.Get("a"); !ok {
+		t.Fatal("expected a")
+	}
+	cache.Put("c", "0123456789")
+
+	cache.Memory.Clear()
+	for key, expected := range map[string]bool{"a": true, "b": false, "c": true} {
+		if _, ok := cache.Get(key); ok != expected {
+			t.Fatalf("expected %v for %v", expected, key)
+		}
+	}
+	if size, err := cache.DiskSize(); err != nil || size != 24 {
+		t.Fatalf("expected 24 bytes, got %v, %v", size, err)
+	}
+
+	cache.Clear()
+	if _, ok := cache.Get("a"); ok {
+		t.Fatal("expected no values after clear")
+	}
+}
@@ -0,0 +1,153 @@
+package typed
+
+import (
+	"container/heap"
+	"container/list"
+	"time"
+)
+
+// EvictionPolicy selects the entry, which is evicted when a cache is full.
+type EvictionPolicy int
+
+const (
+	// LRU evicts the least recently used entry.
+	LRU EvictionPolicy = iota
+	// LFU evicts the least frequently used entry, the least recently used one of equally used entries.
+	LFU
+)
+
+func (o EvictionPolicy) String() string {
+	switch o {
+	case LRU:
+		return "LRU"
+	case LFU:
+		return "LFU"
+	}
+	return "unknown"
+}
+
+// Stats are the statistics of a cache.
+type Stats struct {
+	Hits        uint64
+	Misses      uint64
+	Evictions   uint64
+	Expirations uint64
+	Size        int
+}
+
+// HitRatio returns the ratio of the hits to all lookups, 0 without lookups.
+func (o Stats) HitRatio() float64 {
+	if lookups := o.Hits + o.Misses; lookups > 0 {
+		return float64(o.Hits) / float64(lookups)
+	}
+	return 0
+}
+
+type entry[K comparable, V any] struct {
+	key       K
+	value     V
+	expiresAt time.Time
+
+	// the position of the entry for the evictor
+	element   *list.Element
+	frequency int
+	accessed  uint64
+	index     int
+}
+
+func (o *entry[K, V]) expired(now time.Time) bool {
+	return !o.expiresAt.IsZero() && now.After(o.expiresAt)
+}
+
+// evictor keeps the order of the entries for the eviction policy.
+type evictor[K comparable, V any] interface {
+	add(item *entry[K, V])
+	touch(item *entry[K, V])
+	remove(item *entry[K, V])
+	victim() *entry[K, V]
+}
+
+func newEvictor[K comparable, V any](policy EvictionPolicy) evictor[K, V] {
+	if policy == LFU {
+		return &lfuEvictor[K, V]{}
+	}
+	return &lruEvictor[K, V]{order: list.New()}
+}
+
+type lruEvictor[K comparable, V any] struct {
+	order *list.List
+}
+
+func (o *lruEvictor[K, V]) add(item *entry[K, V]) {
+	item.element = o.order.PushFront(item)
+}
+
+func (o *lruEvictor[K, V]) touch(item *entry[K, V]) {
+	o.order.MoveToFront(item.element)
+}
+
+func (o *lruEvictor[K, V]) remove(item *entry[K, V]) {
+	o.order.Remove(item.element)
+}
+
+func (o *lruEvictor[K, V]) victim() *entry[K, V] {
+	return o.order.Back().Value.(*entry[K, V])
+}
+
+// lfuEvictor is a min heap by the frequency and the last access.
+type lfuEvictor[K comparable, V any] struct {
+	entries []*entry[K, V]
+	tick    uint64
+}
+
+func (o *lfuEvictor[K, V]) add(item *entry[K, V]) {
+	o.tick++
+	item.frequency, item.accessed = 1, o.tick
+	heap.Push(o, item)
+}
+
+func (o *lfuEvictor[K, V]) touch(item *entry[K, V]) {
+	o.tick++
+	item.frequency++
+	item.accessed = o.tick
+	heap.Fix(o, item.index)
+}
+
+func (o *lfuEvictor[K, V]) remove(item *entry[K, V]) {
+	heap.Remove(o, item.index)
+}
+
+func (o *lfuEvictor[K, V]) victim() *entry[K, V] {
+	return o.entries[0]
+}
+
+func (o *lfuEvictor[K, V]) Len() int {
+	return len(o.entries)
+}
+
+func (o *lfuEvictor[K, V]) Less(i, j int) bool {
+	if o.entries[i].frequency != o.entries[j].frequency {
+		return o.entries[i].frequency < o.entries[j].frequency
+	}
+	return o.entries[i].accessed < o.entries[j].accessed
+}
+
+func (o *lfuEvictor[K, V]) Swap(i, j int) {
+	o.entries[i], o.entries[j] = o.entries[j], o.entries[i]
+	o.entries[i].index = i
+	o.entries[j].index = j
+}
+
+func (o *lfuEvictor[K, V]) Push(x interface{}) {
+	item := x.(*entry[K, V])
+	item.index = len(o.entries)
+	o.entries = append(o.entries, item)
+}
+
+func (o *lfuEvictor[K, V]) Pop() interface{} {
+	last := len(o.entries) - 1
+	item := o.entries[last]
+	o.entries[last] = nil
+	o.entries = o.entries[:last]
+	return item
+}
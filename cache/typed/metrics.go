@@ -0,0 +1,60 @@
+package typed
+
+import "time"
+
+// Metrics receives the measurements of a cache, e.g. to export them to a monitoring system.
+// It is called under the lock of the cache, so it must be fast and must not use the cache.
+type Metrics interface {
+	Hit()
+	Miss()
+	Eviction()
+	Expiration()
+	Build(latency time.Duration, err error)
+	Size(size int)
+}
+
+// RemovalReason is the reason, why an entry was removed from a cache.
+type RemovalReason int
+
+const (
+	// Evicted by the eviction policy, because the cache was full.
+	Evicted RemovalReason = iota
+	// Expired after its time to live.
+	Expired
+	// Invalidated by Remove.
+	Invalidated
+	// Cleared by Clear.
+	Cleared
+)
+
+func (o RemovalReason) String() string {
+	switch o {
+	case Evicted:
+		return "evicted"
+	case Expired:
+		return "expired"
+	case Invalidated:
+		return "invalidated"
+	case Cleared:
+		return "cleared"
+	}
+	return "unknown"
+}
+
+// RemovalListener is notified about the removed entries, outside the lock of the cache.
+type RemovalListener[K comparable, V any] func(key K, value V, reason RemovalReason)
+
+type removal[K comparable, V any] struct {
+	key    K
+	value  V
+	reason RemovalReason
+}
+
+type nopMetrics struct{}
+
+func (nopMetrics) Hit()                       {}
+func (nopMetrics) Miss()                      {}
+func (nopMetrics) Eviction()                  {}
+func (nopMetrics) Expiration()                {}
+func (nopMetrics) Build(time.Duration, error) {}
+func (nopMetrics) Size(int)                   {}
@@ -0,0 +1,59 @@
+package typed
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+type testMetrics struct {
+	hits, misses, evictions, builds, failedBuilds, size int
+}
+
+func (o *testMetrics) Hit()        { o.hits++ }
+func (o *testMetrics) Miss()       { o.misses++ }
+func (o *testMetrics) Eviction()   { o.evictions++ }
+func (o *testMetrics) Expiration() {}
+func (o *testMetrics) Size(size int) {
+	o.size = size
+}
+
+func (o *testMetrics) Build(_ time.Duration, err error) {
+	if err != nil {
+		o.failedBuilds++
+	} else {
+		o.builds++
+	}
+}
+
+func TestBoundedCacheMetricsAndListeners(t *testing.T) {
+	metrics := &testMetrics{}
+	cache := NewCache[string, int](2, LRU, 0)
+	cache.Metrics = metrics
+
+	removed := map[string]RemovalReason{}
+	cache.Subscribe(func(key string, value int, reason RemovalReason) {
+		// listeners may use the cache
+		cache.Len()
+		removed[key] = reason
+	})
+
+	_, _ = cache.GetOrBuild("a", func() (int, error) { return 1, nil })
+	_, _ = cache.GetOrBuild("a", func() (int, error) { return 1, nil })
+	_, _ = cache.GetOrBuild("b", func() (int, error) { return 0, errors.New("failed") })
+	cache.Put("b", 2)
+	cache.Put("c", 3)
+	cache.Remove("b")
+
+	if *metrics != (testMetrics{hits: 1, misses: 2, evictions: 1, builds: 1, failedBuilds: 1, size: 1}) {
+		t.Fatalf("unexpected metrics %+v", metrics)
+	}
+	if removed["a"] != Evicted || removed["b"] != Invalidated {
+		t.Fatalf("unexpected removals %v", removed)
+	}
+
+	cache.Clear()
+	if removed["c"] != Cleared || metrics.size != 0 {
+		t.Fatalf("expected c cleared, got %v", removed)
+	}
+}
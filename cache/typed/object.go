@@ -0,0 +1,162 @@
+package typed
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-ee/utils/lg"
+)
+
+// TimeoutObjectCache builds the object again, when it is older than the Timeout.
+// Concurrent callers wait for a single build. With Refresh the object is built in the background,
+// while the previous object is served, up to MaxStaleness after the Timeout. Also after an error of
+// the builder the previous object is served up to MaxStaleness after the Timeout.
+type TimeoutObjectCache[T any] struct {
+	Timeout time.Duration
+	Builder func() (T, error)
+
+	// Refresh builds the object in the background after the Timeout, the previous object is served meanwhile.
+	Refresh bool
+	// MaxStaleness is the time after the Timeout, the previous object is served while it is built
+	// in the background or after errors of the builder, 0 for not serving it.
+	MaxStaleness time.Duration
+	// Metrics receives the hits of built objects, the misses and the builds, nil for none.
+	Metrics Metrics
+
+	buildAt    time.Time
+	obj        T
+	built      bool
+	building   *objectBuild
+	generation uint64
+	lastErr    error
+	now        func() time.Time
+
+	lock sync.Mutex
+}
+
+// objectBuild is the running build, the err is set before done is closed.
+type objectBuild struct {
+	done chan struct{}
+	err  error
+}
+
+func NewObjectCache[T any](builder func() (T, error)) *TimeoutObjectCache[T] {
+	return &TimeoutObjectCache[T]{Timeout: 3 * time.Second, Builder: builder}
+}
+
+// NewRefreshObjectCache creates an object cache, which builds the object in the background after the timeout
+// and serves the previous object up to the max staleness after the timeout.
+func NewRefreshObjectCache[T any](
+	builder func() (T, error), timeout time.Duration, maxStaleness time.Duration) *TimeoutObjectCache[T] {
+
+	return &TimeoutObjectCache[T]{Timeout: timeout, Builder: builder, Refresh: true, MaxStaleness: maxStaleness}
+}
+
+func (o *TimeoutObjectCache[T]) Get() (ret T, err error) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	for {
+		if o.built {
+			age := o.currentTime().Sub(o.buildAt)
+			if age <= o.Timeout {
+				o.metrics().Hit()
+				return o.obj, nil
+			}
+			if o.Refresh && o.servesStale(age) {
+				if o.building == nil {
+					o.startBuild()
+				}
+				o.metrics().Hit()
+				return o.obj, nil
+			}
+		}
+
+		o.metrics().Miss()
+		current := o.building
+		if current == nil {
+			current = o.startBuild()
+		}
+		o.lock.Unlock()
+		<-current.done
+		o.lock.Lock()
+
+		if current.err != nil {
+			if o.built && o.servesStale(o.currentTime().Sub(o.buildAt)) {
+				return o.obj, nil
+			}
+			return ret, current.err
+		}
+	}
+}
+
+// Invalidate removes the object, the next Get builds it. The result of a running build is dropped.
+func (o *TimeoutObjectCache[T]) Invalidate() {
+	o.lock.Lock()
+	var zero T
+	o.obj, o.built = zero, false
+	o.generation++
+	o.lock.Unlock()
+}
+
+// LastError returns the error of the last build, nil if it succeeded.
+func (o *TimeoutObjectCache[T]) LastError() (ret error) {
+	o.lock.Lock()
+	ret = o.lastErr
+	o.lock.Unlock()
+	return
+}
+
+// startBuild builds the object in the background, must be called with the lock held.
+func (o *TimeoutObjectCache[T]) startBuild() (ret *objectBuild) {
+	ret = &objectBuild{done: make(chan struct{})}
+	o.building = ret
+	go o.build(ret, o.generation)
+	return
+}
+
+func (o *TimeoutObjectCache[T]) build(current *objectBuild, generation uint64) {
+	var obj T
+	var err error
+	start := time.Now()
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = fmt.Errorf("object builder panicked: %v", recovered)
+		}
+		latency := time.Since(start)
+		if err != nil {
+			lg.LOG.Debugf("object cache: build failed after %v: %v", latency, err)
+		}
+
+		o.lock.Lock()
+		o.metrics().Build(latency, err)
+		o.building = nil
+		o.lastErr = err
+		if err == nil && generation == o.generation {
+			o.obj, o.built, o.buildAt = obj, true, o.currentTime()
+		}
+		current.err = err
+		o.lock.Unlock()
+		close(current.done)
+	}()
+	obj, err = o.Builder()
+}
+
+func (o *TimeoutObjectCache[T]) metrics() Metrics {
+	if o.Metrics != nil {
+		return o.Metrics
+	}
+	return nopMetrics{}
+}
+
+func (o *TimeoutObjectCache[T]) servesStale(age time.Duration) bool {
+	return age <= o.Timeout+o.MaxStaleness && o.MaxStaleness > 0
+}
+
+func (o *TimeoutObjectCache[T]) currentTime() time.Time {
+	if o.now != nil {
+		return o.now()
+	}
+	return time.Now()
+}
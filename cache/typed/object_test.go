@@ -0,0 +1,107 @@
+package typed
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newTestRefreshCache(builder func() (int, error)) (ret *TimeoutObjectCache[int], advance func(d time.Duration)) {
+	start := time.Now()
+	var offset int64
+	ret = NewRefreshObjectCache(builder, time.Minute, time.Hour)
+	ret.now = func() time.Time {
+		return start.Add(time.Duration(atomic.LoadInt64(&offset)))
+	}
+	advance = func(d time.Duration) {
+		atomic.AddInt64(&offset, int64(d))
+	}
+	return
+}
+
+func TestTimeoutObjectCacheRefresh(t *testing.T) {
+	var value int32
+	release := make(chan struct{}, 1)
+	cache, advance := newTestRefreshCache(func() (int, error) {
+		if atomic.AddInt32(&value, 1) > 1 {
+			<-release
+		}
+		return int(atomic.LoadInt32(&value)), nil
+	})
+
+	if obj, err := cache.Get(); err != nil || obj != 1 {
+		t.Fatalf("expected 1, got %v, %v", obj, err)
+	}
+
+	// the stale object is served, while it is built in the background
+	advance(2 * time.Minute)
+	for i := 0; i < 3; i++ {
+		if obj, err := cache.Get(); err != nil || obj != 1 {
+			t.Fatalf("expected stale 1, got %v, %v", obj, err)
+		}
+	}
+	release <- struct{}{}
+	waitFor(t, func() bool {
+		obj, _ := cache.Get()
+		return obj == 2
+	})
+	if builds := atomic.LoadInt32(&value); builds != 2 {
+		t.Fatalf("expected 2 builds, got %v", builds)
+	}
+}
+
+func TestTimeoutObjectCacheStaleOnError(t *testing.T) {
+	errBuild := errors.New("build failed")
+	var fail atomic.Bool
+	cache, advance := newTestRefreshCache(func() (int, error) {
+		if fail.Load() {
+			return 0, errBuild
+		}
+		return 1, nil
+	})
+	cache.Refresh = false
+
+	if obj, err := cache.Get(); err != nil || obj != 1 {
+		t.Fatalf("expected 1, got %v, %v", obj, err)
+	}
+	fail.Store(true)
+	advance(30 * time.Minute)
+	if obj, err := cache.Get(); err != nil || obj != 1 {
+		t.Fatalf("expected stale 1, got %v, %v", obj, err)
+	}
+	if err := cache.LastError(); !errors.Is(err, errBuild) {
+		t.Fatalf("expected the build error, got %v", err)
+	}
+
+	// too stale
+	advance(time.Hour)
+	if _, err := cache.Get(); !errors.Is(err, errBuild) {
+		t.Fatalf("expected the build error, got %v", err)
+	}
+}
+
+func TestTimeoutObjectCacheInvalidate(t *testing.T) {
+	var value int32
+	cache, _ := newTestRefreshCache(func() (int, error) {
+		return int(atomic.AddInt32(&value, 1)), nil
+	})
+
+	if obj, err := cache.Get(); err != nil || obj != 1 {
+		t.Fatalf("expected 1, got %v, %v", obj, err)
+	}
+	cache.Invalidate()
+	if obj, err := cache.Get(); err != nil || obj != 2 {
+		t.Fatalf("expected 2 after invalidate, got %v, %v", obj, err)
+	}
+}
+
+func waitFor(t *testing.T, condition func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		if condition() {
+			return
+		}
+	}
+	t.Fatal("condition not met")
+}
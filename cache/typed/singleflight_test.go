@@ -0,0 +1,153 @@
+package typed
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBoundedCacheSingleflight(t *testing.T) {
+	cache := NewCache[string, int](10, LRU, 0)
+	release := make(chan struct{})
+	var builds int32
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			value, err := cache.GetOrBuild("slow", func() (int, error) {
+				atomic.AddInt32(&builds, 1)
+				<-release
+				return 1, nil
+			})
+			if err != nil || value != 1 {
+				t.Errorf("expected 1, got %v, %v", value, err)
+			}
+		}()
+	}
+
+	// other keys are not blocked by the running build
+	if value, err := cache.GetOrBuild("fast", func() (int, error) { return 2, nil }); err != nil || value != 2 {
+		t.Fatalf("expected 2, got %v, %v", value, err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if builds != 1 {
+		t.Fatalf("expected a single build, got %v", builds)
+	}
+}
+
+func TestBoundedCacheErrorTTL(t *testing.T) {
+	now := time.Now()
+	cache := NewCache[string, int](10, LRU, 0)
+	cache.ErrorTTL = time.Second
+	cache.now = func() time.Time { return now }
+
+	builds := 0
+	builder := func() (int, error) {
+		builds++
+		return 0, errors.New("failed")
+	}
+	cache.GetOrBuild("a", builder)
+	if _, err := cache.GetOrBuild("a", builder); err == nil || builds != 1 {
+		t.Fatalf("expected the cached error, got %v after %v builds", err, builds)
+	}
+
+	now = now.Add(2 * time.Second)
+	cache.GetOrBuild("a", builder)
+	if builds != 2 {
+		t.Fatalf("expected a build after the error expired, got %v builds", builds)
+	}
+}
+
+func TestBoundedCacheContext(t *testing.T) {
+	cache := NewCache[string, int](10, LRU, 0)
+	ctx, cancel := context.WithCancel(context.Background())
+	canceled := make(chan struct{})
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+
+	_, err := cache.GetOrBuildContext(ctx, "a", func(buildCtx context.Context) (int, error) {
+		<-buildCtx.Done()
+		close(canceled)
+		return 0, buildCtx.Err()
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected canceled, got %v", err)
+	}
+	select {
+	case <-canceled:
+	case <-time.After(time.Second):
+		t.Fatal("expected the build canceled without waiting callers")
+	}
+}
+
+func TestBoundedCacheCanceledBuildNotCached(t *testing.T) {
+	cache := NewCache[string, int](10, LRU, 0)
+	cache.ErrorTTL = time.Minute
+	ctx, cancel := context.WithCancel(context.Background())
+	release := make(chan struct{})
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+
+	_, err := cache.GetOrBuildContext(ctx, "a", func(buildCtx context.Context) (int, error) {
+		<-buildCtx.Done()
+		<-release
+		return 0, buildCtx.Err()
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected canceled, got %v", err)
+	}
+
+	// a caller with a live context doesn't wait for the canceled build and gets no cached error of it
+	if value, err := cache.GetOrBuild("a", func() (int, error) { return 1, nil }); err != nil || value != 1 {
+		t.Fatalf("expected 1, got %v, %v", value, err)
+	}
+	close(release)
+	time.Sleep(10 * time.Millisecond)
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+	if len(cache.errors) != 0 || len(cache.calls) != 0 {
+		t.Fatalf("expected no cached error and no call, got %v, %v", cache.errors, cache.calls)
+	}
+}
+
+func TestBoundedCacheRemoveDuringBuild(t *testing.T) {
+	cache := NewCache[string, int](10, LRU, 0)
+	started := make(chan struct{})
+	release := make(chan struct{})
+	stale := make(chan int)
+	go func() {
+		value, _ := cache.GetOrBuild("a", func() (int, error) {
+			close(started)
+			<-release
+			return 1, nil
+		})
+		stale <- value
+	}()
+
+	<-started
+	cache.Remove("a")
+	close(release)
+	if value := <-stale; value != 1 {
+		t.Fatalf("expected the waiting caller to get 1, got %v", value)
+	}
+
+	// the build, which started before the removal, doesn't put its stale value
+	if value, ok := cache.Get("a"); ok {
+		t.Fatalf("expected no entry, got %v", value)
+	}
+	if value, err := cache.GetOrBuild("a", func() (int, error) { return 2, nil }); err != nil || value != 2 {
+		t.Fatalf("expected 2, got %v, %v", value, err)
+	}
+}
@@ -96,6 +96,9 @@ func loadConfig(config interface{}, file string, properties map[string]string) (
 				}
 			}
 		}
+		if err == nil {
+			err = UnsealValues(config)
+		}
 	}
 	return
 }
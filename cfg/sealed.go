@@ -0,0 +1,200 @@
+package cfg
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/go-ee/utils/encrypt"
+)
+
+// Sealed values of config files are "ENC[v1,<base64 of the envelope of encrypt.Encryptor>]", they are decrypted
+// by Unmarshal with the MasterKey, e.g.
+//
+//	password: ENC[v1,R0VFQwE...]
+const sealedVersion = "v1"
+
+var sealedPattern = regexp.MustCompile(`^ENC\[` + sealedVersion + `,([A-Za-z0-9+/]+=*)]$`)
+
+var (
+	// MasterKeyEnv is the environment variable of the passphrase of the sealed values.
+	MasterKeyEnv = "CONFIG_MASTER_KEY"
+	// MasterKeyFileEnv is the environment variable of the file with the passphrase, if MasterKeyEnv is not set.
+	MasterKeyFileEnv = "CONFIG_MASTER_KEY_FILE"
+
+	// ErrNoMasterKey is returned, if a config contains sealed values, but no master key is set.
+	ErrNoMasterKey = errors.New("no master key for the sealed values")
+	// ErrInvalidSealedValue is returned for values, which are not sealed by Seal.
+	ErrInvalidSealedValue = errors.New("invalid sealed value")
+)
+
+// MasterKey returns the encryptor of the sealed values of the configs, by default EnvMasterKey.
+var MasterKey = EnvMasterKey
+
+var envMasterKey struct {
+	sync.Mutex
+	passphrase string
+	encryptor  *encrypt.Encryptor
+}
+
+// EnvMasterKey returns the encryptor of the passphrase of MasterKeyEnv or MasterKeyFileEnv. The encryptor is
+// reused as long as the passphrase doesn't change, because the key derivation is expensive.
+func EnvMasterKey() (ret *encrypt.Encryptor, err error) {
+	var passphrase string
+	if passphrase, err = readMasterKey(os.Getenv(MasterKeyEnv), os.Getenv(MasterKeyFileEnv)); err != nil {
+		return
+	}
+
+	envMasterKey.Lock()
+	defer envMasterKey.Unlock()
+	if envMasterKey.encryptor == nil || envMasterKey.passphrase != passphrase {
+		if ret, err = encrypt.NewEncryptor(passphrase); err != nil {
+			return
+		}
+		envMasterKey.passphrase, envMasterKey.encryptor = passphrase, ret
+	}
+	return envMasterKey.encryptor, nil
+}
+
+// LoadMasterKey creates the encryptor of the passphrase or, if it is empty, of the passphrase in the key file.
+func LoadMasterKey(passphrase string, keyFile string) (ret *encrypt.Encryptor, err error) {
+	if passphrase, err = readMasterKey(passphrase, keyFile); err == nil {
+		ret, err = encrypt.NewEncryptor(passphrase)
+	}
+	return
+}
+
+func readMasterKey(passphrase string, keyFile string) (ret string, err error) {
+	if ret = passphrase; ret == "" && keyFile != "" {
+		var data []byte
+		if data, err = os.ReadFile(keyFile); err != nil {
+			return
+		}
+		ret = strings.TrimSpace(string(data))
+	}
+	if ret == "" {
+		err = fmt.Errorf("%w, set %v or %v", ErrNoMasterKey, MasterKeyEnv, MasterKeyFileEnv)
+	}
+	return
+}
+
+// IsSealed returns true, if the value has the syntax of the sealed values.
+func IsSealed(value string) bool {
+	return sealedPattern.MatchString(value)
+}
+
+// Seal encrypts the value to the sealed syntax.
+func Seal(value string, encryptor *encrypt.Encryptor) (ret string, err error) {
+	var data []byte
+	if data, err = encryptor.Encrypt([]byte(value)); err == nil {
+		ret = "ENC[" + sealedVersion + "," + base64.StdEncoding.EncodeToString(data) + "]"
+	}
+	return
+}
+
+// Unseal decrypts the sealed value of Seal.
+func Unseal(value string, encryptor *encrypt.Encryptor) (ret string, err error) {
+	match := sealedPattern.FindStringSubmatch(value)
+	if match == nil {
+		return "", ErrInvalidSealedValue
+	}
+	var data []byte
+	if data, err = base64.StdEncoding.DecodeString(match[1]); err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidSealedValue, err)
+	}
+	if data, err = encryptor.Decrypt(data); err == nil {
+		ret = string(data)
+	}
+	return
+}
+
+// UnsealValues replaces the sealed values of the string fields, map values and elements of the config by their
+// decrypted values. The MasterKey is requested at the first sealed value only.
+func UnsealValues(config interface{}) (err error) {
+	_, err = (&unsealer{}).value(reflect.ValueOf(config))
+	return
+}
+
+type unsealer struct {
+	encryptor *encrypt.Encryptor
+}
+
+func (o *unsealer) unseal(value string) (ret string, err error) {
+	if o.encryptor == nil {
+		if o.encryptor, err = MasterKey(); err != nil {
+			return
+		}
+	}
+	return Unseal(value, o.encryptor)
+}
+
+// value unseals the sealed values of v, it returns the replacement of v, if v is not settable, e.g. a map value,
+// otherwise the invalid value.
+func (o *unsealer) value(v reflect.Value) (ret reflect.Value, err error) {
+	switch v.Kind() {
+	case reflect.String:
+		if IsSealed(v.String()) {
+			var plain string
+			if plain, err = o.unseal(v.String()); err == nil {
+				ret = reflect.New(v.Type()).Elem()
+				ret.SetString(plain)
+			}
+		}
+	case reflect.Ptr:
+		if !v.IsNil() {
+			err = o.set(v.Elem())
+		}
+	case reflect.Interface:
+		if !v.IsNil() {
+			var elem reflect.Value
+			if elem, err = o.value(v.Elem()); elem.IsValid() {
+				ret = reflect.New(v.Type()).Elem()
+				ret.Set(elem)
+			}
+		}
+	case reflect.Struct, reflect.Array:
+		target := v
+		if !v.CanAddr() {
+			target = reflect.New(v.Type()).Elem()
+			target.Set(v)
+			ret = target
+		}
+		if v.Kind() == reflect.Struct {
+			for i := 0; i < target.NumField() && err == nil; i++ {
+				if target.Type().Field(i).IsExported() {
+					err = o.set(target.Field(i))
+				}
+			}
+		} else {
+			for i := 0; i < target.Len() && err == nil; i++ {
+				err = o.set(target.Index(i))
+			}
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len() && err == nil; i++ {
+			err = o.set(v.Index(i))
+		}
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() && err == nil {
+			var elem reflect.Value
+			if elem, err = o.value(iter.Value()); elem.IsValid() {
+				v.SetMapIndex(iter.Key(), elem)
+			}
+		}
+	}
+	return
+}
+
+func (o *unsealer) set(v reflect.Value) (err error) {
+	var value reflect.Value
+	if value, err = o.value(v); value.IsValid() && v.CanSet() {
+		v.Set(value)
+	}
+	return
+}
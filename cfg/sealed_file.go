@@ -0,0 +1,135 @@
+package cfg
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/go-ee/utils/eio"
+	"github.com/go-ee/utils/encrypt"
+	"gopkg.in/yaml.v3"
+)
+
+// SealFile seals the values of the paths of the YAML file in place, the values of already sealed paths are kept.
+// A path is the dot separated keys, "*" matches all keys of a mapping or items of a sequence,
+// e.g. "sender.smtp.password" or "access.*.password". It returns the count of the sealed values.
+func SealFile(file string, paths []string, encryptor *encrypt.Encryptor) (ret int, err error) {
+	err = updateYamlFile(file, func(root *yaml.Node) (err error) {
+		for _, path := range paths {
+			err = walkYamlPath(root, strings.Split(path, "."), func(node *yaml.Node) (err error) {
+				if !IsSealed(node.Value) {
+					if node.Value, err = Seal(node.Value, encryptor); err == nil {
+						node.Tag, node.Style = "!!str", 0
+						ret++
+					}
+				}
+				return
+			})
+			if err != nil {
+				break
+			}
+		}
+		return
+	})
+	return
+}
+
+// UnsealFile replaces all sealed values of the YAML file in place by their decrypted values.
+// It returns the count of the unsealed values.
+func UnsealFile(file string, encryptor *encrypt.Encryptor) (ret int, err error) {
+	err = updateYamlFile(file, func(root *yaml.Node) error {
+		return walkYamlScalars(root, func(node *yaml.Node) (err error) {
+			if IsSealed(node.Value) {
+				// sealed values are strings, so that e.g. "123" is quoted again
+				if node.Value, err = Unseal(node.Value, encryptor); err == nil {
+					node.Tag, node.Style = "!!str", 0
+					ret++
+				}
+			}
+			return
+		})
+	})
+	return
+}
+
+func updateYamlFile(file string, update func(root *yaml.Node) error) (err error) {
+	if !strings.HasSuffix(file, ".yaml") && !strings.HasSuffix(file, ".yml") {
+		return fmt.Errorf("the values of YAML files only are sealed in place, not of %v", file)
+	}
+	var info os.FileInfo
+	if info, err = os.Stat(file); err != nil {
+		return
+	}
+	var data []byte
+	if data, err = os.ReadFile(file); err != nil {
+		return
+	}
+	var root yaml.Node
+	if err = yaml.Unmarshal(data, &root); err != nil {
+		return
+	}
+	if err = update(&root); err != nil {
+		return
+	}
+
+	var buffer bytes.Buffer
+	encoder := yaml.NewEncoder(&buffer)
+	encoder.SetIndent(2)
+	if err = encoder.Encode(&root); err != nil {
+		return
+	}
+	if err = encoder.Close(); err == nil {
+		err = eio.WriteFileAtomic(file, buffer.Bytes(), info.Mode().Perm())
+	}
+	return
+}
+
+func walkYamlPath(node *yaml.Node, path []string, found func(node *yaml.Node) error) (err error) {
+	if node.Kind == yaml.DocumentNode {
+		for _, item := range node.Content {
+			if err = walkYamlPath(item, path, found); err != nil {
+				break
+			}
+		}
+		return
+	}
+	if len(path) == 0 {
+		if node.Kind == yaml.ScalarNode {
+			err = found(node)
+		}
+		return
+	}
+
+	key := path[0]
+	switch node.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content) && err == nil; i += 2 {
+			if key == "*" || node.Content[i].Value == key {
+				err = walkYamlPath(node.Content[i+1], path[1:], found)
+			}
+		}
+	case yaml.SequenceNode:
+		for i, item := range node.Content {
+			if key == "*" || key == strconv.Itoa(i) {
+				if err = walkYamlPath(item, path[1:], found); err != nil {
+					break
+				}
+			}
+		}
+	}
+	return
+}
+
+func walkYamlScalars(node *yaml.Node, found func(node *yaml.Node) error) (err error) {
+	if node.Kind == yaml.ScalarNode {
+		return found(node)
+	}
+	for _, item := range node.Content {
+		if err = walkYamlScalars(item, found); err != nil {
+			break
+		}
+	}
+	return
+}
@@ -0,0 +1,100 @@
+package cfg
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-ee/utils/encrypt"
+)
+
+type sealedAccess struct {
+	User     string `yaml:"user"`
+	Password string `yaml:"password"`
+}
+
+type sealedConfig struct {
+	SMTP struct {
+		Password string `yaml:"password"`
+		Port     int    `yaml:"port"`
+	} `yaml:"smtp"`
+	Access map[string]sealedAccess `yaml:"access"`
+	Tokens []interface{}           `yaml:"tokens"`
+}
+
+func useTestMasterKey(t *testing.T) *encrypt.Encryptor {
+	t.Helper()
+	encryptor, err := encrypt.NewEncryptorKDF("master", encrypt.Argon2idKDF(1, 64, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := MasterKey
+	MasterKey = func() (*encrypt.Encryptor, error) { return encryptor, nil }
+	t.Cleanup(func() { MasterKey = previous })
+	return encryptor
+}
+
+func TestUnmarshalSealedValues(t *testing.T) {
+	encryptor := useTestMasterKey(t)
+	password, _ := Seal("smtp secret", encryptor)
+	access, _ := Seal("access secret", encryptor)
+	token, _ := Seal("token", encryptor)
+	fileName := filepath.Join(t.TempDir(), "config.yml")
+	data := "smtp:\n  password: " + password + "\n  port: 465\n" +
+		"access:\n  admin:\n    user: admin\n    password: " + access + "\n" +
+		"tokens:\n  - " + token + "\n"
+	if err := os.WriteFile(fileName, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	var config sealedConfig
+	if err := UnmarshalFile(&config, fileName); err != nil {
+		t.Fatal(err)
+	}
+	if config.SMTP.Password != "smtp secret" || config.Access["admin"].Password != "access secret" ||
+		config.Tokens[0] != "token" {
+		t.Fatalf("expected unsealed values, got %+v", config)
+	}
+
+	MasterKey = func() (*encrypt.Encryptor, error) { return nil, ErrNoMasterKey }
+	if err := UnmarshalFile(&sealedConfig{}, fileName); !errors.Is(err, ErrNoMasterKey) {
+		t.Fatalf("expected no master key, got %v", err)
+	}
+}
+
+func TestSealFileInPlace(t *testing.T) {
+	encryptor := useTestMasterKey(t)
+	fileName := filepath.Join(t.TempDir(), "security.yml")
+	data := "# the accounts\naccess:\n  admin:\n    user: admin\n    password: \"123\"\n  guest:\n    user: guest\n" +
+		"    password: guest secret\n"
+	if err := os.WriteFile(fileName, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if count, err := SealFile(fileName, []string{"access.*.password"}, encryptor); err != nil || count != 2 {
+		t.Fatalf("expected 2 sealed values, got %v, %v", count, err)
+	}
+	sealed, _ := os.ReadFile(fileName)
+	if strings.Contains(string(sealed), "guest secret") || !strings.Contains(string(sealed), "# the accounts") {
+		t.Fatalf("expected sealed passwords, got %s", sealed)
+	}
+	if count, _ := SealFile(fileName, []string{"access.*.password"}, encryptor); count != 0 {
+		t.Fatalf("expected the sealed values kept, got %v sealed", count)
+	}
+
+	var config sealedConfig
+	if err := UnmarshalFile(&config, fileName); err != nil || config.Access["guest"].Password != "guest secret" ||
+		config.Access["admin"].User != "admin" {
+		t.Fatalf("expected unsealed values, got %+v, %v", config, err)
+	}
+
+	if count, err := UnsealFile(fileName, encryptor); err != nil || count != 2 {
+		t.Fatalf("expected 2 unsealed values, got %v, %v", count, err)
+	}
+	unsealed, _ := os.ReadFile(fileName)
+	if !strings.Contains(string(unsealed), "password: guest secret") || !strings.Contains(string(unsealed), `password: "123"`) {
+		t.Fatalf("expected plain passwords, got %s", unsealed)
+	}
+}
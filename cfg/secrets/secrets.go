@@ -0,0 +1,116 @@
+// Package secrets provides the commands to seal and unseal the values of config files in place, see cfg.Seal.
+package secrets
+
+import (
+	"fmt"
+
+	"github.com/go-ee/utils/cfg"
+	"github.com/go-ee/utils/cliu"
+	"github.com/go-ee/utils/encrypt"
+	"github.com/go-ee/utils/lg"
+	"github.com/urfave/cli/v2"
+)
+
+// SecretsCmd is the "secrets" command with the seal and unseal sub commands.
+type SecretsCmd struct {
+	*cliu.BaseCommand
+	MasterKey     *cliu.StringFlag
+	MasterKeyFile *cliu.StringFlag
+	File          *cliu.StringFlag
+	Value         *cliu.StringFlag
+}
+
+func NewSecretsCmd(common *cliu.CommonFlags) (ret *SecretsCmd) {
+	ret = &SecretsCmd{
+		MasterKey: cliu.NewStringFlag(&cli.StringFlag{
+			Name:    "masterKey",
+			Usage:   "The passphrase of the sealed values",
+			EnvVars: []string{cfg.MasterKeyEnv},
+		}),
+		MasterKeyFile: cliu.NewStringFlag(&cli.StringFlag{
+			Name:    "masterKeyFile",
+			Usage:   "The file with the passphrase of the sealed values",
+			EnvVars: []string{cfg.MasterKeyFileEnv},
+		}),
+		File: cliu.NewStringFlag(&cli.StringFlag{
+			Name:  "file",
+			Usage: "The YAML config file, which is updated in place",
+		}),
+		Value: cliu.NewStringFlag(&cli.StringFlag{
+			Name:  "value",
+			Usage: "The value to seal or unseal, instead of the values of a file",
+		}),
+	}
+
+	ret.BaseCommand = cliu.NewBaseCommand(common, &cli.Command{
+		Name:  "secrets",
+		Usage: "Seal and unseal the values of config files",
+		Flags: []cli.Flag{ret.MasterKey, ret.MasterKeyFile},
+	},
+		ret.newSealCmd(common),
+		ret.newUnsealCmd(common))
+	return
+}
+
+func (o *SecretsCmd) newSealCmd(common *cliu.CommonFlags) *cliu.BaseCommand {
+	paths := &cli.StringSliceFlag{
+		Name:  "path",
+		Usage: "The dot separated keys of the values to seal, '*' matches all keys, e.g. access.*.password",
+	}
+	return cliu.NewBaseCommand(common, &cli.Command{
+		Name:  "seal",
+		Usage: "Seal the values of the paths of the file in place, or the value",
+		Flags: []cli.Flag{o.File, paths, o.Value},
+		Action: func(c *cli.Context) (err error) {
+			var encryptor *encrypt.Encryptor
+			if encryptor, err = o.encryptor(); err != nil {
+				return
+			}
+			if o.File.CurrentValue == "" {
+				var sealed string
+				if sealed, err = cfg.Seal(o.Value.CurrentValue, encryptor); err == nil {
+					fmt.Fprintln(c.App.Writer, sealed)
+				}
+				return
+			}
+			if len(c.StringSlice(paths.Name)) == 0 {
+				return fmt.Errorf("the paths of the values to seal are required")
+			}
+			var count int
+			if count, err = cfg.SealFile(o.File.CurrentValue, c.StringSlice(paths.Name), encryptor); err == nil {
+				lg.LOG.Infof("sealed %v values of %v", count, o.File.CurrentValue)
+			}
+			return
+		},
+	})
+}
+
+func (o *SecretsCmd) newUnsealCmd(common *cliu.CommonFlags) *cliu.BaseCommand {
+	return cliu.NewBaseCommand(common, &cli.Command{
+		Name:  "unseal",
+		Usage: "Unseal all sealed values of the file in place, or the value",
+		Flags: []cli.Flag{o.File, o.Value},
+		Action: func(c *cli.Context) (err error) {
+			var encryptor *encrypt.Encryptor
+			if encryptor, err = o.encryptor(); err != nil {
+				return
+			}
+			if o.File.CurrentValue == "" {
+				var plain string
+				if plain, err = cfg.Unseal(o.Value.CurrentValue, encryptor); err == nil {
+					fmt.Fprintln(c.App.Writer, plain)
+				}
+				return
+			}
+			var count int
+			if count, err = cfg.UnsealFile(o.File.CurrentValue, encryptor); err == nil {
+				lg.LOG.Infof("unsealed %v values of %v", count, o.File.CurrentValue)
+			}
+			return
+		},
+	})
+}
+
+func (o *SecretsCmd) encryptor() (*encrypt.Encryptor, error) {
+	return cfg.LoadMasterKey(o.MasterKey.CurrentValue, o.MasterKeyFile.CurrentValue)
+}
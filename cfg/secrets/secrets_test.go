@@ -0,0 +1,61 @@
+package secrets
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-ee/utils/cfg"
+	"github.com/go-ee/utils/cliu"
+	"github.com/urfave/cli/v2"
+)
+
+func runApp(t *testing.T, args ...string) (output string, err error) {
+	var buffer bytes.Buffer
+	app := &cli.App{
+		Name:     "test",
+		Writer:   &buffer,
+		Commands: []*cli.Command{NewSecretsCmd(cliu.NewCommonFlags()).Command},
+	}
+	err = app.Run(append([]string{"test", "secrets", "--masterKey", "master"}, args...))
+	return buffer.String(), err
+}
+
+func TestSealUnsealFile(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "security.yml")
+	data := "access:\n  admin:\n    user: admin\n    password: admin secret\n"
+	if err := os.WriteFile(fileName, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := runApp(t, "seal", "--file", fileName, "--path", "access.*.password"); err != nil {
+		t.Fatal(err)
+	}
+	sealed, _ := os.ReadFile(fileName)
+	if strings.Contains(string(sealed), "admin secret") || !strings.Contains(string(sealed), "user: admin") {
+		t.Fatalf("expected the sealed password, got %s", sealed)
+	}
+
+	if _, err := runApp(t, "unseal", "--file", fileName); err != nil {
+		t.Fatal(err)
+	}
+	if unsealed, _ := os.ReadFile(fileName); string(unsealed) != data {
+		t.Fatalf("expected the original file, got %s", unsealed)
+	}
+}
+
+func TestSealUnsealValue(t *testing.T) {
+	output, err := runApp(t, "seal", "--value", "secret")
+	sealed := strings.TrimSpace(output)
+	if err != nil || !cfg.IsSealed(sealed) {
+		t.Fatalf("expected a sealed value, got %q, %v", output, err)
+	}
+	if output, err = runApp(t, "unseal", "--value", sealed); err != nil || strings.TrimSpace(output) != "secret" {
+		t.Fatalf("expected the value, got %q, %v", output, err)
+	}
+	if _, err = runApp(t, "seal", "--file", filepath.Join(t.TempDir(), "security.yml")); err == nil {
+		t.Fatal("expected an error without paths")
+	}
+}
@@ -11,6 +11,23 @@ type BaseCommand struct {
 	Parent      *BaseCommand
 }
 
+// NewBaseCommand creates the command with the sub commands, all of them init the logger by the common flags
+// before their actions.
+func NewBaseCommand(common *CommonFlags, command *cli.Command, subCommands ...*BaseCommand) (ret *BaseCommand) {
+	ret = &BaseCommand{Command: command, SubCommands: subCommands}
+	if common != nil && command.Before == nil {
+		command.Before = func(c *cli.Context) (err error) {
+			common.beforeCmd(c)
+			return
+		}
+	}
+	for _, subCommand := range subCommands {
+		subCommand.Parent = ret
+		command.Subcommands = append(command.Subcommands, subCommand.Command)
+	}
+	return
+}
+
 type CommonFlags struct {
 	Debug *BoolFlag
 }
@@ -0,0 +1,60 @@
+package crypt
+
+import (
+	"crypto/subtle"
+	"fmt"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// Argon2idHasher hashes by argon2id in the PHC string format, e.g. "$argon2id$v=19$m=65536,t=3,p=4$<salt>$<hash>".
+type Argon2idHasher struct {
+	// Time is the count of the passes over the memory.
+	Time uint32
+	// Memory in KiB.
+	Memory     uint32
+	Threads    uint8
+	KeyLength  uint32
+	SaltLength int
+}
+
+// NewArgon2idHasher creates the hasher with the parameters recommended by RFC 9106 for constrained memory.
+func NewArgon2idHasher() *Argon2idHasher {
+	return &Argon2idHasher{Time: 3, Memory: 64 * 1024, Threads: 4, KeyLength: 32, SaltLength: 16}
+}
+
+func (o *Argon2idHasher) Algorithm(id string) bool {
+	return id == "argon2id"
+}
+
+func (o *Argon2idHasher) Hash(password string) (ret string, err error) {
+	var salt []byte
+	if salt, err = newSalt(o.SaltLength); err != nil {
+		return
+	}
+	phc := &phcHash{id: "argon2id", version: argon2.Version, salt: salt,
+		hash: argon2.IDKey([]byte(password), salt, o.Time, o.Memory, o.Threads, o.KeyLength)}
+	ret = phc.String(fmt.Sprintf("m=%d,t=%d,p=%d", o.Memory, o.Time, o.Threads))
+	return
+}
+
+func (o *Argon2idHasher) Verify(password string, hash string) (ok bool, rehash bool, err error) {
+	var phc *phcHash
+	if phc, err = parsePHC(hash); err != nil {
+		return
+	}
+	memory, time, threads := phc.params["m"], phc.params["t"], phc.params["p"]
+	if !o.Algorithm(phc.id) || phc.version != argon2.Version ||
+		memory <= 0 || time <= 0 || threads <= 0 || threads > 255 || len(phc.hash) == 0 {
+		err = ErrInvalidHash
+		return
+	}
+
+	key := argon2.IDKey([]byte(password), phc.salt, uint32(time), uint32(memory), uint8(threads),
+		uint32(len(phc.hash)))
+	if ok = subtle.ConstantTimeCompare(key, phc.hash) == 1; ok {
+		rehash = uint32(memory) != o.Memory || uint32(time) != o.Time || uint8(threads) != o.Threads ||
+			uint32(len(phc.hash)) != o.KeyLength || len(phc.salt) != o.SaltLength
+	}
+	return
+}
@@ -0,0 +1,43 @@
+package crypt
+
+import (
+	"errors"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// BcryptHasher hashes in the bcrypt format, e.g. "$2a$10$...", which is verified by most systems.
+type BcryptHasher struct {
+	Cost int
+}
+
+func NewBcryptHasher(cost int) *BcryptHasher {
+	return &BcryptHasher{Cost: cost}
+}
+
+func (o *BcryptHasher) Algorithm(id string) bool {
+	return id == "2a" || id == "2b" || id == "2y"
+}
+
+func (o *BcryptHasher) Hash(password string) (ret string, err error) {
+	var hashed []byte
+	if hashed, err = bcrypt.GenerateFromPassword([]byte(password), o.Cost); err == nil {
+		ret = string(hashed)
+	}
+	return
+}
+
+func (o *BcryptHasher) Verify(password string, hash string) (ok bool, rehash bool, err error) {
+	if err = bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)); err != nil {
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			err = nil
+		}
+		return
+	}
+	ok = true
+	var cost int
+	if cost, err = bcrypt.Cost([]byte(hash)); err == nil {
+		rehash = cost != o.Cost
+	}
+	return
+}
@@ -2,15 +2,15 @@ package crypt
 
 import "golang.org/x/crypto/bcrypt"
 
+// DefaultHasher is used by Hash and HashAndEquals, it hashes by bcrypt and verifies also argon2id and scrypt hashes.
+// Set it to a Policy with another Current hasher to migrate the hashes.
+var DefaultHasher Hasher = NewPolicy(NewBcryptHasher(bcrypt.DefaultCost), NewArgon2idHasher(), NewScryptHasher())
+
 func Hash(str string) (ret string, err error) {
-	var encrypted []byte
-	if encrypted, err = bcrypt.GenerateFromPassword([]byte(str), bcrypt.DefaultCost); err == nil {
-		ret = string(encrypted)
-	}
-	return
+	return DefaultHasher.Hash(str)
 }
 
 func HashAndEquals(str string, hashed string) (ret bool) {
-	err := bcrypt.CompareHashAndPassword([]byte(hashed), []byte(str))
-	return err == nil
+	ret, _, _ = DefaultHasher.Verify(str, hashed)
+	return
 }
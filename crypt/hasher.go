@@ -0,0 +1,144 @@
+package crypt
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrInvalidHash is returned for hashes, which can't be parsed.
+	ErrInvalidHash = errors.New("invalid password hash")
+	// ErrUnknownAlgorithm is returned for hashes of algorithms, which are not accepted by the Policy.
+	ErrUnknownAlgorithm = errors.New("unknown password hash algorithm")
+)
+
+// Hasher hashes passwords to strings with the algorithm, its parameters and the salt,
+// in the PHC string format or the bcrypt format.
+type Hasher interface {
+	// Algorithm returns whether the hasher verifies hashes of the algorithm id, e.g. "argon2id".
+	Algorithm(id string) bool
+	Hash(password string) (ret string, err error)
+	// Verify returns whether the password matches the hash and whether the hash should be rehashed,
+	// because it was not created with the current parameters of the hasher.
+	Verify(password string, hash string) (ok bool, rehash bool, err error)
+}
+
+// Policy hashes by the Current hasher and verifies the hashes of the accepted hashers,
+// the hashes of other hashers than Current should be rehashed.
+type Policy struct {
+	Current  Hasher
+	Accepted []Hasher
+}
+
+func NewPolicy(current Hasher, accepted ...Hasher) *Policy {
+	return &Policy{Current: current, Accepted: accepted}
+}
+
+func (o *Policy) Algorithm(id string) bool {
+	return o.hasher(id) != nil
+}
+
+func (o *Policy) Hash(password string) (ret string, err error) {
+	return o.Current.Hash(password)
+}
+
+func (o *Policy) Verify(password string, hash string) (ok bool, rehash bool, err error) {
+	id := algorithmID(hash)
+	hasher := o.hasher(id)
+	if hasher == nil {
+		err = fmt.Errorf("%w: %q", ErrUnknownAlgorithm, id)
+		return
+	}
+	if ok, rehash, err = hasher.Verify(password, hash); ok && hasher != o.Current {
+		rehash = true
+	}
+	return
+}
+
+func (o *Policy) hasher(id string) Hasher {
+	if o.Current.Algorithm(id) {
+		return o.Current
+	}
+	for _, hasher := range o.Accepted {
+		if hasher.Algorithm(id) {
+			return hasher
+		}
+	}
+	return nil
+}
+
+// algorithmID returns the id of the hash, e.g. "argon2id" of "$argon2id$v=19$...".
+func algorithmID(hash string) string {
+	if parts := strings.SplitN(hash, "$", 3); len(parts) == 3 && parts[0] == "" {
+		return parts[1]
+	}
+	return ""
+}
+
+// phcHash is a hash in the PHC string format: $<id>[$v=<version>][$<param>=<value>(,<param>=<value>)*]$<salt>$<hash>,
+// the salt and the hash are base64 encoded without padding.
+type phcHash struct {
+	id      string
+	version int
+	params  map[string]int
+	salt    []byte
+	hash    []byte
+}
+
+func parsePHC(value string) (ret *phcHash, err error) {
+	parts := strings.Split(value, "$")
+	if len(parts) < 4 || parts[0] != "" {
+		return nil, ErrInvalidHash
+	}
+	ret = &phcHash{id: parts[1], params: map[string]int{}}
+	fields := parts[2 : len(parts)-2]
+	if len(fields) > 0 && strings.HasPrefix(fields[0], "v=") {
+		if ret.version, err = strconv.Atoi(fields[0][2:]); err != nil {
+			return nil, ErrInvalidHash
+		}
+		fields = fields[1:]
+	}
+	if len(fields) > 1 {
+		return nil, ErrInvalidHash
+	}
+	if len(fields) == 1 {
+		for _, param := range strings.Split(fields[0], ",") {
+			name, number, found := strings.Cut(param, "=")
+			if !found {
+				return nil, ErrInvalidHash
+			}
+			if ret.params[name], err = strconv.Atoi(number); err != nil {
+				return nil, ErrInvalidHash
+			}
+		}
+	}
+	if ret.salt, err = base64.RawStdEncoding.DecodeString(parts[len(parts)-2]); err != nil {
+		return nil, ErrInvalidHash
+	}
+	if ret.hash, err = base64.RawStdEncoding.DecodeString(parts[len(parts)-1]); err != nil {
+		return nil, ErrInvalidHash
+	}
+	return
+}
+
+func (o *phcHash) String(params string) string {
+	var builder strings.Builder
+	builder.WriteString("$" + o.id)
+	if o.version > 0 {
+		builder.WriteString("$v=" + strconv.Itoa(o.version))
+	}
+	builder.WriteString("$" + params)
+	builder.WriteString("$" + base64.RawStdEncoding.EncodeToString(o.salt))
+	builder.WriteString("$" + base64.RawStdEncoding.EncodeToString(o.hash))
+	return builder.String()
+}
+
+func newSalt(length int) (ret []byte, err error) {
+	ret = make([]byte, length)
+	_, err = rand.Read(ret)
+	return
+}
@@ -0,0 +1,62 @@
+package crypt
+
+import (
+	"errors"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func newTestHashers() []Hasher {
+	return []Hasher{
+		NewBcryptHasher(bcrypt.MinCost),
+		&Argon2idHasher{Time: 1, Memory: 64, Threads: 1, KeyLength: 32, SaltLength: 16},
+		&ScryptHasher{LogN: 4, R: 8, P: 1, KeyLength: 32, SaltLength: 16},
+	}
+}
+
+func TestHashers(t *testing.T) {
+	for _, hasher := range newTestHashers() {
+		hash, err := hasher.Hash("secret")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok, rehash, err := hasher.Verify("secret", hash); !ok || rehash || err != nil {
+			t.Fatalf("%v: expected match without rehash, got %v, %v, %v", hash, ok, rehash, err)
+		}
+		if ok, _, err := hasher.Verify("other", hash); ok || err != nil {
+			t.Fatalf("%v: expected mismatch, got %v, %v", hash, ok, err)
+		}
+	}
+}
+
+func TestHasherRehashOnChangedParameters(t *testing.T) {
+	hasher := &Argon2idHasher{Time: 1, Memory: 64, Threads: 1, KeyLength: 32, SaltLength: 16}
+	hash, _ := hasher.Hash("secret")
+	hasher.Time = 2
+	if ok, rehash, err := hasher.Verify("secret", hash); !ok || !rehash || err != nil {
+		t.Fatalf("expected rehash, got %v, %v, %v", ok, rehash, err)
+	}
+}
+
+func TestPolicy(t *testing.T) {
+	hashers := newTestHashers()
+	legacy, _ := hashers[0].Hash("secret")
+	policy := NewPolicy(hashers[1], hashers[0])
+
+	if ok, rehash, err := policy.Verify("secret", legacy); !ok || !rehash || err != nil {
+		t.Fatalf("expected rehash of the bcrypt hash, got %v, %v, %v", ok, rehash, err)
+	}
+	current, _ := policy.Hash("secret")
+	if ok, rehash, err := policy.Verify("secret", current); !ok || rehash || err != nil {
+		t.Fatalf("expected match without rehash, got %v, %v, %v", ok, rehash, err)
+	}
+
+	scryptHash, _ := hashers[2].Hash("secret")
+	if _, _, err := policy.Verify("secret", scryptHash); !errors.Is(err, ErrUnknownAlgorithm) {
+		t.Fatalf("expected unknown algorithm, got %v", err)
+	}
+	if _, _, err := policy.Verify("secret", "$argon2id$v=19$m=64$broken"); !errors.Is(err, ErrInvalidHash) {
+		t.Fatalf("expected invalid hash, got %v", err)
+	}
+}
@@ -0,0 +1,60 @@
+package crypt
+
+import (
+	"crypto/subtle"
+	"fmt"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// ScryptHasher hashes by scrypt in the PHC string format, e.g. "$scrypt$ln=15,r=8,p=1$<salt>$<hash>",
+// ln is the base 2 logarithm of the cost N.
+type ScryptHasher struct {
+	LogN       int
+	R          int
+	P          int
+	KeyLength  int
+	SaltLength int
+}
+
+func NewScryptHasher() *ScryptHasher {
+	return &ScryptHasher{LogN: 15, R: 8, P: 1, KeyLength: 32, SaltLength: 16}
+}
+
+func (o *ScryptHasher) Algorithm(id string) bool {
+	return id == "scrypt"
+}
+
+func (o *ScryptHasher) Hash(password string) (ret string, err error) {
+	var salt []byte
+	if salt, err = newSalt(o.SaltLength); err != nil {
+		return
+	}
+	phc := &phcHash{id: "scrypt", salt: salt}
+	if phc.hash, err = scrypt.Key([]byte(password), salt, 1<<o.LogN, o.R, o.P, o.KeyLength); err == nil {
+		ret = phc.String(fmt.Sprintf("ln=%d,r=%d,p=%d", o.LogN, o.R, o.P))
+	}
+	return
+}
+
+func (o *ScryptHasher) Verify(password string, hash string) (ok bool, rehash bool, err error) {
+	var phc *phcHash
+	if phc, err = parsePHC(hash); err != nil {
+		return
+	}
+	logN, r, p := phc.params["ln"], phc.params["r"], phc.params["p"]
+	if !o.Algorithm(phc.id) || logN <= 0 || logN > 30 || len(phc.hash) == 0 {
+		err = ErrInvalidHash
+		return
+	}
+
+	var key []byte
+	if key, err = scrypt.Key([]byte(password), phc.salt, 1<<logN, r, p, len(phc.hash)); err != nil {
+		err = fmt.Errorf("%w: %v", ErrInvalidHash, err)
+		return
+	}
+	if ok = subtle.ConstantTimeCompare(key, phc.hash) == 1; ok {
+		rehash = logN != o.LogN || r != o.R || p != o.P || len(phc.hash) != o.KeyLength || len(phc.salt) != o.SaltLength
+	}
+	return
+}
@@ -51,6 +51,9 @@ type Base struct {
 	Jwt    *net.JwtController
 	Secure bool
 
+	// Outbox dispatches the saved events to the event bus, started by StartServer after the setup of the handlers.
+	Outbox Outbox
+
 	notFoundMessage string
 }
 
@@ -70,7 +73,17 @@ func NewAppBase(appInfo *Info, serverConfig *ServerConfig, secure bool, middlewa
 	return
 }
 
+type Outbox interface {
+	Start()
+	Close() error
+}
+
 func (o *Base) StartServer() (err error) {
+	if o.Outbox != nil {
+		o.Outbox.Start()
+		defer o.Outbox.Close()
+	}
+
 	o.Router.NotFoundHandler = http.HandlerFunc(o.NoFound)
 	if o.Secure {
 		o.Router.Path("/logout").Name("Logout").Handler(o.Jwt.LogoutHandler())
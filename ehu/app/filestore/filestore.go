@@ -7,17 +7,20 @@ import (
 	repo "github.com/go-ee/utils/ehu/filestore"
 	"github.com/looplab/eventhorizon"
 	"github.com/looplab/eventhorizon/commandhandler/bus"
-	eb "github.com/looplab/eventhorizon/eventbus/local"
 	"path/filepath"
 )
 
 func NewAppFileStore(appInfo *app.Info, serverConfig *app.ServerConfig, secure bool, storeFolder string) *app.Base {
 
 	// Create the event store.
-	eventStore := es.NewEventStore(filepath.Join(storeFolder, "eventstore"))
+	eventStore := es.NewEventStore(filepath.Join(storeFolder, es.EventStoreFolder))
 
-	// Create the event bus that distributes events.
-	eventBus := eb.NewEventBus(nil)
+	// Create the snapshot store, used by aggregate engines with a snapshot strategy.
+	snapshotStore := es.NewSnapshotStore(filepath.Join(storeFolder, es.SnapshotStoreFolder))
+
+	// Create the event bus that distributes events, synchronously, so that the outbox acknowledges
+	// the events after the projections handled them.
+	eventBus := ehu.NewSyncEventBus()
 
 	// Create the command bus.
 	commandBus := bus.NewCommandHandler()
@@ -26,7 +29,7 @@ func NewAppFileStore(appInfo *app.Info, serverConfig *app.ServerConfig, secure b
 	reposFactory := func(name string, factory func() eventhorizon.Entity) (ret eventhorizon.ReadWriteRepo, err error) {
 		if item, ok := repos[name]; !ok {
 			var repoInst *repo.Repo
-			if repoInst, err = repo.NewRepo(filepath.Join(storeFolder, "repos")); err == nil {
+			if repoInst, err = repo.NewRepo(filepath.Join(storeFolder, repo.ReposFolder)); err == nil {
 				repoInst.SetEntityFactory(factory)
 				ret = repoInst
 			}
@@ -36,11 +39,16 @@ func NewAppFileStore(appInfo *app.Info, serverConfig *app.ServerConfig, secure b
 		}
 		return
 	}
-	return app.NewAppBase(appInfo, serverConfig, secure,
+	ret := app.NewAppBase(appInfo, serverConfig, secure,
 		&ehu.Middleware{
-			EventStore: eventStore,
-			EventBus:   eventBus,
-			CommandBus: commandBus,
-			Repos:      reposFactory,
+			EventStore:    eventStore,
+			SnapshotStore: snapshotStore,
+			EventBus:      eventBus,
+			CommandBus:    commandBus,
+			Repos:         reposFactory,
 		})
+
+	// Dispatch the saved events to the event bus, also the events not published before a crash.
+	ret.Outbox = es.NewOutbox(eventStore, eventBus)
+	return ret
 }
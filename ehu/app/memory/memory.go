@@ -11,8 +11,9 @@ import (
 )
 
 func NewAppMemory(appInfo *app.Info, serverConfig *app.ServerConfig, secure bool) *app.Base {
-	// Create the event store.
-	eventStore, _ := es.NewEventStore()
+	// Create the event store, tracking the aggregates for the rebuild of projections.
+	memoryStore, _ := es.NewEventStore()
+	eventStore := ehu.NewAggregateTracker(memoryStore)
 
 	// Create the event bus that distributes events.
 	eventBus := eb.NewEventBus(nil)
@@ -0,0 +1,83 @@
+package mongo
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/looplab/eventhorizon"
+	es "github.com/looplab/eventhorizon/eventstore/mongodb_v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// eventsCollection is the collection of the events of the mongodb_v2 event store.
+const eventsCollection = "events"
+
+// EventStore is the mongodb_v2 event store, which lists the ids of the stored aggregates of a type
+// for the rebuild of projections, see ehu.AggregateLister.
+type EventStore struct {
+	*es.EventStore
+	client *mongo.Client
+	events *mongo.Collection
+}
+
+// NewEventStore connects to the MongoDB of the URI and creates the event store in the database.
+func NewEventStore(uri, dbName string) (ret *EventStore, err error) {
+	var client *mongo.Client
+	if client, err = mongo.Connect(context.Background(), options.Client().ApplyURI(uri)); err != nil {
+		return
+	}
+	var eventStore *es.EventStore
+	if eventStore, err = es.NewEventStoreWithClient(client, dbName); err != nil {
+		_ = client.Disconnect(context.Background())
+		return
+	}
+	ret = &EventStore{
+		EventStore: eventStore,
+		client:     client,
+		events:     client.Database(dbName).Collection(eventsCollection),
+	}
+	return
+}
+
+// AggregateIDs returns the ids of the aggregates of the type, in the order of their first events.
+func (o *EventStore) AggregateIDs(ctx context.Context, aggregateType eventhorizon.AggregateType) (
+	ret []uuid.UUID, err error) {
+
+	var cursor *mongo.Cursor
+	if cursor, err = o.events.Find(ctx, aggregateFilter(aggregateType),
+		options.Find().SetSort(bson.M{"_id": 1}).SetProjection(bson.M{"aggregate_id": 1})); err != nil {
+		return
+	}
+	ret, err = decodeAggregateIDs(ctx, cursor)
+	return
+}
+
+func (o *EventStore) Close() (err error) {
+	if err = o.EventStore.Close(); err == nil {
+		err = o.client.Disconnect(context.Background())
+	}
+	return
+}
+
+// aggregateFilter matches the first events of the aggregates of the type.
+func aggregateFilter(aggregateType eventhorizon.AggregateType) bson.M {
+	return bson.M{"aggregate_type": aggregateType, "version": 1}
+}
+
+func decodeAggregateIDs(ctx context.Context, cursor *mongo.Cursor) (ret []uuid.UUID, err error) {
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var item struct {
+			AggregateID uuid.UUID `bson:"aggregate_id"`
+		}
+		if err = cursor.Decode(&item); err != nil {
+			return
+		}
+		ret = append(ret, item.AggregateID)
+	}
+	err = cursor.Err()
+	return
+}
@@ -0,0 +1,33 @@
+package mongo
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-ee/utils/ehu"
+	"github.com/google/uuid"
+	"github.com/looplab/eventhorizon"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var _ ehu.AggregateLister = (*EventStore)(nil)
+
+func TestDecodeAggregateIDs(t *testing.T) {
+	first, second := uuid.New(), uuid.New()
+	cursor, err := mongo.NewCursorFromDocuments([]interface{}{
+		bson.M{"aggregate_id": first},
+		bson.M{"aggregate_id": second},
+	}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ids, err := decodeAggregateIDs(context.Background(), cursor)
+	if err != nil || len(ids) != 2 || ids[0] != first || ids[1] != second {
+		t.Fatalf("expected the aggregate ids in the order of the events, got %v, %v", ids, err)
+	}
+	if filter := aggregateFilter("Counter"); filter["aggregate_type"] != eventhorizon.AggregateType("Counter") || filter["version"] != 1 {
+		t.Fatalf("expected the first events of the aggregate type, got %v", filter)
+	}
+}
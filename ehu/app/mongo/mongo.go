@@ -6,14 +6,13 @@ import (
 	"github.com/looplab/eventhorizon"
 	"github.com/looplab/eventhorizon/commandhandler/bus"
 	eb "github.com/looplab/eventhorizon/eventbus/local"
-	es "github.com/looplab/eventhorizon/eventstore/mongodb_v2"
 	repo "github.com/looplab/eventhorizon/repo/mongodb"
 )
 
 func NewAppMongo(appInfo *app.Info, serverConfig *app.ServerConfig, secure bool, mongoUrl string) *app.Base {
-	// Create the event store.
+	// Create the event store, listing the aggregates for the rebuild of projections.
 	eventStore := &ehu.EventStoreDelegate{Factory: func() (ret eventhorizon.EventStore, err error) {
-		return es.NewEventStore("localhost", appInfo.ProductName)
+		return NewEventStore(mongoUrl, appInfo.ProductName)
 	}}
 
 	// Create the event bus that distributes events.
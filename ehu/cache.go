@@ -0,0 +1,67 @@
+package ehu
+
+import (
+	"context"
+	"sync"
+
+	"github.com/looplab/eventhorizon"
+)
+
+// KeyRemover is a cache, which removes the entry of a key, like typed.BoundedCache and typed.DiskCache.
+type KeyRemover interface {
+	Remove(key string) bool
+}
+
+// CacheInvalidator removes the entries of the aggregates of the events from the caches, e.g. cached
+// entities of projections. The key of an entry is the aggregate id, if Key is nil.
+type CacheInvalidator struct {
+	Key func(event eventhorizon.Event) string
+
+	caches []KeyRemover
+	lock   sync.RWMutex
+}
+
+func NewCacheInvalidator(caches ...KeyRemover) *CacheInvalidator {
+	return &CacheInvalidator{caches: caches}
+}
+
+// Add adds caches, also while events are handled.
+func (o *CacheInvalidator) Add(caches ...KeyRemover) {
+	o.lock.Lock()
+	o.caches = append(o.caches, caches...)
+	o.lock.Unlock()
+}
+
+// Invalidate removes the entries of the aggregate of the event.
+func (o *CacheInvalidator) Invalidate(event eventhorizon.Event) {
+	var key string
+	if o.Key != nil {
+		key = o.Key(event)
+	} else {
+		key = event.AggregateID().String()
+	}
+
+	o.lock.RLock()
+	defer o.lock.RUnlock()
+	for _, cache := range o.caches {
+		cache.Remove(key)
+	}
+}
+
+// Wrap returns the handler, which invalidates the entries after the handler handled an event successfully,
+// so that the caches don't keep entries of the state before the event.
+func (o *CacheInvalidator) Wrap(handler eventhorizon.EventHandler) eventhorizon.EventHandler {
+	return &invalidatingEventHandler{EventHandler: handler, invalidator: o}
+}
+
+type invalidatingEventHandler struct {
+	eventhorizon.EventHandler
+	invalidator *CacheInvalidator
+}
+
+func (o *invalidatingEventHandler) HandleEvent(ctx context.Context, event eventhorizon.Event) (err error) {
+	if err = o.EventHandler.HandleEvent(ctx, event); err == nil {
+		o.invalidator.Invalidate(event)
+	}
+	return
+}
@@ -0,0 +1,60 @@
+package ehu
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-ee/utils/cache/typed"
+	"github.com/google/uuid"
+	"github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/eventhandler/projector"
+	repo "github.com/looplab/eventhorizon/repo/memory"
+)
+
+type failingHandler struct{}
+
+func (o *failingHandler) HandlerType() eventhorizon.EventHandlerType {
+	return "failing"
+}
+
+func (o *failingHandler) HandleEvent(context.Context, eventhorizon.Event) error {
+	return errors.New("failed")
+}
+
+func TestCacheInvalidator(t *testing.T) {
+	ctx := context.Background()
+	counters := repo.NewRepo()
+	counters.SetEntityFactory(func() eventhorizon.Entity { return &counterEntity{} })
+	proj := NewProjector("counter", &counterProjector{}, counters)
+	handler := projector.NewEventHandler(proj, counters)
+	handler.SetEntityFactory(func() eventhorizon.Entity { return &counterEntity{} })
+
+	id, other := uuid.New(), uuid.New()
+	cache := typed.NewCache[string, int](10, typed.LRU, 0)
+	cache.Put(id.String(), 0)
+	cache.Put(other.String(), 0)
+	proj.Caches.Add(cache)
+
+	event := eventhorizon.NewEvent("Counted", nil, time.Now(), eventhorizon.ForAggregate("Counter", id, 1))
+	if err := proj.Caches.Wrap(&failingHandler{}).HandleEvent(ctx, event); err == nil {
+		t.Fatal("expected the error of the handler")
+	}
+	if _, ok := cache.Get(id.String()); !ok {
+		t.Fatal("expected the entry kept after the error of the handler")
+	}
+
+	if err := proj.Caches.Wrap(handler).HandleEvent(ctx, event); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := cache.Get(id.String()); ok {
+		t.Fatal("expected the entry of the projected aggregate invalidated")
+	}
+	if _, ok := cache.Get(other.String()); !ok {
+		t.Fatal("expected the entry of the other aggregate kept")
+	}
+	if entity, err := counters.Find(ctx, id); err != nil || entity.(*counterEntity).Count != 1 {
+		t.Fatalf("expected the projected entity, got %v, %v", entity, err)
+	}
+}
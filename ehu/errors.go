@@ -19,6 +19,16 @@ var ErrCouldNotLoadAggregate = errors.New("could not load aggregate")
 
 var ErrCouldNotSaveAggregate = errors.New("could not save aggregate")
 
+var ErrEventLogNotSupported = errors.New("event store does not support an event log")
+
+var ErrAggregateIDsNotSupported = errors.New("event store does not support the listing of the aggregate ids")
+
+var ErrCursorNotFound = errors.New("the entity of the cursor is not selected")
+
+var ErrCouldNotLoadSnapshot = errors.New("could not load snapshot")
+
+var ErrCouldNotSaveSnapshot = errors.New("could not save snapshot")
+
 type CommandError struct {
 	Err    error
 	Cmd    eh.Command
@@ -35,19 +45,19 @@ func (o CommandError) Cause() error {
 
 func NewErrCouldNotMarshalEvent(_ context.Context, err error) error {
 	return &eh.EventStoreError{
-		Err: fmt.Errorf("%v: %v", ErrCouldNotMarshalEvent, err),
+		Err: fmt.Errorf("%w: %w", ErrCouldNotMarshalEvent, err),
 	}
 }
 
 func NewErrCouldNotUnmarshalEvent(_ context.Context, err error) error {
 	return &eh.EventStoreError{
-		Err: fmt.Errorf("%v: %v", ErrCouldNotUnmarshalEvent, err),
+		Err: fmt.Errorf("%w: %w", ErrCouldNotUnmarshalEvent, err),
 	}
 }
 
 func NewErrCouldNotLoadAggregate(_ context.Context, err error) error {
 	return &eh.EventStoreError{
-		Err: fmt.Errorf("%v: %v", ErrCouldNotLoadAggregate, err),
+		Err: fmt.Errorf("%w: %w", ErrCouldNotLoadAggregate, err),
 	}
 }
 
@@ -59,6 +69,20 @@ func NewErrIncorrectEventVersion(_ context.Context) error {
 
 func NewErrCouldNotSaveAggregate(_ context.Context, err error) error {
 	return &eh.EventStoreError{
-		Err: fmt.Errorf("%v: %v", ErrCouldNotSaveAggregate, err),
+		Err: fmt.Errorf("%w: %w", ErrCouldNotSaveAggregate, err),
+	}
+}
+
+func NewErrCouldNotLoadSnapshot(_ context.Context, err error) error {
+	return &eh.EventStoreError{
+		Err: fmt.Errorf("%w: %w", ErrCouldNotLoadSnapshot, err),
+		Op:  eh.EventStoreOpLoadSnapshot,
+	}
+}
+
+func NewErrCouldNotSaveSnapshot(_ context.Context, err error) error {
+	return &eh.EventStoreError{
+		Err: fmt.Errorf("%w: %w", ErrCouldNotSaveSnapshot, err),
+		Op:  eh.EventStoreOpSaveSnapshot,
 	}
 }
@@ -0,0 +1,85 @@
+package ehu
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/looplab/eventhorizon"
+)
+
+// SyncEventBus is an event bus, which handles an event by the matching handlers synchronously, in the order
+// they were added. HandleEvent returns after all handlers finished, with their errors, so that e.g. the Outbox
+// of the filestore acknowledges an event only after it is projected. The handlers must be safe for concurrent use,
+// the events of different namespaces may be handled concurrently.
+type SyncEventBus struct {
+	handlers []*syncHandler
+	errCh    chan error
+	lock     sync.RWMutex
+}
+
+type syncHandler struct {
+	matcher eventhorizon.EventMatcher
+	handler eventhorizon.EventHandler
+}
+
+func NewSyncEventBus() *SyncEventBus {
+	return &SyncEventBus{errCh: make(chan error)}
+}
+
+func (o *SyncEventBus) HandlerType() eventhorizon.EventHandlerType {
+	return "sync-eventbus"
+}
+
+// HandleEvent handles the event by all matching handlers, also after errors of handlers,
+// and returns the errors of the handlers as eventhorizon.EventBusError.
+func (o *SyncEventBus) HandleEvent(ctx context.Context, event eventhorizon.Event) (err error) {
+	o.lock.RLock()
+	handlers := o.handlers
+	o.lock.RUnlock()
+
+	var errs []error
+	for _, item := range handlers {
+		if !item.matcher.Match(event) {
+			continue
+		}
+		if handleErr := item.handler.HandleEvent(ctx, event); handleErr != nil {
+			errs = append(errs, &eventhorizon.EventBusError{Err: handleErr, Ctx: ctx, Event: event})
+		}
+	}
+	err = errors.Join(errs...)
+	return
+}
+
+func (o *SyncEventBus) AddHandler(
+	_ context.Context, matcher eventhorizon.EventMatcher, handler eventhorizon.EventHandler) (err error) {
+
+	if matcher == nil {
+		return eventhorizon.ErrMissingMatcher
+	}
+	if handler == nil {
+		return eventhorizon.ErrMissingHandler
+	}
+
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	for _, item := range o.handlers {
+		if item.handler.HandlerType() == handler.HandlerType() {
+			return eventhorizon.ErrHandlerAlreadyAdded
+		}
+	}
+	// copied on write, so that HandleEvent iterates the handlers without the lock
+	handlers := make([]*syncHandler, len(o.handlers), len(o.handlers)+1)
+	copy(handlers, o.handlers)
+	o.handlers = append(handlers, &syncHandler{matcher: matcher, handler: handler})
+	return
+}
+
+// Errors returns the channel of the asynchronous errors, there are none, the errors are returned by HandleEvent.
+func (o *SyncEventBus) Errors() <-chan error {
+	return o.errCh
+}
+
+func (o *SyncEventBus) Close() error {
+	return nil
+}
@@ -22,10 +22,11 @@ import (
 )
 
 type Middleware struct {
-	EventStore eventhorizon.EventStore
-	EventBus   eventhorizon.EventBus
-	CommandBus *bus.CommandHandler
-	Repos      func(string, func() (ret eventhorizon.Entity)) (ret eventhorizon.ReadWriteRepo, err error)
+	EventStore    eventhorizon.EventStore
+	SnapshotStore eventhorizon.SnapshotStore
+	EventBus      eventhorizon.EventBus
+	CommandBus    *bus.CommandHandler
+	Repos         func(string, func() (ret eventhorizon.Entity)) (ret eventhorizon.ReadWriteRepo, err error)
 }
 
 type AggregateEngine struct {
@@ -38,6 +39,10 @@ type AggregateEngine struct {
 	AggregateFactory func(id uuid.UUID) eventhorizon.Aggregate
 	EntityFactory    func() eventhorizon.Entity
 
+	// SnapshotStrategy switches snapshots on for the aggregate type, if the middleware provides a SnapshotStore
+	// and the aggregate implements eventhorizon.Snapshotable.
+	SnapshotStrategy eventhorizon.SnapshotStrategy
+
 	Commands []eventhorizon.CommandType
 	Events   []eventhorizon.EventType
 }
@@ -75,7 +80,14 @@ func (o *AggregateEngine) Setup() (err error) {
 func (o *AggregateEngine) registerCommands() (err error) {
 
 	var aggregateStore eventhorizon.AggregateStore
-	if aggregateStore, err = events.NewAggregateStore(o.EventStore); err != nil {
+	if o.SnapshotStrategy != nil && o.SnapshotStore != nil {
+		aggregateStore, err = events.NewAggregateStore(
+			&SnapshotEventStore{EventStore: o.EventStore, SnapshotStore: o.SnapshotStore},
+			events.WithSnapshotStrategy(o.SnapshotStrategy))
+	} else {
+		aggregateStore, err = events.NewAggregateStore(o.EventStore)
+	}
+	if err != nil {
 		return
 	}
 
@@ -101,7 +113,92 @@ func (o *AggregateEngine) RegisterProjector(projectorType string, listener Deleg
 	ret = NewProjector(projectorType, listener, repo)
 	proj := projector.NewEventHandler(ret, repo)
 	proj.SetEntityFactory(o.EntityFactory)
-	err = o.RegisterForEvents(proj, listener.EventTypes())
+	ret.Handler = proj
+	err = o.RegisterForEvents(ret.Caches.Wrap(proj), listener.EventTypes())
+	return
+}
+
+// CatchUpProjector applies the events of the projector, stored since the position in the event log,
+// e.g. after a restart. It returns the position to continue from.
+func (o *AggregateEngine) CatchUpProjector(
+	ctx context.Context, proj *ProjectorEventHandler, position int64) (next int64, err error) {
+	var handler eventhorizon.EventHandler
+	if handler, err = o.projectorHandler(proj); err == nil {
+		next, err = o.CatchUp(ctx, handler, proj.EventTypes(), position)
+	}
+	return
+}
+
+// projectorHandler returns the handler of the projector, which invalidates the caches of the projector.
+// The handler is created for the projectors, which are not registered by RegisterProjector.
+func (o *AggregateEngine) projectorHandler(proj *ProjectorEventHandler) (ret eventhorizon.EventHandler, err error) {
+	handler := proj.Handler
+	if handler == nil {
+		repo, ok := proj.Repo.(eventhorizon.ReadWriteRepo)
+		if !ok {
+			err = fmt.Errorf("repo of the projector %v is not writable", proj.ProjectorType())
+			return
+		}
+		handler = projector.NewEventHandler(proj, repo)
+		handler.SetEntityFactory(o.EntityFactory)
+	}
+	ret = handler
+	if proj.Caches != nil {
+		ret = proj.Caches.Wrap(handler)
+	}
+	return
+}
+
+// CatchUp applies the events of the aggregate type, stored since the position in the event log, to the handler.
+// It returns the position to continue from.
+func (o *AggregateEngine) CatchUp(ctx context.Context, handler eventhorizon.EventHandler,
+	events []eventhorizon.EventType, position int64) (next int64, err error) {
+
+	var eventLog EventLog
+	if eventLog, err = o.eventLog(); err != nil {
+		return
+	}
+
+	next = position
+	err = eventLog.LoadAllFrom(ctx, position, o.logHandler(ctx, handler, events, &next))
+	return
+}
+
+// Subscribe catches up the handler from the position in the event log and tails the event log
+// until the context is done.
+func (o *AggregateEngine) Subscribe(ctx context.Context, handler eventhorizon.EventHandler,
+	events []eventhorizon.EventType, position int64) (err error) {
+
+	var eventLog EventLog
+	if eventLog, err = o.eventLog(); err != nil {
+		return
+	}
+
+	next := position
+	err = eventLog.Subscribe(ctx, position, o.logHandler(ctx, handler, events, &next))
+	return
+}
+
+func (o *AggregateEngine) logHandler(ctx context.Context, handler eventhorizon.EventHandler,
+	events []eventhorizon.EventType, next *int64) func(position int64, event eventhorizon.Event) error {
+
+	matcher := eventhorizon.MatchEvents(events)
+	return func(position int64, event eventhorizon.Event) (err error) {
+		if event.AggregateType() == o.AggregateType && matcher.Match(event) {
+			if err = handler.HandleEvent(ctx, event); err != nil {
+				return
+			}
+		}
+		*next = position + 1
+		return
+	}
+}
+
+func (o *AggregateEngine) eventLog() (ret EventLog, err error) {
+	var ok bool
+	if ret, ok = o.EventStore.(EventLog); !ok {
+		err = ErrEventLogNotSupported
+	}
 	return
 }
 
@@ -246,6 +343,26 @@ func (o *HttpQueryHandler) HandleResult(
 	}
 }
 
+// HandleQuery serves count, exist and find queries of the request, by the net.QueryType parameter, for the repo.
+func (o *HttpQueryHandler) HandleQuery(ctx context.Context, repo QueryRepo, w http.ResponseWriter, r *http.Request) {
+	query, err := ParseQuery(r)
+	if err != nil {
+		o.HandleResult(nil, err, r.Method, w, r)
+		return
+	}
+
+	var ret interface{}
+	switch net.GetQueryOrFormValue(net.QueryType, r) {
+	case net.QueryTypeCount:
+		ret, err = repo.Count(ctx, query)
+	case net.QueryTypeExist:
+		ret, err = repo.Exist(ctx, query)
+	default:
+		ret, err = repo.Query(ctx, query)
+	}
+	o.HandleResult(ret, err, r.Method, w, r)
+}
+
 type HttpCommandHandler struct {
 	Context    context.Context
 	CommandBus eventhorizon.CommandHandler
@@ -283,7 +400,10 @@ func (o *HttpCommandHandler) HandleCommand(command eventhorizon.Command, w http.
 
 type ProjectorEventHandler struct {
 	DelegateEventHandler
-	Repo          eventhorizon.ReadRepo
+	Repo    eventhorizon.ReadRepo
+	Handler *projector.EventHandler
+	// Caches invalidates the cached entries of the aggregates, after the events are projected.
+	Caches        *CacheInvalidator
 	projectorType projector.Type
 }
 
@@ -292,6 +412,7 @@ func NewProjector(projectorType string, eventHandler DelegateEventHandler, repo
 		projectorType:        projector.Type(projectorType),
 		Repo:                 repo,
 		DelegateEventHandler: eventHandler,
+		Caches:               NewCacheInvalidator(),
 	}
 	return
 }
@@ -347,6 +468,20 @@ func (o *EventStoreDelegate) LoadFrom(ctx context.Context, id uuid.UUID, version
 	return
 }
 
+// AggregateIDs lists the aggregates of the type by the delegate, if it is an AggregateLister.
+func (o *EventStoreDelegate) AggregateIDs(ctx context.Context, aggregateType eventhorizon.AggregateType) (
+	ret []uuid.UUID, err error) {
+	var eventStore eventhorizon.EventStore
+	if eventStore, err = o.delegate(); err == nil {
+		if lister, ok := eventStore.(AggregateLister); ok {
+			ret, err = lister.AggregateIDs(ctx, aggregateType)
+		} else {
+			err = ErrAggregateIDsNotSupported
+		}
+	}
+	return
+}
+
 func (o *EventStoreDelegate) Close() (err error) {
 	var eventStore eventhorizon.EventStore
 	if eventStore, err = o.delegate(); err == nil {
@@ -354,3 +489,20 @@ func (o *EventStoreDelegate) Close() (err error) {
 	}
 	return
 }
+
+// EventLog is implemented by event stores with a global ordered log of the events of all aggregates of a namespace.
+type EventLog interface {
+	// LastPosition returns the position of the last event in the log.
+	LastPosition(ctx context.Context) (int64, error)
+	// LoadAllFrom streams the events in the order they were saved, starting with the position.
+	LoadAllFrom(ctx context.Context, position int64, handle func(position int64, event eventhorizon.Event) error) error
+	// Subscribe streams the events like LoadAllFrom and then new events, until the context is done.
+	Subscribe(ctx context.Context, position int64, handle func(position int64, event eventhorizon.Event) error) error
+}
+
+// SnapshotEventStore combines an event store with a snapshot store, the aggregate store uses snapshots only
+// when the event store implements eventhorizon.SnapshotStore.
+type SnapshotEventStore struct {
+	eventhorizon.EventStore
+	eventhorizon.SnapshotStore
+}
@@ -0,0 +1,331 @@
+package filestore
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-ee/utils/eio"
+	"github.com/go-ee/utils/encrypt"
+	"github.com/google/uuid"
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/namespace"
+)
+
+// ErrFolderNotEmpty is when a backup is created in or restored to a folder with files.
+var ErrFolderNotEmpty = errors.New("folder not empty")
+
+// ErrNestedFolder is when the backup folder and the folder of the store are equal or one is inside the other.
+var ErrNestedFolder = errors.New("nested folders")
+
+// backupManifestFileName is the manifest of a backup, in the backup folder.
+const backupManifestFileName = "backup.json"
+
+// BackupManifest describes a backup, with the position of the last event of each namespace of the event store.
+type BackupManifest struct {
+	Created   time.Time        `json:"created"`
+	Positions map[string]int64 `json:"positions"`
+}
+
+// CreateBackup copies the folder of a file store to the backup folder, while the store is written.
+// All files, except the events, are written atomically by the stores, so each one is copied consistently.
+// The events of each namespace are copied under the shared lock of the namespace, consistent with
+// the event log. The outbox acknowledgements are copied first and the repos before the events,
+// so that a restored store dispatches the events, which are not projected in the repos, again.
+// The backup folder must be empty and outside the folder of the store, else ErrNestedFolder is returned.
+func CreateBackup(storeFolder string, backupFolder string) (ret *BackupManifest, err error) {
+	if err = ensureSeparateFolders(storeFolder, backupFolder); err != nil {
+		return
+	}
+	if err = ensureEmptyFolder(backupFolder); err != nil {
+		return
+	}
+
+	eventsFolder := filepath.Join(storeFolder, EventStoreFolder)
+	names := map[string]bool{}
+	if err = listFolderNamespaces(eventsFolder, names); err != nil {
+		return
+	}
+	namespaces := make([]string, 0, len(names))
+	for ns := range names {
+		namespaces = append(namespaces, ns)
+	}
+	sort.Strings(namespaces)
+
+	for _, ns := range namespaces {
+		ackFileName := filepath.Join(filepath.FromSlash(ns), outboxAckFileName)
+		err = copyFile(filepath.Join(eventsFolder, ackFileName), filepath.Join(backupFolder, EventStoreFolder, ackFileName))
+		if err != nil && !os.IsNotExist(err) {
+			return
+		}
+	}
+	err = nil
+
+	if err = copyFolder(storeFolder, backupFolder, func(path string) bool {
+		return path == EventStoreFolder
+	}); err != nil {
+		return
+	}
+
+	ret = &BackupManifest{Created: time.Now(), Positions: map[string]int64{}}
+	for _, ns := range namespaces {
+		if ret.Positions[ns], err = backupEvents(
+			filepath.Join(eventsFolder, filepath.FromSlash(ns)),
+			filepath.Join(backupFolder, EventStoreFolder, filepath.FromSlash(ns))); err != nil {
+			return
+		}
+	}
+
+	var data []byte
+	if data, err = json.MarshalIndent(ret, "", "  "); err == nil {
+		err = eio.WriteFileAtomic(filepath.Join(backupFolder, backupManifestFileName), data, DefaultFilePerm)
+	}
+	return
+}
+
+// backupEvents copies the files of the namespace of the event store under its shared lock
+// and returns the position of the last event.
+func backupEvents(namespaceFolder string, backupNamespaceFolder string) (ret int64, err error) {
+	var lock *fileLock
+	if lock, err = lockFile(buildLockFileName(namespaceFolder), false, DefaultFilePerm); err != nil {
+		// the namespace is deleted meanwhile
+		if os.IsNotExist(err) {
+			err = nil
+		}
+		return
+	}
+	defer lock.Unlock()
+
+	var entries []os.DirEntry
+	if entries, err = os.ReadDir(namespaceFolder); err != nil {
+		return
+	}
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() || entry.Name() == lockFileName || entry.Name() == outboxAckFileName {
+			continue
+		}
+		if err = copyFile(filepath.Join(namespaceFolder, entry.Name()),
+			filepath.Join(backupNamespaceFolder, entry.Name())); err != nil {
+			return
+		}
+	}
+
+	var lastEntry *dbLogEntry
+	if lastEntry, err = loadLastLogEntry(context.Background(),
+		buildLogFileName(backupNamespaceFolder)); err == nil && lastEntry != nil {
+		ret = lastEntry.Position
+	}
+	return
+}
+
+// LoadBackupManifest loads the manifest of the backup folder.
+func LoadBackupManifest(backupFolder string) (ret *BackupManifest, err error) {
+	var data []byte
+	if data, err = os.ReadFile(filepath.Join(backupFolder, backupManifestFileName)); err == nil {
+		ret = &BackupManifest{}
+		err = json.Unmarshal(data, ret)
+	}
+	return
+}
+
+// RestoreOptions are the options of RestoreBackup.
+type RestoreOptions struct {
+	// Until restores the state as of the time, the backup as it is, if zero.
+	Until time.Time
+	// Codec of the restored events, by default the codec of a new EventStore.
+	Codec Codec
+	// Keys of the events, for the backup and the restored events, based on the restored keys folder.
+	Keys Keys
+}
+
+// RestoreBackup restores the backup to the folder of a file store, which must not have files.
+// With Until the events are replayed up to the time, the events of an aggregate after its first event later
+// than Until are skipped. The repos and snapshots are not restored then and no event is acknowledged
+// by the Outbox, so that the Outbox regenerates the projections by dispatching all events.
+func RestoreBackup(backupFolder string, storeFolder string, options *RestoreOptions) (err error) {
+	if options == nil {
+		options = &RestoreOptions{}
+	}
+
+	if err = ensureSeparateFolders(storeFolder, backupFolder); err != nil {
+		return
+	}
+	var manifest *BackupManifest
+	if manifest, err = LoadBackupManifest(backupFolder); err != nil {
+		return
+	}
+	if err = ensureEmptyFolder(storeFolder); err != nil {
+		return
+	}
+
+	if options.Until.IsZero() {
+		err = copyFolder(backupFolder, storeFolder, func(path string) bool {
+			return path == backupManifestFileName
+		})
+		return
+	}
+
+	if err = copyFolder(filepath.Join(backupFolder, KeysFolder), filepath.Join(storeFolder, KeysFolder), nil); err != nil {
+		return
+	}
+
+	// the backup is read as it is, without the recovery
+	source := NewEventStore(filepath.Join(backupFolder, EventStoreFolder))
+	source.ReadOnly = true
+	target := NewEventStore(filepath.Join(storeFolder, EventStoreFolder))
+	source.Keys, target.Keys = options.Keys, options.Keys
+	if options.Codec != nil {
+		target.Codec = options.Codec
+	}
+
+	namespaces := make([]string, 0, len(manifest.Positions))
+	for ns := range manifest.Positions {
+		namespaces = append(namespaces, ns)
+	}
+	sort.Strings(namespaces)
+
+	for _, ns := range namespaces {
+		if err = replayUntil(namespace.NewContext(context.Background(), ns),
+			source, target, manifest.Positions[ns], options.Until); err != nil {
+			return fmt.Errorf("could not restore namespace %v: %w", ns, err)
+		}
+	}
+	return
+}
+
+// replayUntil saves the events of the source, up to the position and the time, in the target.
+// The source skips the events of crypto-shredded aggregates, the aggregates with skipped events
+// are skipped as a whole, so that neither their readable events nor their later events are saved.
+func replayUntil(ctx context.Context, source *EventStore, target *EventStore, position int64, until time.Time) (
+	err error) {
+
+	var shredded map[uuid.UUID]bool
+	if shredded, err = findShreddedAggregates(ctx, source, position); err != nil {
+		return
+	}
+
+	later := map[uuid.UUID]bool{}
+	err = source.LoadAllFrom(ctx, 1, func(current int64, event eh.Event) (err error) {
+		if current > position || later[event.AggregateID()] || shredded[event.AggregateID()] {
+			return
+		}
+		if event.Timestamp().After(until) {
+			later[event.AggregateID()] = true
+			return
+		}
+		return target.Save(ctx, []eh.Event{event}, event.Version()-1)
+	})
+	return
+}
+
+// findShreddedAggregates returns the aggregates of the readable events up to the position,
+// which have events encrypted by a shredded key.
+func findShreddedAggregates(ctx context.Context, source *EventStore, position int64) (
+	ret map[uuid.UUID]bool, err error) {
+
+	aggregates := map[uuid.UUID]bool{}
+	if err = source.LoadAllFrom(ctx, 1, func(current int64, event eh.Event) (err error) {
+		if current <= position {
+			aggregates[event.AggregateID()] = true
+		}
+		return
+	}); err != nil {
+		return
+	}
+
+	ret = map[uuid.UUID]bool{}
+	for id := range aggregates {
+		if _, loadErr := source.Load(ctx, id); loadErr != nil {
+			if !errors.Is(loadErr, encrypt.ErrKeyNotFound) {
+				return nil, loadErr
+			}
+			ret[id] = true
+		}
+	}
+	return
+}
+
+// ensureSeparateFolders checks, that the folders are not equal and not inside each other,
+// so that the copy of a folder doesn't copy itself.
+func ensureSeparateFolders(folder string, otherFolder string) (err error) {
+	var absFolder, absOtherFolder string
+	if absFolder, err = filepath.Abs(folder); err != nil {
+		return
+	}
+	if absOtherFolder, err = filepath.Abs(otherFolder); err != nil {
+		return
+	}
+	if isInsideFolder(absFolder, absOtherFolder) || isInsideFolder(absOtherFolder, absFolder) {
+		err = fmt.Errorf("%w: %v, %v", ErrNestedFolder, folder, otherFolder)
+	}
+	return
+}
+
+// isInsideFolder returns true, if the path is the folder or inside it.
+func isInsideFolder(folder string, path string) bool {
+	relative, err := filepath.Rel(folder, path)
+	return err == nil && relative != ".." && !strings.HasPrefix(relative, ".."+string(filepath.Separator))
+}
+
+func ensureEmptyFolder(folder string) (err error) {
+	var entries []os.DirEntry
+	if entries, err = os.ReadDir(folder); err != nil {
+		if os.IsNotExist(err) {
+			err = os.MkdirAll(folder, DefaultFolderPerm)
+		}
+		return
+	}
+	if len(entries) > 0 {
+		err = fmt.Errorf("%w: %v", ErrFolderNotEmpty, folder)
+	}
+	return
+}
+
+// copyFolder copies the files of the folder, except the lock files and the skipped relative paths.
+func copyFolder(folder string, targetFolder string, skip func(path string) bool) (err error) {
+	err = filepath.WalkDir(folder, func(path string, entry fs.DirEntry, walkErr error) error {
+		if walkErr != nil {
+			if os.IsNotExist(walkErr) {
+				return nil
+			}
+			return walkErr
+		}
+		relative, relErr := filepath.Rel(folder, path)
+		if relErr != nil {
+			return relErr
+		}
+		if skip != nil && skip(filepath.ToSlash(relative)) {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !entry.Type().IsRegular() || entry.Name() == lockFileName {
+			return nil
+		}
+		return copyFile(path, filepath.Join(targetFolder, relative))
+	})
+	return
+}
+
+func copyFile(fileName string, targetFileName string) (err error) {
+	var info os.FileInfo
+	if info, err = os.Stat(fileName); err != nil {
+		return
+	}
+	var data []byte
+	if data, err = os.ReadFile(fileName); err != nil {
+		return
+	}
+	if err = os.MkdirAll(filepath.Dir(targetFileName), DefaultFolderPerm); err == nil {
+		err = eio.WriteFileAtomic(targetFileName, data, info.Mode().Perm())
+	}
+	return
+}
@@ -0,0 +1,138 @@
+package filestore
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	eh "github.com/looplab/eventhorizon"
+)
+
+func TestBackupRestore(t *testing.T) {
+	ctx := newTestContext()
+	storeFolder := t.TempDir()
+
+	store := NewEventStore(filepath.Join(storeFolder, EventStoreFolder))
+	repo := newTestFolderRepo(t, filepath.Join(storeFolder, ReposFolder))
+	id1, id2 := uuid.New(), uuid.New()
+	until := time.Now()
+	before, after := until.Add(-time.Minute), until.Add(time.Minute)
+	for _, event := range []eh.Event{
+		eh.NewEvent(testEventType, &testEventData{Content: "1"}, before, eh.ForAggregate(testAggregateType, id1, 1)),
+		eh.NewEvent(testEventType, &testEventData{Content: "2"}, before, eh.ForAggregate(testAggregateType, id2, 1)),
+		eh.NewEvent(testEventType, &testEventData{Content: "3"}, after, eh.ForAggregate(testAggregateType, id1, 2)),
+		eh.NewEvent(testEventType, &testEventData{Content: "4"}, after, eh.ForAggregate(testAggregateType, id2, 2)),
+	} {
+		if err := store.Save(ctx, []eh.Event{event}, event.Version()-1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	saveTestEntities(t, repo, &testEntity{ID: id1, Name: "Anna"})
+
+	backupFolder := filepath.Join(t.TempDir(), "backup")
+	manifest, err := CreateBackup(storeFolder, backupFolder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if manifest.Positions["test"] != 4 {
+		t.Fatalf("expected position 4, got %v", manifest.Positions)
+	}
+	if _, err = CreateBackup(storeFolder, backupFolder); !errors.Is(err, ErrFolderNotEmpty) {
+		t.Fatalf("expected folder not empty, got %v", err)
+	}
+	for _, nested := range []string{storeFolder, filepath.Join(storeFolder, "backup"), filepath.Dir(storeFolder)} {
+		if _, err = CreateBackup(storeFolder, nested); !errors.Is(err, ErrNestedFolder) {
+			t.Fatalf("expected nested folder for %v, got %v", nested, err)
+		}
+	}
+	if _, err = os.Stat(filepath.Join(storeFolder, "backup")); !os.IsNotExist(err) {
+		t.Fatalf("expected no backup folder in the store folder, got %v", err)
+	}
+
+	restoredFolder := t.TempDir()
+	if err = RestoreBackup(backupFolder, restoredFolder, nil); err != nil {
+		t.Fatal(err)
+	}
+	restored := NewEventStore(filepath.Join(restoredFolder, EventStoreFolder))
+	if events, err := restored.Load(ctx, id2); err != nil || len(events) != 2 {
+		t.Fatalf("expected 2 events, got %v, %v", events, err)
+	}
+	if _, err = newTestFolderRepo(t, filepath.Join(restoredFolder, ReposFolder)).Find(ctx, id1); err != nil {
+		t.Fatal(err)
+	}
+
+	// the point-in-time restore has the events until the time and no projections
+	pointInTimeFolder := t.TempDir()
+	if err = RestoreBackup(backupFolder, pointInTimeFolder, &RestoreOptions{Until: until}); err != nil {
+		t.Fatal(err)
+	}
+	restored = NewEventStore(filepath.Join(pointInTimeFolder, EventStoreFolder))
+	if position, err := restored.LastPosition(ctx); err != nil || position != 2 {
+		t.Fatalf("expected position 2, got %v, %v", position, err)
+	}
+	if events, err := restored.Load(ctx, id1); err != nil || len(events) != 1 ||
+		events[0].Data().(*testEventData).Content != "1" {
+		t.Fatalf("expected first event, got %v, %v", events, err)
+	}
+	if pending, err := NewOutbox(restored, nil).Pending(ctx); err != nil || pending != 2 {
+		t.Fatalf("expected 2 pending events to regenerate the projections, got %v, %v", pending, err)
+	}
+	if entities, err := newTestFolderRepo(t, filepath.Join(pointInTimeFolder, ReposFolder)).FindAll(ctx); err != nil ||
+		len(entities) != 0 {
+		t.Fatalf("expected no projections, got %v, %v", entities, err)
+	}
+}
+
+func TestRestoreBackupShreddedAggregate(t *testing.T) {
+	ctx := newTestContext()
+	storeFolder := t.TempDir()
+	keyring, err := NewKeyringKeysPassphrase("k1", "secret1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the first event is saved before the encryption and stays readable after the shredding
+	store := NewEventStore(filepath.Join(storeFolder, EventStoreFolder))
+	id1, id2 := uuid.New(), uuid.New()
+	if err = store.Save(ctx, newTestEvents(id1, 1, 1), 0); err != nil {
+		t.Fatal(err)
+	}
+	keys := NewAggregateKeys(filepath.Join(storeFolder, KeysFolder), keyring)
+	store.Keys = keys
+	if err = store.Save(ctx, newTestEvents(id1, 2, 1), 1); err != nil {
+		t.Fatal(err)
+	}
+	if err = store.Save(ctx, newTestEvents(id2, 1, 1), 0); err != nil {
+		t.Fatal(err)
+	}
+	if err = keys.Shred(ctx, id1); err != nil {
+		t.Fatal(err)
+	}
+
+	backupFolder := filepath.Join(t.TempDir(), "backup")
+	if _, err = CreateBackup(storeFolder, backupFolder); err != nil {
+		t.Fatal(err)
+	}
+	restoredFolder := t.TempDir()
+	if err = RestoreBackup(backupFolder, restoredFolder, &RestoreOptions{
+		Until: time.Now().Add(time.Minute),
+		Keys:  NewAggregateKeys(filepath.Join(restoredFolder, KeysFolder), keyring),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(filepath.Join(backupFolder, EventStoreFolder, "test", lockFileName)); !os.IsNotExist(err) {
+		t.Fatalf("expected the backup unchanged, got %v", err)
+	}
+
+	restored := NewEventStore(filepath.Join(restoredFolder, EventStoreFolder))
+	restored.Keys = NewAggregateKeys(filepath.Join(restoredFolder, KeysFolder), keyring)
+	if events, err := restored.Load(ctx, id1); err != nil || len(events) != 0 {
+		t.Fatalf("expected the shredded aggregate skipped, got %v, %v", events, err)
+	}
+	if events, err := restored.Load(ctx, id2); err != nil || len(events) != 1 {
+		t.Fatalf("expected 1 event, got %v, %v", events, err)
+	}
+}
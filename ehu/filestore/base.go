@@ -2,7 +2,17 @@ package filestore
 
 import (
 	"context"
+	"github.com/looplab/eventhorizon/namespace"
 	"os"
+	"path/filepath"
+)
+
+// The folders of the stores in the folder of a file store, e.g. of ehu/app/filestore.
+const (
+	EventStoreFolder    = "eventstore"
+	SnapshotStoreFolder = "snapshots"
+	KeysFolder          = "keys"
+	ReposFolder         = "repos"
 )
 
 const DefaultFolderPerm os.FileMode = 0777
@@ -24,3 +34,12 @@ func NewBase(folder string) *Base {
 
 func (s *Base) Close(_ context.Context) {
 }
+
+// buildFolderName returns the folder of the namespace, the error is ErrInvalidNamespace for an invalid name.
+func (s *Base) buildFolderName(ctx context.Context) (ret string, err error) {
+	ns := namespace.FromContext(ctx)
+	if err = ValidateNamespace(ns); err == nil {
+		ret = filepath.Join(s.folder, filepath.FromSlash(ns))
+	}
+	return
+}
@@ -0,0 +1,309 @@
+package filestore
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+// Codec encodes the records of the EventStore and the Repo.
+// The codec of a file is recorded in the file header, files without header are JSON,
+// so files are loaded with the codec they were written with, independent of the codec of the store.
+// Nested values, like the event data, are kept encoded by Unmarshal in values implementing the
+// json and cbor (un)marshaler interfaces and are decoded later by UnmarshalRaw.
+type Codec interface {
+	// Name is the name of the codec in the file header.
+	Name() string
+	// Binary codecs are base64 encoded in the line based files of the EventStore.
+	Binary() bool
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+	UnmarshalRaw(data []byte, v interface{}) error
+}
+
+var (
+	// JSONCodec is the indented JSON of the Repo files, events are written compact by it.
+	JSONCodec Codec = &jsonCodec{name: "json", indent: true}
+	// CompactJSONCodec is the default codec of the EventStore.
+	CompactJSONCodec Codec = &jsonCodec{name: "json-compact"}
+	// GzipJSONCodec compresses compact JSON, best for large records like Repo files or events with much data.
+	GzipJSONCodec = NewGzipCodec(CompactJSONCodec)
+	// CBORCodec is the binary CBOR encoding, struct fields are named by the json tags.
+	CBORCodec Codec = newCborCodec()
+)
+
+var codecs = map[string]Codec{}
+var codecsMu sync.RWMutex
+
+func init() {
+	for _, codec := range []Codec{JSONCodec, CompactJSONCodec, GzipJSONCodec, CBORCodec} {
+		RegisterCodec(codec)
+	}
+}
+
+// RegisterCodec registers the codec by its name, to load files written with it.
+func RegisterCodec(codec Codec) {
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+	codecs[codec.Name()] = codec
+}
+
+// CodecByName returns the registered codec of the name.
+func CodecByName(name string) (ret Codec, err error) {
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+	var ok bool
+	if ret, ok = codecs[name]; !ok {
+		err = fmt.Errorf("codec '%v' not registered", name)
+	}
+	return
+}
+
+type jsonCodec struct {
+	name   string
+	indent bool
+}
+
+func (o *jsonCodec) Name() string {
+	return o.name
+}
+
+func (o *jsonCodec) Binary() bool {
+	return false
+}
+
+func (o *jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	if o.indent {
+		return json.MarshalIndent(v, "", "  ")
+	}
+	return json.Marshal(v)
+}
+
+func (o *jsonCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+func (o *jsonCodec) UnmarshalRaw(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+// GzipCodec compresses the records of another codec.
+type GzipCodec struct {
+	Codec
+}
+
+func NewGzipCodec(codec Codec) *GzipCodec {
+	return &GzipCodec{Codec: codec}
+}
+
+func (o *GzipCodec) Name() string {
+	return "gzip+" + o.Codec.Name()
+}
+
+func (o *GzipCodec) Binary() bool {
+	return true
+}
+
+func (o *GzipCodec) Marshal(v interface{}) (ret []byte, err error) {
+	var data []byte
+	if data, err = o.Codec.Marshal(v); err != nil {
+		return
+	}
+	var buffer bytes.Buffer
+	writer := gzip.NewWriter(&buffer)
+	if _, err = writer.Write(data); err == nil {
+		if err = writer.Close(); err == nil {
+			ret = buffer.Bytes()
+		}
+	}
+	return
+}
+
+func (o *GzipCodec) Unmarshal(data []byte, v interface{}) (err error) {
+	var reader *gzip.Reader
+	if reader, err = gzip.NewReader(bytes.NewReader(data)); err != nil {
+		return
+	}
+	defer reader.Close()
+
+	var uncompressed []byte
+	if uncompressed, err = io.ReadAll(reader); err == nil {
+		err = o.Codec.Unmarshal(uncompressed, v)
+	}
+	return
+}
+
+type cborCodec struct {
+	encMode cbor.EncMode
+	decMode cbor.DecMode
+}
+
+func newCborCodec() *cborCodec {
+	encMode, err := cbor.EncOptions{Time: cbor.TimeRFC3339Nano}.EncMode()
+	if err != nil {
+		panic(err)
+	}
+	decMode, err := cbor.DecOptions{DefaultMapType: reflect.TypeOf(map[string]interface{}(nil))}.DecMode()
+	if err != nil {
+		panic(err)
+	}
+	return &cborCodec{encMode: encMode, decMode: decMode}
+}
+
+func (o *cborCodec) Name() string {
+	return "cbor"
+}
+
+func (o *cborCodec) Binary() bool {
+	return true
+}
+
+func (o *cborCodec) Marshal(v interface{}) ([]byte, error) {
+	return o.encMode.Marshal(v)
+}
+
+func (o *cborCodec) Unmarshal(data []byte, v interface{}) error {
+	return o.decMode.Unmarshal(data, v)
+}
+
+func (o *cborCodec) UnmarshalRaw(data []byte, v interface{}) error {
+	return o.decMode.Unmarshal(data, v)
+}
+
+// rawData keeps a nested value encoded, in the encoding of the JSON or CBOR based codec.
+type rawData []byte
+
+var cborNull = []byte{0xf6}
+
+func (o rawData) MarshalJSON() ([]byte, error) {
+	if len(o) == 0 {
+		return []byte("null"), nil
+	}
+	return o, nil
+}
+
+func (o *rawData) UnmarshalJSON(data []byte) error {
+	*o = append((*o)[0:0], data...)
+	return nil
+}
+
+func (o rawData) MarshalCBOR() ([]byte, error) {
+	if len(o) == 0 {
+		return cborNull, nil
+	}
+	return o, nil
+}
+
+func (o *rawData) UnmarshalCBOR(data []byte) error {
+	*o = append((*o)[0:0], data...)
+	return nil
+}
+
+func (o rawData) isNull() bool {
+	return len(o) == 0 || string(o) == "null" || bytes.Equal(o, cborNull)
+}
+
+// rawToJSON converts the nested value to JSON, e.g. for the upcasters.
+func rawToJSON(codec Codec, raw rawData) (ret json.RawMessage, err error) {
+	if isJSONCodec(codec) {
+		return json.RawMessage(raw), nil
+	}
+	var value interface{}
+	if err = codec.UnmarshalRaw(raw, &value); err == nil {
+		ret, err = json.Marshal(value)
+	}
+	return
+}
+
+func isJSONCodec(codec Codec) bool {
+	switch c := codec.(type) {
+	case *jsonCodec:
+		return true
+	case *GzipCodec:
+		return isJSONCodec(c.Codec)
+	case *cryptoCodec:
+		return isJSONCodec(c.Codec)
+	}
+	return false
+}
+
+// codecHeaderPrefix starts the first line of a file, which records the codec of the file.
+const codecHeaderPrefix = "#codec:"
+
+// codecHeader returns the header line of the codec, JSON codecs have no header.
+func codecHeader(codec Codec) []byte {
+	if _, ok := codec.(*jsonCodec); ok {
+		return nil
+	}
+	return []byte(codecHeaderPrefix + codec.Name() + "\n")
+}
+
+// parseCodecHeader returns the codec of the file data and the length of the header.
+func parseCodecHeader(data []byte) (ret Codec, headerLength int, err error) {
+	if !bytes.HasPrefix(data, []byte(codecHeaderPrefix)) {
+		return JSONCodec, 0, nil
+	}
+	end := bytes.IndexByte(data, '\n')
+	if end < 0 {
+		err = fmt.Errorf("invalid codec header")
+		return
+	}
+	if ret, err = CodecByName(strings.TrimSpace(string(data[len(codecHeaderPrefix):end]))); err == nil {
+		headerLength = end + 1
+	}
+	return
+}
+
+// readCodecHeader reads the codec header of the file, JSON and 0, if the file has no header.
+func readCodecHeader(file *os.File) (ret Codec, headerLength int64, err error) {
+	data := make([]byte, 128)
+	var n int
+	if n, err = file.ReadAt(data, 0); err != nil && err != io.EOF {
+		return
+	}
+	var length int
+	ret, length, err = parseCodecHeader(data[:n])
+	headerLength = int64(length)
+	return
+}
+
+func isHeaderLine(line []byte) bool {
+	return bytes.HasPrefix(line, []byte(codecHeaderPrefix))
+}
+
+// encodeLine encodes the record as a single line without line break, binary codecs base64 encoded.
+func encodeLine(codec Codec, v interface{}) (ret []byte, err error) {
+	if c, ok := codec.(*cryptoCodec); ok {
+		codec = c.Codec
+	}
+	if c, ok := codec.(*jsonCodec); ok && c.indent {
+		codec = CompactJSONCodec
+	}
+	if ret, err = codec.Marshal(v); err == nil && codec.Binary() {
+		encoded := make([]byte, base64.StdEncoding.EncodedLen(len(ret)))
+		base64.StdEncoding.Encode(encoded, ret)
+		ret = encoded
+	}
+	return
+}
+
+func decodeLine(codec Codec, line []byte, v interface{}) (err error) {
+	if codec.Binary() {
+		decoded := make([]byte, base64.StdEncoding.DecodedLen(len(line)))
+		var n int
+		if n, err = base64.StdEncoding.Decode(decoded, line); err != nil {
+			return
+		}
+		line = decoded[:n]
+	}
+	return codec.Unmarshal(line, v)
+}
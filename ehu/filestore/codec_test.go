@@ -0,0 +1,100 @@
+package filestore
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	eh "github.com/looplab/eventhorizon"
+)
+
+func TestEventStoreCodecs(t *testing.T) {
+	for _, codec := range []Codec{JSONCodec, CompactJSONCodec, GzipJSONCodec, CBORCodec} {
+		t.Run(codec.Name(), func(t *testing.T) {
+			ctx := newTestContext()
+			folder := t.TempDir()
+			store := NewEventStore(folder)
+			id1, id2 := uuid.New(), uuid.New()
+			if err := store.Save(ctx, newTestEvents(id1, 1, 2), 0); err != nil {
+				t.Fatal(err)
+			}
+
+			// the existing file keeps its codec, new files get the codec of the store
+			store.Codec = codec
+			if err := store.Save(ctx, newTestEvents(id1, 3, 1), 2); err != nil {
+				t.Fatal(err)
+			}
+			if err := store.Save(ctx, newTestEvents(id2, 1, 2), 0); err != nil {
+				t.Fatal(err)
+			}
+			if err := store.Save(ctx, newTestEvents(id2, 3, 1), 2); err != nil {
+				t.Fatal(err)
+			}
+
+			reopened := NewEventStore(folder)
+			for _, id := range []uuid.UUID{id1, id2} {
+				events, err := reopened.Load(ctx, id)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(events) != 3 || events[2].Version() != 3 || events[2].AggregateID() != id {
+					t.Fatalf("unexpected events %v", events)
+				}
+				if data, ok := events[0].Data().(*testEventData); !ok || data.Content != "content" {
+					t.Fatalf("unexpected event data %v", events[0].Data())
+				}
+				if events, err = reopened.LoadFrom(ctx, id, 2); err != nil || len(events) != 2 {
+					t.Fatalf("expected 2 events from version 2, got %v, %v", events, err)
+				}
+			}
+
+			count := 0
+			if err := reopened.LoadAllFrom(ctx, 1, func(position int64, event eh.Event) error {
+				count++
+				return nil
+			}); err != nil || count != 6 {
+				t.Fatalf("expected 6 events of the log, got %v, %v", count, err)
+			}
+
+			if err := reopened.RebuildLog(ctx); err != nil {
+				t.Fatal(err)
+			}
+			if last, err := reopened.LastPosition(ctx); err != nil || last != 6 {
+				t.Fatalf("expected last position 6 after rebuild, got %v, %v", last, err)
+			}
+		})
+	}
+}
+
+func TestRepoCodecs(t *testing.T) {
+	for _, codec := range []Codec{CompactJSONCodec, GzipJSONCodec, CBORCodec} {
+		t.Run(codec.Name(), func(t *testing.T) {
+			ctx := newTestContext()
+			folder := t.TempDir()
+			repo, err := NewRepo(folder)
+			if err != nil {
+				t.Fatal(err)
+			}
+			repo.Codec = codec
+			repo.SetEntityFactory(func() eh.Entity { return &testEntity{} })
+			anna := &testEntity{ID: uuid.New(), Name: "Anna", Email: "anna@example.com", Age: 30}
+			saveTestEntities(t, repo, anna, &testEntity{ID: uuid.New(), Name: "Bert", Age: 17})
+
+			// the file is loaded with the codec of its header
+			reloaded, err := NewRepo(folder)
+			if err != nil {
+				t.Fatal(err)
+			}
+			reloaded.SetEntityFactory(func() eh.Entity { return &testEntity{} })
+			entity, err := reloaded.Find(ctx, anna.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if found := entity.(*testEntity); *found != *anna {
+				t.Fatalf("expected %v, got %v", anna, found)
+			}
+			if entities, err := reloaded.FindAll(ctx); err != nil || len(entities) != 2 {
+				t.Fatalf("expected 2 entities, got %v, %v", entities, err)
+			}
+		})
+	}
+}
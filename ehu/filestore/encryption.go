@@ -0,0 +1,159 @@
+package filestore
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/go-ee/utils/encrypt"
+	"github.com/google/uuid"
+)
+
+// ErrKeysNotSet is when an encrypted record is loaded by a store without keys.
+var ErrKeysNotSet = errors.New("keys not set for encrypted record")
+
+// cryptoCodec encrypts each event record with the active key of the aggregate. The encrypted record is
+// stored in an envelope with the key id, the header of the event stays plain for the event log.
+// Records without key id are loaded plain, so existing events are still loaded after enabling encryption.
+type cryptoCodec struct {
+	Codec
+	keys Keys
+}
+
+// fileCodec returns the codec of an aggregate events file, with encryption if the store has keys.
+func (s *EventStore) fileCodec(codec Codec) Codec {
+	if s.Keys != nil {
+		return &cryptoCodec{Codec: codec, keys: s.Keys}
+	}
+	return codec
+}
+
+func (s *EventStore) readFileCodec(file *os.File) (ret Codec, headerLength int64, err error) {
+	if ret, headerLength, err = readCodecHeader(file); err == nil {
+		ret = s.fileCodec(ret)
+	}
+	return
+}
+
+// encodeEventLine encodes the record, a dbEvent or dbEventRecord, as line, sealed if the codec encrypts.
+func encodeEventLine(ctx context.Context, codec Codec, record interface{}) (ret []byte, err error) {
+	if c, ok := codec.(*cryptoCodec); ok {
+		if record, err = c.seal(ctx, record); err != nil {
+			return
+		}
+	}
+	return encodeLine(codec, record)
+}
+
+// seal returns the envelope of the record with the encrypted record.
+func (o *cryptoCodec) seal(ctx context.Context, record interface{}) (ret *dbEvent, err error) {
+	var header dbEvent
+	switch r := record.(type) {
+	case *dbEvent:
+		header = *r
+		header.KeyID_ = ""
+		record = &header
+	case *dbEventRecord:
+		plain := *r
+		plain.KeyID_ = ""
+		header, record = plain.dbEvent, &plain
+	default:
+		return nil, fmt.Errorf("unsupported event record %T", record)
+	}
+
+	ret = &dbEvent{
+		AggregateID_:   header.AggregateID_,
+		AggregateType_: header.AggregateType_,
+		EventType_:     header.EventType_,
+		Timestamp_:     header.Timestamp_,
+		Version_:       header.Version_,
+	}
+
+	var encryptor *encrypt.Encryptor
+	if ret.KeyID_, encryptor, err = o.keys.ActiveKey(ctx, header.AggregateID_); err != nil {
+		return
+	}
+
+	var plain []byte
+	if plain, err = o.Codec.Marshal(record); err == nil {
+		ret.Cipher_, err = encryptor.EncryptWithData(plain, eventAdditionalData(header.AggregateID_, header.Version_))
+	}
+	return
+}
+
+// open decrypts the record of the envelope, the key id of the envelope is kept in the record.
+func (o *cryptoCodec) open(ctx context.Context, envelope *dbEventRecord) (ret *dbEventRecord, err error) {
+	var encryptor *encrypt.Encryptor
+	if encryptor, err = o.keys.Key(ctx, envelope.KeyID_); err != nil {
+		return
+	}
+
+	var plain []byte
+	if plain, err = encryptor.DecryptWithData(
+		envelope.Cipher_, eventAdditionalData(envelope.AggregateID_, envelope.Version_)); err != nil {
+		return
+	}
+	ret = &dbEventRecord{}
+	if err = o.Codec.Unmarshal(plain, ret); err == nil {
+		ret.KeyID_ = envelope.KeyID_
+	}
+	return
+}
+
+// openEventRecord decrypts the record, if it is an envelope.
+func openEventRecord(ctx context.Context, codec Codec, record *dbEventRecord) (ret *dbEventRecord, err error) {
+	if len(record.Cipher_) == 0 {
+		return record, nil
+	}
+	c, ok := codec.(*cryptoCodec)
+	if !ok {
+		return nil, fmt.Errorf("%w: %v", ErrKeysNotSet, record.KeyID_)
+	}
+	return c.open(ctx, record)
+}
+
+// eventAdditionalData binds the encrypted record to the aggregate and version of the envelope.
+func eventAdditionalData(aggregateID uuid.UUID, version int) []byte {
+	return []byte(aggregateID.String() + "@" + strconv.Itoa(version))
+}
+
+// keyHeaderPrefix starts the line after the codec header of an encrypted Repo file, with the key id.
+const keyHeaderPrefix = "#key:"
+
+// encryptFile encrypts the data of a file with the active key and prepends the key header.
+func encryptFile(ctx context.Context, keys Keys, name string, data []byte) (ret []byte, err error) {
+	var keyID string
+	var encryptor *encrypt.Encryptor
+	if keyID, encryptor, err = keys.ActiveKey(ctx, uuid.Nil); err != nil {
+		return
+	}
+	var encrypted []byte
+	if encrypted, err = encryptor.EncryptWithData(data, []byte(name)); err == nil {
+		ret = append([]byte(keyHeaderPrefix+keyID+"\n"), encrypted...)
+	}
+	return
+}
+
+// decryptFile decrypts the data of a file, if it starts with the key header.
+func decryptFile(ctx context.Context, keys Keys, name string, data []byte) (ret []byte, err error) {
+	if !bytes.HasPrefix(data, []byte(keyHeaderPrefix)) {
+		return data, nil
+	}
+	end := bytes.IndexByte(data, '\n')
+	if end < 0 {
+		return nil, fmt.Errorf("invalid key header")
+	}
+	keyID := string(data[len(keyHeaderPrefix):end])
+	if keys == nil {
+		return nil, fmt.Errorf("%w: %v", ErrKeysNotSet, keyID)
+	}
+
+	var encryptor *encrypt.Encryptor
+	if encryptor, err = keys.Key(ctx, keyID); err == nil {
+		ret, err = encryptor.DecryptWithData(data[end+1:], []byte(name))
+	}
+	return
+}
@@ -0,0 +1,165 @@
+package filestore
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-ee/utils/encrypt"
+	"github.com/google/uuid"
+	eh "github.com/looplab/eventhorizon"
+)
+
+func TestEventStoreEncryption(t *testing.T) {
+	ctx := newTestContext()
+	folder := t.TempDir()
+	keyring, err := NewKeyringKeysPassphrase("k1", "secret1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store := NewEventStore(filepath.Join(folder, "eventstore"))
+	id1, id2 := uuid.New(), uuid.New()
+	if err = store.Save(ctx, newTestEvents(id1, 1, 1), 0); err != nil {
+		t.Fatal(err)
+	}
+
+	// events saved before enabling the encryption are still loaded
+	store.Keys = keyring
+	if err = store.Save(ctx, newTestEvents(id1, 2, 1), 1); err != nil {
+		t.Fatal(err)
+	}
+	if events, err := store.Load(ctx, id1); err != nil || len(events) != 2 {
+		t.Fatalf("expected 2 events, got %v, %v", events, err)
+	}
+
+	if err = keyring.AddPassphrase("k2", "secret2", true); err != nil {
+		t.Fatal(err)
+	}
+	if rotated, err := store.RotateKeys(ctx); err != nil || rotated != 2 {
+		t.Fatalf("expected 2 rotated events, got %v, %v", rotated, err)
+	}
+	data, err := os.ReadFile(buildTestEventsFileName(t, ctx, store, id1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(data, []byte("content")) || bytes.Count(data, []byte(`"key_id":"k2"`)) != 2 {
+		t.Fatalf("expected events encrypted by k2, got %s", data)
+	}
+
+	// crypto-shredding by per aggregate keys
+	store.Keys = NewAggregateKeys(filepath.Join(folder, "keys"), keyring)
+	if err = store.Save(ctx, newTestEvents(id2, 1, 2), 0); err != nil {
+		t.Fatal(err)
+	}
+	if err = store.Keys.(*AggregateKeys).Shred(ctx, id2); err != nil {
+		t.Fatal(err)
+	}
+	reopened := NewEventStore(filepath.Join(folder, "eventstore"))
+	reopened.Keys = NewAggregateKeys(filepath.Join(folder, "keys"), keyring)
+	if _, err = reopened.Load(ctx, id2); !errors.Is(err, encrypt.ErrKeyNotFound) {
+		t.Fatalf("expected key not found for the shredded aggregate, got %v", err)
+	}
+
+	var loaded []uuid.UUID
+	if err = reopened.LoadAllFrom(ctx, 1, func(position int64, event eh.Event) error {
+		loaded = append(loaded, event.AggregateID())
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded) != 2 || loaded[0] != id1 || loaded[1] != id1 {
+		t.Fatalf("expected only the events of %v, got %v", id1, loaded)
+	}
+	if _, err = reopened.Migrate(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRepoEncryption(t *testing.T) {
+	ctx := newTestContext()
+	folder := t.TempDir()
+	keyring, err := NewKeyringKeysPassphrase("k1", "secret1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	repo := newTestFolderRepo(t, folder)
+	repo.Keys = keyring
+	anna := &testEntity{ID: uuid.New(), Name: "Anna", Email: "anna@example.com", Age: 30}
+	saveTestEntities(t, repo, anna)
+
+	data, err := os.ReadFile(filepath.Join(folder, "test.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(data, []byte("Anna")) || !bytes.HasPrefix(data, []byte(keyHeaderPrefix+"k1\n")) {
+		t.Fatalf("expected encrypted file, got %s", data)
+	}
+
+	reloaded := newTestFolderRepo(t, folder)
+	if _, err = reloaded.Find(ctx, anna.ID); !errors.Is(err, ErrKeysNotSet) {
+		t.Fatalf("expected keys not set, got %v", err)
+	}
+
+	reloaded = newTestFolderRepo(t, folder)
+	reloaded.Keys = keyring
+	if entity, err := reloaded.Find(ctx, anna.ID); err != nil || entity.(*testEntity).Name != "Anna" {
+		t.Fatalf("expected Anna, got %v, %v", entity, err)
+	}
+}
+
+func TestSnapshotShredding(t *testing.T) {
+	ctx := newTestContext()
+	folder := t.TempDir()
+	keyring, err := NewKeyringKeysPassphrase("k1", "secret1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := NewAggregateKeys(filepath.Join(folder, KeysFolder), keyring)
+
+	store := NewEventStore(filepath.Join(folder, EventStoreFolder))
+	store.Keys = keys
+	snapshots := NewSnapshotStore(filepath.Join(folder, SnapshotStoreFolder))
+	snapshots.Keys = keys
+
+	id := uuid.New()
+	if err = store.Save(ctx, newTestEvents(id, 1, 2), 0); err != nil {
+		t.Fatal(err)
+	}
+	if err = snapshots.SaveSnapshot(ctx, id, eh.Snapshot{
+		Version:       2,
+		AggregateType: testAggregateType,
+		State:         &testSnapshotData{Contents: []string{"content"}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if snapshot, err := snapshots.LoadSnapshot(ctx, id); err != nil ||
+		snapshot.State.(*testSnapshotData).Contents[0] != "content" {
+		t.Fatalf("expected the snapshot content, got %v, %v", snapshot, err)
+	}
+
+	if err = keys.Shred(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+	if err = filepath.Walk(folder, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err == nil && bytes.Contains(data, []byte("content")) {
+			t.Errorf("expected nothing readable of the shredded aggregate, got %v: %s", path, data)
+		}
+		return err
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened := NewSnapshotStore(filepath.Join(folder, SnapshotStoreFolder))
+	reopened.Keys = NewAggregateKeys(filepath.Join(folder, KeysFolder), keyring)
+	if _, err = reopened.LoadSnapshot(ctx, id); !errors.Is(err, encrypt.ErrKeyNotFound) {
+		t.Fatalf("expected key not found for the snapshot of the shredded aggregate, got %v", err)
+	}
+}
@@ -0,0 +1,511 @@
+package filestore
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/go-ee/utils/ehu"
+	"github.com/go-ee/utils/eio"
+	"github.com/go-ee/utils/encrypt"
+	"github.com/google/uuid"
+	eh "github.com/looplab/eventhorizon"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// logFileName is the global, ordered and append only log of all events of a namespace.
+// Each line references an event in the aggregate events file by offset and length.
+const logFileName = "events.log"
+
+type dbLogEntry struct {
+	Position    int64     `json:"position"`
+	AggregateID uuid.UUID `json:"aggregate_id"`
+	Version     int       `json:"version"`
+	Offset      int64     `json:"offset"`
+	Length      int       `json:"length"`
+}
+
+// LastPosition returns the position of the last event in the event log of the namespace, 0 if there are no events.
+func (s *EventStore) LastPosition(ctx context.Context) (ret int64, err error) {
+	var namespaceFolder string
+	if namespaceFolder, err = s.buildFolderName(ctx); err != nil {
+		return ret, ehu.NewErrCouldNotLoadAggregate(ctx, err)
+	}
+
+	var lock *fileLock
+	if lock, err = s.openNamespace(ctx, namespaceFolder); err != nil {
+		return
+	}
+	defer lock.Unlock()
+
+	var lastEntry *dbLogEntry
+	if lastEntry, err = loadLastLogEntry(ctx, buildLogFileName(namespaceFolder)); err == nil && lastEntry != nil {
+		ret = lastEntry.Position
+	}
+	return
+}
+
+// LoadAllFrom streams all events of the namespace, across all aggregates, in the order they were saved,
+// starting with the position. The streaming stops on the first error of handle.
+func (s *EventStore) LoadAllFrom(
+	ctx context.Context, position int64, handle func(position int64, event eh.Event) error) (err error) {
+
+	err = s.loadLogFrom(ctx, &logCursor{}, position, handle)
+	return
+}
+
+// logCursor is the byte offset in the event log after the last read entry, and the position of the entry.
+type logCursor struct {
+	offset   int64
+	position int64
+}
+
+// loadLogFrom streams the events like LoadAllFrom, reading the event log from the cursor, which is moved
+// after each read entry. A cursor, which doesn't point to the entry after its position anymore, because
+// the log was rewritten by maintenance or rebuilt, is reset to the start of the log.
+func (s *EventStore) loadLogFrom(ctx context.Context, cursor *logCursor, position int64,
+	handle func(position int64, event eh.Event) error) (err error) {
+
+	var namespaceFolder string
+	if namespaceFolder, err = s.buildFolderName(ctx); err != nil {
+		return ehu.NewErrCouldNotLoadAggregate(ctx, err)
+	}
+
+	// the lock is only held to determine the completely written part of the log,
+	// so that handle is able to save events
+	var lock *fileLock
+	if lock, err = s.openNamespace(ctx, namespaceFolder); err != nil {
+		return
+	}
+	var logFile *os.File
+	var logSize int64
+	if logFile, err = os.Open(buildLogFileName(namespaceFolder)); err == nil {
+		logSize, err = fileSize(logFile)
+	}
+	lock.Unlock()
+
+	if err != nil {
+		if os.IsNotExist(err) {
+			*cursor = logCursor{}
+			err = nil
+		} else {
+			err = ehu.NewErrCouldNotLoadAggregate(ctx, err)
+		}
+		if logFile != nil {
+			logFile.Close()
+		}
+		return
+	}
+	defer logFile.Close()
+
+	if !validLogCursor(logFile, logSize, cursor) {
+		*cursor = logCursor{}
+	}
+
+	aggregateFiles := map[uuid.UUID]*os.File{}
+	aggregateCodecs := map[uuid.UUID]Codec{}
+	defer func() {
+		for _, file := range aggregateFiles {
+			file.Close()
+		}
+	}()
+
+	scanner := bufio.NewScanner(io.NewSectionReader(logFile, cursor.offset, logSize-cursor.offset))
+	for scanner.Scan() {
+		next := cursor.offset + int64(len(scanner.Bytes())) + 1
+		if len(scanner.Bytes()) == 0 {
+			cursor.offset = next
+			continue
+		}
+		entry := dbLogEntry{}
+		if err = json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return ehu.NewErrCouldNotUnmarshalEvent(ctx, err)
+		}
+		if entry.Position < position {
+			cursor.offset, cursor.position = next, entry.Position
+			continue
+		}
+
+		aggregateFile := aggregateFiles[entry.AggregateID]
+		if aggregateFile == nil {
+			if aggregateFile, err = os.Open(buildEventsFileName(namespaceFolder, entry.AggregateID)); err != nil {
+				return ehu.NewErrCouldNotLoadAggregate(ctx, err)
+			}
+			aggregateFiles[entry.AggregateID] = aggregateFile
+			if aggregateCodecs[entry.AggregateID], _, err = s.readFileCodec(aggregateFile); err != nil {
+				return ehu.NewErrCouldNotLoadAggregate(ctx, err)
+			}
+		}
+
+		var event *dbEvent
+		if event, err = readLogEntryEvent(ctx, aggregateCodecs[entry.AggregateID], aggregateFile, &entry); err != nil {
+			// the events of crypto-shredded aggregates are skipped
+			if errors.Is(err, encrypt.ErrKeyNotFound) {
+				cursor.offset, cursor.position = next, entry.Position
+				err = nil
+				continue
+			}
+			return
+		}
+		if err = handle(entry.Position, event); err != nil {
+			return
+		}
+		cursor.offset, cursor.position = next, entry.Position
+	}
+	if err = scanner.Err(); err != nil {
+		err = ehu.NewErrCouldNotLoadAggregate(ctx, err)
+	}
+	return
+}
+
+// validLogCursor checks, that the cursor is at the end of the log or at the entry after its position.
+func validLogCursor(logFile *os.File, logSize int64, cursor *logCursor) bool {
+	if cursor.offset == 0 || cursor.offset == logSize {
+		return true
+	}
+	if cursor.offset > logSize {
+		return false
+	}
+	line, err := bufio.NewReader(io.NewSectionReader(logFile, cursor.offset, logSize-cursor.offset)).ReadBytes('\n')
+	if err != nil {
+		return false
+	}
+	entry := dbLogEntry{}
+	return json.Unmarshal(line, &entry) == nil && entry.Position == cursor.position+1
+}
+
+// Subscribe streams all events from the position like LoadAllFrom and then tails the event log for new events,
+// until the context is done or handle returns an error. Events saved by this store are handled immediately,
+// events of other processes with the PollInterval. The log is read from the byte offset of the last read entry.
+func (s *EventStore) Subscribe(
+	ctx context.Context, position int64, handle func(position int64, event eh.Event) error) (err error) {
+
+	cursor := &logCursor{}
+	for {
+		changed := s.changes()
+		if err = s.loadLogFrom(ctx, cursor, position, func(current int64, event eh.Event) (handleErr error) {
+			if handleErr = handle(current, event); handleErr == nil {
+				position = current + 1
+			}
+			return
+		}); err != nil {
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-changed:
+		case <-time.After(s.PollInterval):
+		}
+	}
+}
+
+// RebuildLog recreates the event log of the namespace from the aggregate events files,
+// ordered by the event timestamps. Positions of a previous log are not kept,
+// so the acknowledgement of the Outbox is removed and all events are dispatched again.
+func (s *EventStore) RebuildLog(ctx context.Context) (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var namespaceFolder string
+	if namespaceFolder, err = s.buildFolderName(ctx); err != nil {
+		return ehu.NewErrCouldNotSaveAggregate(ctx, err)
+	}
+
+	var lock *fileLock
+	if lock, err = s.lockNamespace(ctx, namespaceFolder, true); err != nil {
+		return
+	}
+	defer lock.Unlock()
+
+	for _, fileName := range []string{buildLogFileName(namespaceFolder), filepath.Join(namespaceFolder, outboxAckFileName)} {
+		if err = os.Remove(fileName); err != nil && !os.IsNotExist(err) {
+			return ehu.NewErrCouldNotSaveAggregate(ctx, err)
+		}
+	}
+	err = s.ensureLog(ctx, namespaceFolder)
+	return
+}
+
+// ensureLog builds the event log for namespaces, which were created before the event log was introduced.
+func (s *EventStore) ensureLog(ctx context.Context, namespaceFolder string) (err error) {
+	if _, err = os.Stat(buildLogFileName(namespaceFolder)); err == nil || !os.IsNotExist(err) {
+		return
+	}
+	err = s.appendMissingToLog(ctx, namespaceFolder, nil)
+	return
+}
+
+type logKey struct {
+	aggregateID uuid.UUID
+	version     int
+}
+
+// appendMissingToLog appends the events of all aggregate events files, which are not logged yet,
+// ordered by the event timestamps to the event log.
+func (s *EventStore) appendMissingToLog(
+	ctx context.Context, namespaceFolder string, logged map[logKey]bool) (err error) {
+
+	var ids []uuid.UUID
+	if ids, err = listAggregateIds(namespaceFolder); err != nil || len(ids) == 0 {
+		return
+	}
+
+	var entries []dbLogEntry
+	var timestamps []time.Time
+	for _, id := range ids {
+		if err = scanAggregateFile(ctx, buildEventsFileName(namespaceFolder, id),
+			func(header *dbEventHeader, offset int64, length int) error {
+				if !logged[logKey{aggregateID: id, version: header.Version}] {
+					entries = append(entries, dbLogEntry{
+						AggregateID: id, Version: header.Version, Offset: offset, Length: length})
+					timestamps = append(timestamps, header.Timestamp)
+				}
+				return nil
+			}); err != nil {
+			return
+		}
+	}
+	if len(entries) == 0 {
+		return
+	}
+
+	indexes := make([]int, len(entries))
+	for i := range indexes {
+		indexes[i] = i
+	}
+	sort.SliceStable(indexes, func(i, j int) bool {
+		a, b := indexes[i], indexes[j]
+		if !timestamps[a].Equal(timestamps[b]) {
+			return timestamps[a].Before(timestamps[b])
+		}
+		if entries[a].AggregateID != entries[b].AggregateID {
+			return entries[a].AggregateID.String() < entries[b].AggregateID.String()
+		}
+		return entries[a].Version < entries[b].Version
+	})
+
+	sorted := make([]dbLogEntry, len(entries))
+	for i, index := range indexes {
+		sorted[i] = entries[index]
+	}
+	err = s.appendLog(ctx, namespaceFolder, sorted)
+	return
+}
+
+// loadLogged returns the keys of all events in the event log.
+func loadLogged(ctx context.Context, logFileName string) (ret map[logKey]bool, err error) {
+	ret = map[logKey]bool{}
+
+	var logFile *os.File
+	if logFile, err = os.Open(logFileName); err != nil {
+		if os.IsNotExist(err) {
+			err = nil
+		} else {
+			err = ehu.NewErrCouldNotLoadAggregate(ctx, err)
+		}
+		return
+	}
+	defer logFile.Close()
+
+	scanner := bufio.NewScanner(logFile)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		entry := dbLogEntry{}
+		if err = json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, ehu.NewErrCouldNotUnmarshalEvent(ctx, err)
+		}
+		ret[logKey{aggregateID: entry.AggregateID, version: entry.Version}] = true
+	}
+	if err = scanner.Err(); err != nil {
+		err = ehu.NewErrCouldNotLoadAggregate(ctx, err)
+	}
+	return
+}
+
+// appendLog assigns the next positions to the entries and appends them to the event log.
+func (s *EventStore) appendLog(ctx context.Context, namespaceFolder string, entries []dbLogEntry) (err error) {
+	logFileName := buildLogFileName(namespaceFolder)
+
+	var lastEntry *dbLogEntry
+	if lastEntry, err = loadLastLogEntry(ctx, logFileName); err != nil {
+		return
+	}
+	var position int64
+	if lastEntry != nil {
+		position = lastEntry.Position
+	}
+
+	var logFile *os.File
+	if logFile, err = os.OpenFile(logFileName, os.O_APPEND|os.O_CREATE|os.O_WRONLY, s.defaultFilePerm); err != nil {
+		return ehu.NewErrCouldNotSaveAggregate(ctx, err)
+	}
+	defer logFile.Close()
+
+	writer := bufio.NewWriter(logFile)
+	for _, entry := range entries {
+		position++
+		entry.Position = position
+
+		var data []byte
+		if data, err = json.Marshal(entry); err != nil {
+			return ehu.NewErrCouldNotMarshalEvent(ctx, err)
+		}
+		if _, err = writer.Write(append(data, '\n')); err != nil {
+			return ehu.NewErrCouldNotSaveAggregate(ctx, err)
+		}
+	}
+	if err = writer.Flush(); err != nil {
+		return ehu.NewErrCouldNotSaveAggregate(ctx, err)
+	}
+	if err = logFile.Sync(); err != nil {
+		return ehu.NewErrCouldNotSaveAggregate(ctx, err)
+	}
+	if err = logFile.Close(); err != nil {
+		err = ehu.NewErrCouldNotSaveAggregate(ctx, err)
+	}
+	return
+}
+
+func (s *EventStore) changes() <-chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.changed
+}
+
+// notifyChanged wakes up all subscriptions, must be called with the lock held.
+func (s *EventStore) notifyChanged() {
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+func loadLastLogEntry(ctx context.Context, logFileName string) (ret *dbLogEntry, err error) {
+	var logFile *os.File
+	if logFile, err = os.Open(logFileName); err != nil {
+		if os.IsNotExist(err) {
+			err = nil
+		} else {
+			err = ehu.NewErrCouldNotLoadAggregate(ctx, err)
+		}
+		return
+	}
+	defer logFile.Close()
+
+	var scanner *eio.ReverseScanner
+	if scanner, err = eio.NewReverseScannerFile(logFile); err != nil {
+		err = ehu.NewErrCouldNotLoadAggregate(ctx, err)
+		return
+	}
+
+	if !scanner.Scan() {
+		if scanner.ScanErr() != io.EOF {
+			err = ehu.NewErrCouldNotLoadAggregate(ctx, scanner.ScanErr())
+		}
+		return
+	}
+
+	ret = &dbLogEntry{}
+	if err = json.Unmarshal(scanner.Bytes(), ret); err != nil {
+		ret = nil
+		err = ehu.NewErrCouldNotUnmarshalEvent(ctx, err)
+	}
+	return
+}
+
+func readLogEntryEvent(
+	ctx context.Context, codec Codec, aggregateFile *os.File, entry *dbLogEntry) (ret *dbEvent, err error) {
+
+	data := make([]byte, entry.Length)
+	if _, err = aggregateFile.ReadAt(data, entry.Offset); err != nil {
+		err = ehu.NewErrCouldNotLoadAggregate(ctx, err)
+		return
+	}
+	ret, err = parseEvent(ctx, codec, data)
+	return
+}
+
+// dbEventHeader is the part of the dbEvent needed to index events without decoding the event data.
+type dbEventHeader struct {
+	AggregateID   uuid.UUID        `json:"aggregate_id"`
+	AggregateType eh.AggregateType `json:"aggregate_type"`
+	EventType     eh.EventType     `json:"event_type"`
+	Timestamp     time.Time        `json:"timestamp"`
+	Version       int              `json:"version"`
+}
+
+// scanAggregateFile reads the aggregate events file forward and calls handle for each event line
+// with the offset and length of the line.
+func scanAggregateFile(ctx context.Context, eventsFileName string,
+	handle func(header *dbEventHeader, offset int64, length int) error) (err error) {
+
+	var eventsFile *os.File
+	if eventsFile, err = os.Open(eventsFileName); err != nil {
+		return ehu.NewErrCouldNotLoadAggregate(ctx, err)
+	}
+	defer eventsFile.Close()
+
+	reader := bufio.NewReader(eventsFile)
+	var offset int64
+	var codec Codec = JSONCodec
+	for {
+		line, readErr := reader.ReadBytes('\n')
+		lineLength := len(line)
+		if readErr != nil && readErr != io.EOF {
+			return ehu.NewErrCouldNotLoadAggregate(ctx, readErr)
+		}
+
+		if offset == 0 && isHeaderLine(line) {
+			if codec, _, err = parseCodecHeader(line); err != nil {
+				return ehu.NewErrCouldNotLoadAggregate(ctx, err)
+			}
+		} else if trimmed := bytes.TrimRight(line, "\r\n"); len(trimmed) > 0 {
+			header := &dbEventHeader{}
+			if err = decodeLine(codec, trimmed, header); err != nil {
+				return ehu.NewErrCouldNotUnmarshalEvent(ctx, err)
+			}
+			if err = handle(header, offset, len(trimmed)); err != nil {
+				return
+			}
+		}
+		offset += int64(lineLength)
+
+		if readErr == io.EOF {
+			break
+		}
+	}
+	return
+}
+
+// listAggregateIds returns the ids of all aggregates with an events file in the namespace folder.
+func listAggregateIds(namespaceFolder string) (ret []uuid.UUID, err error) {
+	var entries []os.DirEntry
+	if entries, err = os.ReadDir(namespaceFolder); err != nil {
+		if os.IsNotExist(err) {
+			err = nil
+		}
+		return
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".json") {
+			continue
+		}
+		if id, parseErr := uuid.Parse(strings.TrimSuffix(name, ".json")); parseErr == nil {
+			ret = append(ret, id)
+		}
+	}
+	return
+}
+
+func buildLogFileName(folder string) string {
+	return filepath.Join(folder, logFileName)
+}
@@ -13,16 +13,38 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"sync"
 	"time"
 )
 
+// DefaultPollInterval is the interval a subscription checks the event log for events of other processes.
+const DefaultPollInterval = time.Second
+
 type EventStore struct {
 	*Base
+	PollInterval time.Duration
+	// Codec of new aggregate events files, existing files are written with the codec of their header.
+	Codec Codec
+	// Keys encrypt the events, if set.
+	Keys Keys
+	// ReadOnly opens the namespaces without the recovery and without creating files, e.g. for the inspection
+	// of the files as they are or of backups, saving fails with ErrReadOnly.
+	ReadOnly bool
+
+	mu      sync.Mutex
+	changed chan struct{}
+
+	recoverMu sync.Mutex
+	recovered map[string]bool
 }
 
 func NewEventStore(folder string) *EventStore {
 	return &EventStore{
-		Base: NewBase(folder),
+		Base:         NewBase(folder),
+		PollInterval: DefaultPollInterval,
+		Codec:        CompactJSONCodec,
+		changed:      make(chan struct{}),
+		recovered:    map[string]bool{},
 	}
 }
 
@@ -33,23 +55,48 @@ func (s *EventStore) Save(ctx context.Context, events []eh.Event, originalVersio
 			Err: fmt.Errorf("no events to append for '%v'", namespace.FromContext(ctx)),
 		}
 	}
+	if s.ReadOnly {
+		return ehu.NewErrCouldNotSaveAggregate(ctx, ErrReadOnly)
+	}
 
-	namespaceFolder := s.buildFolderName(ctx)
+	var namespaceFolder string
+	if namespaceFolder, err = s.buildFolderName(ctx); err != nil {
+		return ehu.NewErrCouldNotSaveAggregate(ctx, err)
+	}
 	if err = os.MkdirAll(namespaceFolder, s.defaultFolderPerm); err != nil {
 		return ehu.NewErrCouldNotSaveAggregate(ctx, err)
 	}
 
+	// the version check, the append and the event log positions must not interleave,
+	// neither in this process nor with other processes sharing the folder
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err = s.recoverNamespace(ctx, namespaceFolder); err != nil {
+		return
+	}
+
+	var lock *fileLock
+	if lock, err = s.lockNamespace(ctx, namespaceFolder, true); err != nil {
+		return
+	}
+	defer lock.Unlock()
+
+	if err = s.ensureLog(ctx, namespaceFolder); err != nil {
+		return
+	}
+
 	firstEvent := events[0]
 	aggregateId := firstEvent.AggregateID()
 
 	aggregateEventsFileName := buildEventsFileName(namespaceFolder, aggregateId)
-	if err = checkAggregateVersion(ctx, aggregateEventsFileName, originalVersion); err != nil {
+	if err = s.checkAggregateVersion(ctx, aggregateEventsFileName, originalVersion); err != nil {
 		return
 	}
 
 	var aggregateEventsFile *os.File
 	if aggregateEventsFile, err =
-		os.OpenFile(aggregateEventsFileName, os.O_APPEND|os.O_CREATE|os.O_WRONLY, s.defaultFilePerm); err != nil {
+		os.OpenFile(aggregateEventsFileName, os.O_APPEND|os.O_CREATE|os.O_RDWR, s.defaultFilePerm); err != nil {
 		return ehu.NewErrCouldNotSaveAggregate(ctx, err)
 	}
 	defer aggregateEventsFile.Close()
@@ -79,21 +126,67 @@ func (s *EventStore) Save(ctx context.Context, events []eh.Event, originalVersio
 		dbEvents[i] = *e
 	}
 
+	var offset int64
+	if offset, err = fileSize(aggregateEventsFile); err != nil {
+		return ehu.NewErrCouldNotSaveAggregate(ctx, err)
+	}
+
 	aggregateEventsWriter := bufio.NewWriter(aggregateEventsFile)
 
-	for _, dbEvent := range dbEvents {
-		if err := writeEvent(ctx, dbEvent, aggregateEventsWriter); err != nil {
-			return err
+	var codec Codec
+	if offset == 0 {
+		header := codecHeader(s.Codec)
+		if _, err = aggregateEventsWriter.Write(header); err != nil {
+			return ehu.NewErrCouldNotSaveAggregate(ctx, err)
+		}
+		offset += int64(len(header))
+		codec = s.fileCodec(s.Codec)
+	} else if codec, _, err = s.readFileCodec(aggregateEventsFile); err != nil {
+		return ehu.NewErrCouldNotLoadAggregate(ctx, err)
+	}
+
+	logEntries := make([]dbLogEntry, len(dbEvents))
+	for i, dbEvent := range dbEvents {
+		var length int
+		if length, err = writeEvent(ctx, codec, dbEvent, aggregateEventsWriter); err != nil {
+			return
 		}
+		logEntries[i] = dbLogEntry{
+			AggregateID: dbEvent.AggregateID_,
+			Version:     dbEvent.Version_,
+			Offset:      offset,
+			Length:      length,
+		}
+		offset += int64(length) + 1
+	}
+	if err = aggregateEventsWriter.Flush(); err != nil {
+		return ehu.NewErrCouldNotSaveAggregate(ctx, err)
+	}
+	if err = aggregateEventsFile.Sync(); err != nil {
+		return ehu.NewErrCouldNotSaveAggregate(ctx, err)
+	}
+	if err = aggregateEventsFile.Close(); err != nil {
+		return ehu.NewErrCouldNotSaveAggregate(ctx, err)
 	}
-	err = aggregateEventsWriter.Flush()
-	err = aggregateEventsFile.Close()
 
+	if err = s.appendLog(ctx, namespaceFolder, logEntries); err != nil {
+		return
+	}
+	s.notifyChanged()
 	return
 }
 
 func (s *EventStore) Load(ctx context.Context, id uuid.UUID) (ret []eh.Event, err error) {
-	namespaceFolder := s.buildFolderName(ctx)
+	var namespaceFolder string
+	if namespaceFolder, err = s.buildFolderName(ctx); err != nil {
+		return nil, ehu.NewErrCouldNotLoadAggregate(ctx, err)
+	}
+
+	var lock *fileLock
+	if lock, err = s.openNamespace(ctx, namespaceFolder); err != nil {
+		return
+	}
+	defer lock.Unlock()
 
 	eventsFileName := buildEventsFileName(namespaceFolder, id)
 	var eventsFile *os.File
@@ -107,6 +200,12 @@ func (s *EventStore) Load(ctx context.Context, id uuid.UUID) (ret []eh.Event, er
 	}
 	defer eventsFile.Close()
 
+	var codec Codec
+	if codec, _, err = s.readFileCodec(eventsFile); err != nil {
+		err = ehu.NewErrCouldNotLoadAggregate(ctx, err)
+		return
+	}
+
 	eventIndex := 0
 	scanner, err := eio.NewReverseScannerFile(eventsFile)
 	if err != nil {
@@ -121,26 +220,39 @@ func (s *EventStore) Load(ctx context.Context, id uuid.UUID) (ret []eh.Event, er
 		err = ehu.NewErrCouldNotLoadAggregate(ctx, err)
 		return
 	}
+	if isHeaderLine(scanner.Bytes()) {
+		return s.noEvents()
+	}
 
 	var lastEvent *dbEvent
-	if lastEvent, err = parseEvent(ctx, scanner.Bytes()); err != nil {
+	if lastEvent, err = parseEvent(ctx, codec, scanner.Bytes()); err != nil {
 		return
 	}
 	ret = make([]eh.Event, lastEvent.Version())
 	eventIndex = lastEvent.Version() - 1
 	ret[eventIndex] = lastEvent
 
-	for scanner.Scan() {
+	for scanner.Scan() && !isHeaderLine(scanner.Bytes()) {
 		eventIndex -= 1
-		if ret[eventIndex], err = parseEvent(ctx, scanner.Bytes()); err != nil {
+		if ret[eventIndex], err = parseEvent(ctx, codec, scanner.Bytes()); err != nil {
 			return
 		}
 	}
 	return
 }
 
+// LoadFrom loads all events from version for the aggregate id from the store.
 func (s *EventStore) LoadFrom(ctx context.Context, id uuid.UUID, version int) (ret []eh.Event, err error) {
-	namespaceFolder := s.buildFolderName(ctx)
+	var namespaceFolder string
+	if namespaceFolder, err = s.buildFolderName(ctx); err != nil {
+		return nil, ehu.NewErrCouldNotLoadAggregate(ctx, err)
+	}
+
+	var lock *fileLock
+	if lock, err = s.openNamespace(ctx, namespaceFolder); err != nil {
+		return
+	}
+	defer lock.Unlock()
 
 	eventsFileName := buildEventsFileName(namespaceFolder, id)
 	var eventsFile *os.File
@@ -154,6 +266,12 @@ func (s *EventStore) LoadFrom(ctx context.Context, id uuid.UUID, version int) (r
 	}
 	defer eventsFile.Close()
 
+	var codec Codec
+	if codec, _, err = s.readFileCodec(eventsFile); err != nil {
+		err = ehu.NewErrCouldNotLoadAggregate(ctx, err)
+		return
+	}
+
 	eventIndex := 0
 	scanner, err := eio.NewReverseScannerFile(eventsFile)
 	if err != nil {
@@ -168,22 +286,29 @@ func (s *EventStore) LoadFrom(ctx context.Context, id uuid.UUID, version int) (r
 		err = ehu.NewErrCouldNotLoadAggregate(ctx, err)
 		return
 	}
+	if isHeaderLine(scanner.Bytes()) {
+		return s.noEvents()
+	}
 
 	var lastEvent *dbEvent
-	if lastEvent, err = parseEvent(ctx, scanner.Bytes()); err != nil {
+	if lastEvent, err = parseEvent(ctx, codec, scanner.Bytes()); err != nil {
 		return
 	}
-	ret = make([]eh.Event, lastEvent.Version())
-	eventIndex = lastEvent.Version() - 1
+	if version < 1 {
+		version = 1
+	}
+	if lastEvent.Version() < version {
+		return s.noEvents()
+	}
+	ret = make([]eh.Event, lastEvent.Version()-version+1)
+	eventIndex = len(ret) - 1
 	ret[eventIndex] = lastEvent
 
-	for scanner.Scan() {
+	// read backwards only until the requested version is reached
+	for eventIndex > 0 && scanner.Scan() && !isHeaderLine(scanner.Bytes()) {
 		eventIndex -= 1
-		if ret[eventIndex], err = parseEvent(ctx, scanner.Bytes()); err != nil {
-			break
-		}
-		if eventIndex == version {
-			break
+		if ret[eventIndex], err = parseEvent(ctx, codec, scanner.Bytes()); err != nil {
+			return
 		}
 	}
 	return
@@ -193,23 +318,28 @@ func (s *EventStore) noEvents() ([]eh.Event, error) {
 	return []eh.Event{}, nil
 }
 
-/*
-func (s *EventStore) Replace(ctx context.Context, event ehu.Event) error {
-	return nil
-}
-
-func (s *EventStore) RenameEvent(ctx context.Context, from, to ehu.EventType) error {
-	return nil
-}
-*/
+// Clear removes all events of the namespace, the events of nested namespaces are kept.
+func (s *EventStore) Clear(ctx context.Context) (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-func (s *EventStore) Clear(ctx context.Context) error {
-	if err := os.RemoveAll(s.buildFolderName(ctx)); err != nil {
+	var namespaceFolder string
+	if s.ReadOnly {
+		err = ErrReadOnly
+	} else if namespaceFolder, err = s.buildFolderName(ctx); err == nil {
+		err = removeNamespaceFiles(namespaceFolder)
+	}
+	if err != nil {
 		return &eh.EventStoreError{
-			Err: fmt.Errorf("%v: %v", ehu.ErrCouldNotClearDB, err),
+			Err: fmt.Errorf("%w: %w", ehu.ErrCouldNotClearDB, err),
 		}
 	}
-	return nil
+
+	s.recoverMu.Lock()
+	delete(s.recovered, namespaceFolder)
+	s.recoverMu.Unlock()
+	s.notifyChanged()
+	return
 }
 
 func (s *EventStore) Close() error {
@@ -217,26 +347,22 @@ func (s *EventStore) Close() error {
 	return nil
 }
 
-func (s *EventStore) buildFolderName(ctx context.Context) string {
-	return filepath.Join(s.folder, namespace.FromContext(ctx))
-}
-
-func scanLastEvent(ctx context.Context, scanner *eio.ReverseScanner) (ret *dbEvent, err error) {
+func scanLastEvent(ctx context.Context, codec Codec, scanner *eio.ReverseScanner) (ret *dbEvent, err error) {
 	if !scanner.Scan() {
 		if scanner.ScanErr() != io.EOF {
 			err = ehu.NewErrCouldNotLoadAggregate(ctx, scanner.ScanErr())
 		}
-	} else {
-		ret, err = parseEvent(ctx, scanner.Bytes())
+	} else if !isHeaderLine(scanner.Bytes()) {
+		ret, err = parseEvent(ctx, codec, scanner.Bytes())
 	}
 	return
 }
 
-func checkAggregateVersion(
+func (s *EventStore) checkAggregateVersion(
 	ctx context.Context, eventsFileName string, originalVersion int) (err error) {
 
 	var lastEvent *dbEvent
-	if lastEvent, err = loadLastEvent(ctx, eventsFileName); err != nil {
+	if lastEvent, err = s.loadLastEvent(ctx, eventsFileName); err != nil {
 		return ehu.NewErrCouldNotLoadAggregate(ctx, err)
 	}
 	var aggregateVersion int
@@ -257,54 +383,74 @@ func checkAggregateVersion(
 	return
 }
 
-func loadLastEvent(ctx context.Context, eventsFileName string) (ret *dbEvent, err error) {
+func (s *EventStore) loadLastEvent(ctx context.Context, eventsFileName string) (ret *dbEvent, err error) {
 	var aggregateEventsFile *os.File
 	if aggregateEventsFile, err = os.Open(eventsFileName); err != nil {
 		return nil, nil
 	}
 	defer aggregateEventsFile.Close()
 
+	var codec Codec
+	if codec, _, err = s.readFileCodec(aggregateEventsFile); err != nil {
+		err = ehu.NewErrCouldNotLoadAggregate(ctx, err)
+		return
+	}
+
 	var scanner *eio.ReverseScanner
 	if scanner, err = eio.NewReverseScannerFile(aggregateEventsFile); err != nil {
 		err = ehu.NewErrCouldNotLoadAggregate(ctx, err)
 		return
 	}
 
-	ret, err = scanLastEvent(ctx, scanner)
+	ret, err = scanLastEvent(ctx, codec, scanner)
 	return
 }
 
-func writeEvent(ctx context.Context, dbEvent dbEvent, aggregateEventsWriter *bufio.Writer) error {
-	if bytes, err := json.Marshal(dbEvent); err == nil {
-		if _, err = aggregateEventsWriter.Write(bytes); err != nil {
-			return ehu.NewErrCouldNotSaveAggregate(ctx, err)
-		} else {
-			if _, err = aggregateEventsWriter.WriteString("\n"); err != nil {
-				return ehu.NewErrCouldNotSaveAggregate(ctx, err)
-			}
-		}
-	} else {
-		return ehu.NewErrCouldNotMarshalEvent(ctx, err)
+// writeEvent writes the event as a line and returns the length of the line without the line break.
+func writeEvent(ctx context.Context, codec Codec, dbEvent dbEvent, aggregateEventsWriter *bufio.Writer) (int, error) {
+	bytes, err := encodeEventLine(ctx, codec, &dbEvent)
+	if err != nil {
+		return 0, ehu.NewErrCouldNotMarshalEvent(ctx, err)
 	}
-	return nil
+	if _, err = aggregateEventsWriter.Write(bytes); err != nil {
+		return 0, ehu.NewErrCouldNotSaveAggregate(ctx, err)
+	}
+	if _, err = aggregateEventsWriter.WriteString("\n"); err != nil {
+		return 0, ehu.NewErrCouldNotSaveAggregate(ctx, err)
+	}
+	return len(bytes), nil
+}
+
+func fileSize(file *os.File) (ret int64, err error) {
+	var fi os.FileInfo
+	if fi, err = file.Stat(); err == nil {
+		ret = fi.Size()
+	}
+	return
 }
 
-func parseEvent(ctx context.Context, data []byte) (ret *dbEvent, err error) {
-	dbEventType := dbEventType{}
-	if err = json.Unmarshal(data, &dbEventType); err != nil {
+// parseEvent decodes the event line, the event data is upcast to the current schema version before decoding.
+func parseEvent(ctx context.Context, codec Codec, data []byte) (ret *dbEvent, err error) {
+	var record *dbEventRecord
+	if record, err = parseEventRecord(ctx, codec, data); err != nil {
+		return
+	}
+	if err = record.decodeData(codec); err != nil {
 		err = ehu.NewErrCouldNotUnmarshalEvent(ctx, err)
 		return
 	}
+	ret = &record.dbEvent
+	return
+}
 
-	dbEvent := dbEvent{}
-
-	if eventData, eventDataErr := eh.CreateEventData(dbEventType.EventType); eventDataErr == nil {
-		dbEvent.Data_ = eventData
+// parseEventRecord decodes and decrypts the event line without decoding the event data.
+func parseEventRecord(ctx context.Context, codec Codec, data []byte) (ret *dbEventRecord, err error) {
+	ret = &dbEventRecord{}
+	if err = decodeLine(codec, data, ret); err == nil {
+		ret, err = openEventRecord(ctx, codec, ret)
 	}
-
-	if err = json.Unmarshal(data, &dbEvent); err == nil {
-		ret = &dbEvent
-	} else {
+	if err != nil {
+		ret = nil
 		err = ehu.NewErrCouldNotUnmarshalEvent(ctx, err)
 	}
 	return
@@ -313,10 +459,6 @@ func parseEvent(ctx context.Context, data []byte) (ret *dbEvent, err error) {
 // dbEvent is the internal dbEvent record for the MongoDB dbEvent store used
 // to save and load events from the DB.
 
-type dbEventType struct {
-	EventType eh.EventType `json:"event_type"`
-}
-
 type dbEvent struct {
 	AggregateID_   uuid.UUID              `json:"aggregate_id"`
 	AggregateType_ eh.AggregateType       `json:"aggregate_type"`
@@ -325,6 +467,51 @@ type dbEvent struct {
 	Version_       int                    `json:"version"`
 	Data_          interface{}            `json:"data,omitempty"`
 	Metadata_      map[string]interface{} `json:"metadata"`
+	SchemaVersion_ int                    `json:"schema_version,omitempty"`
+	KeyID_         string                 `json:"key_id,omitempty"`
+	Cipher_        []byte                 `json:"cipher,omitempty"`
+}
+
+// dbEventRecord is the dbEvent with the event data still encoded.
+type dbEventRecord struct {
+	dbEvent
+	Data_ rawData `json:"data,omitempty"`
+}
+
+// decodeData decodes the event data into the dbEvent, upcast to the current schema version.
+func (o *dbEventRecord) decodeData(codec Codec) (err error) {
+	o.dbEvent.Data_ = nil
+
+	data, unmarshal := []byte(o.Data_), codec.UnmarshalRaw
+	schemaVersion := o.SchemaVersion_
+	if schemaVersion < 1 {
+		schemaVersion = 1
+	}
+	if ehu.DefaultUpcasters.SchemaVersion(o.EventType_) > schemaVersion {
+		var jsonData json.RawMessage
+		if jsonData, err = rawToJSON(codec, o.Data_); err != nil {
+			return
+		}
+		if jsonData, o.SchemaVersion_, err = ehu.DefaultUpcasters.Upcast(o.EventType_, schemaVersion, jsonData); err != nil {
+			return
+		}
+		data, unmarshal = jsonData, json.Unmarshal
+	}
+	if rawData(data).isNull() {
+		return
+	}
+
+	if eventData, eventDataErr := eh.CreateEventData(o.EventType_); eventDataErr == nil {
+		if err = unmarshal(data, eventData); err == nil {
+			o.dbEvent.Data_ = eventData
+		}
+	} else {
+		var value interface{}
+		if err = unmarshal(data, &value); err == nil {
+			o.dbEvent.Data_ = value
+		}
+	}
+	return
 }
 
 func newDbEvent(ehEvent eh.Event) (ret *dbEvent, err error) {
@@ -336,6 +523,7 @@ func newDbEvent(ehEvent eh.Event) (ret *dbEvent, err error) {
 		Version_:       ehEvent.Version(),
 		Data_:          ehEvent.Data(),
 		Metadata_:      ehEvent.Metadata(),
+		SchemaVersion_: ehu.DefaultUpcasters.SchemaVersion(ehEvent.EventType()),
 	}
 	return
 }
@@ -0,0 +1,275 @@
+package filestore
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/namespace"
+)
+
+const testAggregateType eh.AggregateType = "TestAggregate"
+const testEventType eh.EventType = "TestEvent"
+
+type testEventData struct {
+	Content string
+}
+
+type testSnapshotData struct {
+	Contents []string
+}
+
+func init() {
+	eh.RegisterEventData(testEventType, func() eh.EventData { return &testEventData{} })
+	eh.RegisterSnapshotData(testAggregateType, func(id uuid.UUID) eh.SnapshotData { return &testSnapshotData{} })
+}
+
+func newTestContext() context.Context {
+	return namespace.NewContext(context.Background(), "test")
+}
+
+func newTestEvents(id uuid.UUID, fromVersion int, count int) (ret []eh.Event) {
+	for i := 0; i < count; i++ {
+		ret = append(ret, eh.NewEvent(testEventType, &testEventData{Content: "content"}, time.Now(),
+			eh.ForAggregate(testAggregateType, id, fromVersion+i)))
+	}
+	return
+}
+
+func buildTestEventsFileName(t *testing.T, ctx context.Context, store *EventStore, id uuid.UUID) string {
+	namespaceFolder, err := store.buildFolderName(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buildEventsFileName(namespaceFolder, id)
+}
+
+func TestEventStoreSaveLoad(t *testing.T) {
+	ctx := newTestContext()
+	store := NewEventStore(t.TempDir())
+	id := uuid.New()
+
+	if err := store.Save(ctx, newTestEvents(id, 1, 3), 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Save(ctx, newTestEvents(id, 4, 2), 3); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Save(ctx, newTestEvents(id, 4, 1), 3); err == nil {
+		t.Fatal("expected version conflict")
+	}
+
+	events, err := store.Load(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 5 {
+		t.Fatalf("expected 5 events, got %v", len(events))
+	}
+
+	if events, err = store.LoadFrom(ctx, id, 4); err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 || events[0].Version() != 4 || events[1].Version() != 5 {
+		t.Fatalf("expected events 4 and 5, got %v", events)
+	}
+	if data, ok := events[0].Data().(*testEventData); !ok || data.Content != "content" {
+		t.Fatalf("unexpected event data %v", events[0].Data())
+	}
+
+	if events, err = store.LoadFrom(ctx, id, 6); err != nil || len(events) != 0 {
+		t.Fatalf("expected no events, got %v, %v", events, err)
+	}
+}
+
+func TestSnapshotStore(t *testing.T) {
+	ctx := newTestContext()
+	store := NewSnapshotStore(t.TempDir())
+	id := uuid.New()
+
+	if snapshot, err := store.LoadSnapshot(ctx, id); err != nil || snapshot != nil {
+		t.Fatalf("expected no snapshot, got %v, %v", snapshot, err)
+	}
+
+	if err := store.SaveSnapshot(ctx, id, eh.Snapshot{
+		Version:       3,
+		AggregateType: testAggregateType,
+		State:         &testSnapshotData{Contents: []string{"a", "b"}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	snapshot, err := store.LoadSnapshot(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snapshot.Version != 3 {
+		t.Fatalf("expected version 3, got %v", snapshot.Version)
+	}
+	if state, ok := snapshot.State.(*testSnapshotData); !ok || len(state.Contents) != 2 {
+		t.Fatalf("unexpected snapshot state %v", snapshot.State)
+	}
+}
+
+func TestEventStoreLog(t *testing.T) {
+	ctx := newTestContext()
+	store := NewEventStore(t.TempDir())
+	id1, id2 := uuid.New(), uuid.New()
+
+	if err := store.Save(ctx, newTestEvents(id1, 1, 2), 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Save(ctx, newTestEvents(id2, 1, 1), 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Save(ctx, newTestEvents(id1, 3, 1), 2); err != nil {
+		t.Fatal(err)
+	}
+
+	if last, err := store.LastPosition(ctx); err != nil || last != 4 {
+		t.Fatalf("expected last position 4, got %v, %v", last, err)
+	}
+
+	var positions []int64
+	var ids []uuid.UUID
+	if err := store.LoadAllFrom(ctx, 2, func(position int64, event eh.Event) error {
+		positions = append(positions, position)
+		ids = append(ids, event.AggregateID())
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if len(positions) != 3 || positions[0] != 2 || ids[1] != id2 || ids[2] != id1 {
+		t.Fatalf("unexpected events from position 2, %v, %v", positions, ids)
+	}
+
+	if err := store.RebuildLog(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if last, err := store.LastPosition(ctx); err != nil || last != 4 {
+		t.Fatalf("expected last position 4 after rebuild, got %v, %v", last, err)
+	}
+}
+
+func TestEventStoreSubscribe(t *testing.T) {
+	ctx, cancel := context.WithTimeout(newTestContext(), 5*time.Second)
+	defer cancel()
+
+	store := NewEventStore(t.TempDir())
+	id := uuid.New()
+	if err := store.Save(ctx, newTestEvents(id, 1, 1), 0); err != nil {
+		t.Fatal(err)
+	}
+
+	received := make(chan int64, 10)
+	done := make(chan error)
+	go func() {
+		done <- store.Subscribe(ctx, 1, func(position int64, event eh.Event) error {
+			received <- position
+			return nil
+		})
+	}()
+
+	if position := <-received; position != 1 {
+		t.Fatalf("expected position 1, got %v", position)
+	}
+	if err := store.Save(ctx, newTestEvents(id, 2, 1), 1); err != nil {
+		t.Fatal(err)
+	}
+	if position := <-received; position != 2 {
+		t.Fatalf("expected position 2, got %v", position)
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEventStoreLogCursor(t *testing.T) {
+	ctx := newTestContext()
+	store := NewEventStore(t.TempDir())
+	id := uuid.New()
+	if err := store.Save(ctx, newTestEvents(id, 1, 2), 0); err != nil {
+		t.Fatal(err)
+	}
+
+	var positions []int64
+	collect := func(position int64, event eh.Event) error {
+		positions = append(positions, position)
+		return nil
+	}
+	cursor := &logCursor{}
+	if err := store.loadLogFrom(ctx, cursor, 1, collect); err != nil || len(positions) != 2 || cursor.position != 2 {
+		t.Fatalf("expected positions 1 and 2, got %v, %v", positions, err)
+	}
+
+	// the entries before the cursor are not read again
+	namespaceFolder, err := store.buildFolderName(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logFile, err := os.OpenFile(buildLogFileName(namespaceFolder), os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = logFile.WriteAt([]byte("#"), 0); err != nil {
+		t.Fatal(err)
+	}
+	logFile.Close()
+	if err = store.Save(ctx, newTestEvents(id, 3, 1), 2); err != nil {
+		t.Fatal(err)
+	}
+	positions = nil
+	if err = store.loadLogFrom(ctx, cursor, 3, collect); err != nil || len(positions) != 1 || positions[0] != 3 {
+		t.Fatalf("expected position 3, got %v, %v", positions, err)
+	}
+
+	// a cursor, which doesn't point to the next entry, is reset
+	if err = store.RebuildLog(ctx); err != nil {
+		t.Fatal(err)
+	}
+	positions = nil
+	cursor = &logCursor{offset: 10, position: 1}
+	if err = store.loadLogFrom(ctx, cursor, 2, collect); err != nil || len(positions) != 2 || positions[0] != 2 {
+		t.Fatalf("expected positions 2 and 3, got %v, %v", positions, err)
+	}
+}
+
+func TestEventStoreRecoverTornLine(t *testing.T) {
+	ctx := newTestContext()
+	folder := t.TempDir()
+	id := uuid.New()
+
+	if err := NewEventStore(folder).Save(ctx, newTestEvents(id, 1, 2), 0); err != nil {
+		t.Fatal(err)
+	}
+
+	// simulate a crash while appending the third event
+	store := NewEventStore(folder)
+	eventsFile, err := os.OpenFile(buildTestEventsFileName(t, ctx, store, id), os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = eventsFile.WriteString(`{"aggregate_id":"` + id.String() + `","vers`); err != nil {
+		t.Fatal(err)
+	}
+	eventsFile.Close()
+
+	events, err := store.Load(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("expected 2 events, got %v", len(events))
+	}
+	if err = store.Save(ctx, newTestEvents(id, 3, 1), 2); err != nil {
+		t.Fatal(err)
+	}
+	if last, err := store.LastPosition(ctx); err != nil || last != 3 {
+		t.Fatalf("expected last position 3, got %v, %v", last, err)
+	}
+}
@@ -0,0 +1,262 @@
+package filestore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/go-ee/utils/ehu"
+	"github.com/go-ee/utils/lg"
+	"github.com/google/uuid"
+	"github.com/jinzhu/copier"
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/namespace"
+)
+
+// ErrUniqueIndexViolation is when an entity is saved with a value of a unique index, which another entity has.
+var ErrUniqueIndexViolation = errors.New("unique index violation")
+
+// ErrIndexNotFound is when a lookup is done for a field without index.
+var ErrIndexNotFound = errors.New("index not found")
+
+// repoIndex maps the values of an entity field to the ids of the entities.
+type repoIndex struct {
+	field  string
+	unique bool
+
+	// The outer map is with namespace as key, the inner with the index key.
+	entries map[string]map[string][]uuid.UUID
+}
+
+// AddIndex declares an index for the entity field, the field is resolved like for queries,
+// by the struct field name or the json name and nested fields separated by '.'.
+// For unique indexes, saving an entity with a non-zero value of another entity fails.
+// The index is built for all namespaces already loaded, and for other namespaces on loading.
+// Violations of unique indexes in the loaded entities, e.g. of an index added later, don't fail the loading,
+// they are logged and reported by the lookups of the value. Change or remove the duplicates to repair them.
+func (r *Repo) AddIndex(field string, unique bool) (err error) {
+	r.dbMu.Lock()
+	defer r.dbMu.Unlock()
+
+	index := &repoIndex{field: field, unique: unique, entries: map[string]map[string][]uuid.UUID{}}
+	for ns := range r.db {
+		if err = index.build(ns, r.ids[ns], r.db[ns]); err != nil {
+			return
+		}
+	}
+	r.indexes[strings.ToLower(field)] = index
+	return
+}
+
+// FindBy returns the entities with the value of the indexed field, in the order they were indexed.
+// The value must have the type of the field, e.g. int for an int field.
+func (r *Repo) FindBy(ctx context.Context, field string, value interface{}) (ret []eh.Entity, err error) {
+	var ns string
+	var index *repoIndex
+	if ns, index, err = r.lookupIndex(ctx, field); err != nil {
+		return
+	}
+	defer r.dbMu.RUnlock()
+
+	ids := index.entries[ns][indexKey(reflect.ValueOf(value))]
+	if index.unique && len(ids) > 1 {
+		err = &eh.RepoError{
+			Err:      fmt.Errorf("%w: %v=%v, %v", ErrUniqueIndexViolation, field, value, namespace.FromContext(ctx)),
+			Op:       eh.RepoOpFindQuery,
+			EntityID: ids[1],
+		}
+		return
+	}
+	ret = make([]eh.Entity, 0, len(ids))
+	for _, id := range ids {
+		if item, ok := r.db[ns][id]; ok {
+			entity := r.factoryFn()
+			if err = copier.Copy(entity, item); err != nil {
+				return
+			}
+			ret = append(ret, entity)
+		}
+	}
+	return
+}
+
+// FindOneBy returns the first entity with the value of the indexed field, typically of a unique index.
+func (r *Repo) FindOneBy(ctx context.Context, field string, value interface{}) (ret eh.Entity, err error) {
+	var entities []eh.Entity
+	if entities, err = r.FindBy(ctx, field, value); err != nil {
+		return
+	}
+	if len(entities) == 0 {
+		err = &eh.RepoError{
+			Err: fmt.Errorf("%w: %v=%v, %v", eh.ErrEntityNotFound, field, value, namespace.FromContext(ctx)),
+			Op:  eh.RepoOpFindQuery,
+		}
+		return
+	}
+	ret = entities[0]
+	return
+}
+
+// lookupIndex returns the namespace and the index with the read lock held, if there is no error.
+func (r *Repo) lookupIndex(ctx context.Context, field string) (ns string, ret *repoIndex, err error) {
+	if r.factoryFn == nil {
+		err = &eh.RepoError{
+			Err: fmt.Errorf("%v: %v", ErrModelNotSet, namespace.FromContext(ctx)),
+			Op:  eh.RepoOpFindQuery,
+		}
+		return
+	}
+
+	if ns, err = r.readNamespace(ctx); err != nil {
+		return
+	}
+	var ok bool
+	if ret, ok = r.indexes[strings.ToLower(field)]; !ok {
+		r.dbMu.RUnlock()
+		err = &eh.RepoError{
+			Err: fmt.Errorf("%w: %v, %v", ErrIndexNotFound, field, namespace.FromContext(ctx)),
+			Op:  eh.RepoOpFindQuery,
+		}
+	}
+	return
+}
+
+// checkIndexes verifies the unique indexes for the entity to save.
+func (r *Repo) checkIndexes(ctx context.Context, ns string, entity eh.Entity) (err error) {
+	for _, index := range r.indexes {
+		if !index.unique {
+			continue
+		}
+		key, zero, keyErr := index.key(entity)
+		if keyErr != nil {
+			return &eh.RepoError{
+				Err:      fmt.Errorf("could not index %v, %w: %v", index.field, keyErr, namespace.FromContext(ctx)),
+				Op:       eh.RepoOpSave,
+				EntityID: entity.EntityID(),
+			}
+		}
+		if zero {
+			continue
+		}
+		for _, id := range index.entries[ns][key] {
+			if id != entity.EntityID() {
+				return &eh.RepoError{
+					Err:      fmt.Errorf("%w: %v=%v, %v", ErrUniqueIndexViolation, index.field, key, namespace.FromContext(ctx)),
+					Op:       eh.RepoOpSave,
+					EntityID: entity.EntityID(),
+				}
+			}
+		}
+	}
+	return
+}
+
+func (r *Repo) indexEntity(ns string, previous eh.Entity, entity eh.Entity) {
+	for _, index := range r.indexes {
+		index.update(ns, previous, entity)
+	}
+}
+
+func (r *Repo) clearIndexes(ns string) {
+	for _, index := range r.indexes {
+		delete(index.entries, ns)
+	}
+}
+
+// buildIndexes builds the indexes of the entities of the namespace, on errors the indexes of the namespace are cleared.
+func (r *Repo) buildIndexes(ns string, ids []uuid.UUID, db map[uuid.UUID]eh.Entity) (err error) {
+	for _, index := range r.indexes {
+		if err = index.build(ns, ids, db); err != nil {
+			r.clearIndexes(ns)
+			break
+		}
+	}
+	return
+}
+
+func (o *repoIndex) build(ns string, ids []uuid.UUID, db map[uuid.UUID]eh.Entity) (err error) {
+	o.entries[ns] = map[string][]uuid.UUID{}
+	for _, id := range ids {
+		if entity, ok := db[id]; ok {
+			var key string
+			var zero bool
+			if key, zero, err = o.key(entity); err != nil {
+				return
+			}
+			if o.unique && !zero && len(o.entries[ns][key]) > 0 {
+				lg.LOG.Warnf("%v: %v=%v of %v, %v", ErrUniqueIndexViolation, o.field, key, id, ns)
+			}
+			o.entries[ns][key] = append(o.entries[ns][key], id)
+		}
+	}
+	return
+}
+
+// update moves the entity id from the key of the previous entity to the key of the entity,
+// previous or entity may be nil for inserts and removes.
+func (o *repoIndex) update(ns string, previous eh.Entity, entity eh.Entity) {
+	entries := o.entries[ns]
+	if entries == nil {
+		entries = map[string][]uuid.UUID{}
+		o.entries[ns] = entries
+	}
+
+	var previousKey, key string
+	var previousErr, keyErr error
+	if previous != nil {
+		previousKey, _, previousErr = o.key(previous)
+	}
+	if entity != nil {
+		key, _, keyErr = o.key(entity)
+	}
+	if previous != nil && entity != nil && previousErr == nil && keyErr == nil && previousKey == key {
+		return
+	}
+
+	if previous != nil && previousErr == nil {
+		ids := entries[previousKey]
+		for i, id := range ids {
+			if id == previous.EntityID() {
+				ids = append(ids[:i], ids[i+1:]...)
+				break
+			}
+		}
+		if len(ids) == 0 {
+			delete(entries, previousKey)
+		} else {
+			entries[previousKey] = ids
+		}
+	}
+	if entity != nil && keyErr == nil {
+		entries[key] = append(entries[key], entity.EntityID())
+	}
+}
+
+func (o *repoIndex) key(entity eh.Entity) (ret string, zero bool, err error) {
+	var value reflect.Value
+	if value, err = ehu.FieldValue(entity, o.field); err == nil {
+		ret = indexKey(value)
+		zero = !value.IsValid() || value.IsZero()
+	}
+	return
+}
+
+// indexKey is the key of the value with its type, so that e.g. the int 1 and the string "1" differ.
+func indexKey(value reflect.Value) string {
+	for value.IsValid() && (value.Kind() == reflect.Ptr || value.Kind() == reflect.Interface) {
+		if value.IsNil() {
+			return ""
+		}
+		value = value.Elem()
+	}
+	if !value.IsValid() {
+		return ""
+	}
+	if t, ok := value.Interface().(time.Time); ok {
+		return value.Type().String() + ":" + t.UTC().Format(time.RFC3339Nano)
+	}
+	return value.Type().String() + ":" + fmt.Sprint(value.Interface())
+}
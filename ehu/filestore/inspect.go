@@ -0,0 +1,249 @@
+package filestore
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/go-ee/utils/ehu"
+	"github.com/google/uuid"
+	eh "github.com/looplab/eventhorizon"
+)
+
+// AggregateInfo is the summary of the events of an aggregate, read from the plain headers of the events,
+// so also of encrypted events without keys.
+type AggregateInfo struct {
+	ID            uuid.UUID        `json:"id"`
+	AggregateType eh.AggregateType `json:"aggregate_type"`
+	Version       int              `json:"version"`
+	Events        int              `json:"events"`
+	Created       time.Time        `json:"created"`
+	Updated       time.Time        `json:"updated"`
+	Codec         string           `json:"codec"`
+}
+
+// VerifyIssue is a problem found by Verify, in the line of a file of the namespace folder.
+type VerifyIssue struct {
+	File        string    `json:"file"`
+	Line        int       `json:"line"`
+	AggregateID uuid.UUID `json:"aggregate_id,omitempty"`
+	Message     string    `json:"message"`
+}
+
+func (o *VerifyIssue) String() string {
+	return fmt.Sprintf("%v:%v: %v", o.File, o.Line, o.Message)
+}
+
+// Aggregates returns the summaries of the aggregates of the namespace, ordered by creation.
+// The files are read as they are, without the recovery of the namespace.
+func (s *EventStore) Aggregates(ctx context.Context) (ret []*AggregateInfo, err error) {
+	var namespaceFolder string
+	var lock *fileLock
+	if namespaceFolder, lock, err = s.inspectNamespace(ctx); err != nil || lock == nil {
+		return
+	}
+	defer lock.Unlock()
+
+	var ids []uuid.UUID
+	if ids, err = listAggregateIds(namespaceFolder); err != nil {
+		return nil, ehu.NewErrCouldNotLoadAggregate(ctx, err)
+	}
+	for _, id := range ids {
+		info := &AggregateInfo{ID: id, Codec: JSONCodec.Name()}
+		if err = inspectAggregateFile(buildEventsFileName(namespaceFolder, id),
+			func(codec Codec) {
+				info.Codec = codec.Name()
+			},
+			func(line int, header *dbEventHeader, lineErr error) {
+				if lineErr != nil {
+					return
+				}
+				if info.Events == 0 {
+					info.Created = header.Timestamp
+				}
+				info.Events++
+				info.AggregateType = header.AggregateType
+				info.Version = header.Version
+				info.Updated = header.Timestamp
+			}); err != nil {
+			return nil, ehu.NewErrCouldNotLoadAggregate(ctx, err)
+		}
+		ret = append(ret, info)
+	}
+	sort.SliceStable(ret, func(i, j int) bool {
+		return ret[i].Created.Before(ret[j].Created)
+	})
+	return
+}
+
+// Verify checks the files of the namespace and returns the issues: corrupt or torn lines,
+// gaps in the versions of the aggregates and entries of the event log, which don't match the events.
+// The files are read as they are, without the recovery of the namespace.
+func (s *EventStore) Verify(ctx context.Context) (ret []*VerifyIssue, err error) {
+	var namespaceFolder string
+	var lock *fileLock
+	if namespaceFolder, lock, err = s.inspectNamespace(ctx); err != nil || lock == nil {
+		return
+	}
+	defer lock.Unlock()
+
+	var ids []uuid.UUID
+	if ids, err = listAggregateIds(namespaceFolder); err != nil {
+		return nil, ehu.NewErrCouldNotLoadAggregate(ctx, err)
+	}
+
+	events := map[logKey]bool{}
+	for _, id := range ids {
+		fileName := buildEventsFileName(namespaceFolder, id)
+		version := 0
+		if err = inspectAggregateFile(fileName, nil, func(line int, header *dbEventHeader, lineErr error) {
+			issue := &VerifyIssue{File: fileName, Line: line, AggregateID: id}
+			switch {
+			case lineErr != nil:
+				issue.Message = lineErr.Error()
+			case header.AggregateID != id:
+				issue.Message = fmt.Sprintf("event of aggregate %v", header.AggregateID)
+			case header.Version != version+1:
+				issue.Message = fmt.Sprintf("version %v after version %v", header.Version, version)
+			}
+			if header != nil && header.AggregateID == id {
+				version = header.Version
+				events[logKey{aggregateID: id, version: header.Version}] = true
+			}
+			if issue.Message != "" {
+				ret = append(ret, issue)
+			}
+		}); err != nil {
+			return nil, ehu.NewErrCouldNotLoadAggregate(ctx, err)
+		}
+	}
+
+	var logIssues []*VerifyIssue
+	if logIssues, err = verifyLog(namespaceFolder, events); err == nil {
+		ret = append(ret, logIssues...)
+	} else {
+		err = ehu.NewErrCouldNotLoadAggregate(ctx, err)
+	}
+	return
+}
+
+// inspectNamespace acquires the shared lock of the namespace, the lock is nil if the namespace doesn't exist.
+func (s *EventStore) inspectNamespace(ctx context.Context) (namespaceFolder string, lock *fileLock, err error) {
+	if namespaceFolder, err = s.buildFolderName(ctx); err != nil {
+		err = ehu.NewErrCouldNotLoadAggregate(ctx, err)
+		return
+	}
+	lock, err = s.lockNamespace(ctx, namespaceFolder, false)
+	return
+}
+
+// verifyLog checks the positions of the event log and that each entry references an event, once,
+// and returns the events missing in the log.
+func verifyLog(namespaceFolder string, events map[logKey]bool) (ret []*VerifyIssue, err error) {
+	logFileName := buildLogFileName(namespaceFolder)
+	logged := map[logKey]bool{}
+	var position int64
+	if err = inspectLines(logFileName, func(line int, data []byte, torn bool) {
+		issue := &VerifyIssue{File: logFileName, Line: line}
+		entry := dbLogEntry{}
+		if torn {
+			issue.Message = "torn line"
+		} else if jsonErr := json.Unmarshal(data, &entry); jsonErr != nil {
+			issue.Message = jsonErr.Error()
+		} else {
+			key := logKey{aggregateID: entry.AggregateID, version: entry.Version}
+			issue.AggregateID = entry.AggregateID
+			switch {
+			case entry.Position != position+1:
+				issue.Message = fmt.Sprintf("position %v after position %v", entry.Position, position)
+			case !events[key]:
+				issue.Message = fmt.Sprintf("entry of the missing event %v@%v", entry.AggregateID, entry.Version)
+			case logged[key]:
+				issue.Message = fmt.Sprintf("duplicate entry of the event %v@%v", entry.AggregateID, entry.Version)
+			}
+			position = entry.Position
+			logged[key] = true
+		}
+		if issue.Message != "" {
+			ret = append(ret, issue)
+		}
+	}); err != nil {
+		if !os.IsNotExist(err) {
+			return
+		}
+		err = nil
+	}
+
+	var missing []*VerifyIssue
+	for key := range events {
+		if !logged[key] {
+			missing = append(missing, &VerifyIssue{File: logFileName, AggregateID: key.aggregateID,
+				Message: fmt.Sprintf("event %v@%v missing in the event log", key.aggregateID, key.version)})
+		}
+	}
+	sort.Slice(missing, func(i, j int) bool {
+		return missing[i].Message < missing[j].Message
+	})
+	ret = append(ret, missing...)
+	return
+}
+
+// inspectAggregateFile decodes the headers of the events of the file, the errors of the lines are passed to handle.
+func inspectAggregateFile(fileName string, handleCodec func(codec Codec),
+	handle func(line int, header *dbEventHeader, err error)) (err error) {
+
+	var codec Codec = JSONCodec
+	err = inspectLines(fileName, func(line int, data []byte, torn bool) {
+		if line == 1 && isHeaderLine(data) {
+			var headerErr error
+			if codec, _, headerErr = parseCodecHeader(append(data, '\n')); headerErr != nil {
+				codec = JSONCodec
+				handle(line, nil, headerErr)
+			} else if handleCodec != nil {
+				handleCodec(codec)
+			}
+			return
+		}
+		if torn {
+			handle(line, nil, fmt.Errorf("torn line"))
+			return
+		}
+		header := &dbEventHeader{}
+		if decodeErr := decodeLine(codec, data, header); decodeErr != nil {
+			handle(line, nil, decodeErr)
+		} else {
+			handle(line, header, nil)
+		}
+	})
+	return
+}
+
+// inspectLines calls handle for each not empty line, torn is the last line without line break.
+func inspectLines(fileName string, handle func(line int, data []byte, torn bool)) (err error) {
+	var file *os.File
+	if file, err = os.Open(fileName); err != nil {
+		return
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	for line := 1; ; line++ {
+		data, readErr := reader.ReadBytes('\n')
+		if readErr != nil && readErr != io.EOF {
+			return readErr
+		}
+		torn := readErr == io.EOF
+		if trimmed := bytes.TrimRight(data, "\r\n"); len(trimmed) > 0 {
+			handle(line, trimmed, torn)
+		}
+		if torn {
+			return
+		}
+	}
+}
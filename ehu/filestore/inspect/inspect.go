@@ -0,0 +1,390 @@
+// Package inspect provides the commands to inspect the folders of the filestore.EventStore:
+// list the namespaces and aggregates, dump the events of an aggregate, tail the event log and verify the files.
+// The maintenance commands migrate and rename the events.
+package inspect
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/go-ee/utils/cliu"
+	"github.com/go-ee/utils/ehu/filestore"
+	"github.com/google/uuid"
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/namespace"
+	"github.com/urfave/cli/v2"
+)
+
+const (
+	FormatTable = "table"
+	FormatJSON  = "json"
+)
+
+// EventStoreCmd is the "eventstore" command with the inspection sub commands.
+type EventStoreCmd struct {
+	*cliu.BaseCommand
+	Folder     *cliu.StringFlag
+	Namespace  *cliu.StringFlag
+	Format     *cliu.StringFlag
+	KeyID      *cliu.StringFlag
+	Passphrase *cliu.StringFlag
+	KeysFolder *cliu.StringFlag
+}
+
+func NewEventStoreCmd(common *cliu.CommonFlags) (ret *EventStoreCmd) {
+	ret = &EventStoreCmd{
+		Folder: cliu.NewStringFlag(&cli.StringFlag{
+			Name:     "folder",
+			Usage:    "The folder of the event store",
+			Required: true,
+		}),
+		Namespace: cliu.NewStringFlag(&cli.StringFlag{
+			Name:  "namespace",
+			Usage: "The namespace of the events",
+			Value: namespace.DefaultNamespace,
+		}),
+		Format: cliu.NewStringFlag(&cli.StringFlag{
+			Name:  "format",
+			Usage: "The output format, table or json",
+			Value: FormatTable,
+		}),
+		KeyID: cliu.NewStringFlag(&cli.StringFlag{
+			Name:  "keyId",
+			Usage: "The key id of the passphrase of encrypted events",
+		}),
+		Passphrase: cliu.NewStringFlag(&cli.StringFlag{
+			Name:    "passphrase",
+			Usage:   "The passphrase of encrypted events",
+			EnvVars: []string{"EVENTSTORE_PASSPHRASE"},
+		}),
+		KeysFolder: cliu.NewStringFlag(&cli.StringFlag{
+			Name:  "keysFolder",
+			Usage: "The folder of the aggregate keys of encrypted events, wrapped by the passphrase",
+		}),
+	}
+
+	ret.BaseCommand = cliu.NewBaseCommand(common, &cli.Command{
+		Name:  "eventstore",
+		Usage: "Inspect the folder of a file event store",
+		Flags: []cli.Flag{ret.Folder, ret.Namespace, ret.KeyID, ret.Passphrase, ret.KeysFolder},
+	},
+		ret.newNamespacesCmd(common),
+		ret.newAggregatesCmd(common),
+		ret.newDumpCmd(common),
+		ret.newTailCmd(common),
+		ret.newVerifyCmd(common),
+		ret.newMigrateCmd(common),
+		ret.newRenameCmd(common))
+	return
+}
+
+func (o *EventStoreCmd) newNamespacesCmd(common *cliu.CommonFlags) *cliu.BaseCommand {
+	return cliu.NewBaseCommand(common, &cli.Command{
+		Name:  "namespaces",
+		Usage: "List the namespaces",
+		Action: func(c *cli.Context) (err error) {
+			var store *filestore.EventStore
+			if store, err = o.eventStore(); err != nil {
+				return
+			}
+			var names []string
+			if names, err = filestore.NewNamespaces(store, nil).List(); err == nil {
+				for _, name := range names {
+					fmt.Fprintln(c.App.Writer, name)
+				}
+			}
+			return
+		},
+	})
+}
+
+func (o *EventStoreCmd) newAggregatesCmd(common *cliu.CommonFlags) *cliu.BaseCommand {
+	return cliu.NewBaseCommand(common, &cli.Command{
+		Name:  "aggregates",
+		Usage: "List the aggregates of the namespace",
+		Flags: []cli.Flag{o.Format},
+		Action: func(c *cli.Context) (err error) {
+			var store *filestore.EventStore
+			if store, err = o.formattedEventStore(); err != nil {
+				return
+			}
+			var aggregates []*filestore.AggregateInfo
+			if aggregates, err = store.Aggregates(o.context(c)); err != nil {
+				return
+			}
+			if o.Format.CurrentValue == FormatJSON {
+				return writeJSON(c.App.Writer, aggregates)
+			}
+			return writeTable(c.App.Writer, []string{"ID", "TYPE", "VERSION", "EVENTS", "CREATED", "UPDATED", "CODEC"},
+				func(row func(values ...interface{})) {
+					for _, item := range aggregates {
+						row(item.ID, item.AggregateType, item.Version, item.Events,
+							formatTime(item.Created), formatTime(item.Updated), item.Codec)
+					}
+				})
+		},
+	})
+}
+
+func (o *EventStoreCmd) newDumpCmd(common *cliu.CommonFlags) *cliu.BaseCommand {
+	id := cliu.NewStringFlag(&cli.StringFlag{
+		Name:     "id",
+		Usage:    "The id of the aggregate",
+		Required: true,
+	})
+	return cliu.NewBaseCommand(common, &cli.Command{
+		Name:  "dump",
+		Usage: "Dump the events of an aggregate",
+		Flags: []cli.Flag{id, o.Format},
+		Action: func(c *cli.Context) (err error) {
+			var aggregateID uuid.UUID
+			if aggregateID, err = uuid.Parse(id.CurrentValue); err != nil {
+				return
+			}
+			var store *filestore.EventStore
+			if store, err = o.formattedEventStore(); err != nil {
+				return
+			}
+			var events []eh.Event
+			if events, err = store.Load(o.context(c), aggregateID); err != nil {
+				return
+			}
+
+			records := make([]*eventRecord, len(events))
+			for i, event := range events {
+				records[i] = newEventRecord(0, event)
+			}
+			if o.Format.CurrentValue == FormatJSON {
+				return writeJSON(c.App.Writer, records)
+			}
+			return writeEventsTable(c.App.Writer, false, records)
+		},
+	})
+}
+
+func (o *EventStoreCmd) newTailCmd(common *cliu.CommonFlags) *cliu.BaseCommand {
+	from := cliu.NewIntFlag(&cli.IntFlag{
+		Name:  "from",
+		Usage: "The position in the event log to start with, 0 for the events saved after the start",
+	})
+	return cliu.NewBaseCommand(common, &cli.Command{
+		Name:  "tail",
+		Usage: "Print the events of the namespace as they are saved, until interrupted",
+		Flags: []cli.Flag{from, o.Format},
+		Action: func(c *cli.Context) (err error) {
+			var store *filestore.EventStore
+			if store, err = o.formattedEventStore(); err != nil {
+				return
+			}
+			ctx := o.context(c)
+			position := int64(from.CurrentValue)
+			if position <= 0 {
+				if position, err = store.LastPosition(ctx); err != nil {
+					return
+				}
+				position++
+			}
+			return store.Subscribe(ctx, position, func(current int64, event eh.Event) error {
+				record := newEventRecord(current, event)
+				if o.Format.CurrentValue == FormatJSON {
+					return json.NewEncoder(c.App.Writer).Encode(record)
+				}
+				return writeEventsTable(c.App.Writer, true, []*eventRecord{record})
+			})
+		},
+	})
+}
+
+func (o *EventStoreCmd) newVerifyCmd(common *cliu.CommonFlags) *cliu.BaseCommand {
+	return cliu.NewBaseCommand(common, &cli.Command{
+		Name:  "verify",
+		Usage: "Verify the version continuity of the aggregates and the event log, report gaps and corrupt lines",
+		Flags: []cli.Flag{o.Format},
+		Action: func(c *cli.Context) (err error) {
+			var store *filestore.EventStore
+			if store, err = o.formattedEventStore(); err != nil {
+				return
+			}
+			var issues []*filestore.VerifyIssue
+			if issues, err = store.Verify(o.context(c)); err != nil {
+				return
+			}
+			if o.Format.CurrentValue == FormatJSON {
+				err = writeJSON(c.App.Writer, issues)
+			} else {
+				for _, issue := range issues {
+					fmt.Fprintln(c.App.Writer, issue)
+				}
+			}
+			if err == nil && len(issues) > 0 {
+				err = fmt.Errorf("%v issues found", len(issues))
+			}
+			return
+		},
+	})
+}
+
+func (o *EventStoreCmd) newMigrateCmd(common *cliu.CommonFlags) *cliu.BaseCommand {
+	return cliu.NewBaseCommand(common, &cli.Command{
+		Name: "migrate",
+		Usage: "Rewrite the events of older schema versions with the data upcast by the upcasters " +
+			"registered by the application, offline only",
+		Action: func(c *cli.Context) (err error) {
+			var store *filestore.EventStore
+			if store, err = o.writableEventStore(); err != nil {
+				return
+			}
+			var migrated int
+			if migrated, err = store.Migrate(o.context(c)); err == nil {
+				fmt.Fprintf(c.App.Writer, "%v events migrated\n", migrated)
+			}
+			return
+		},
+	})
+}
+
+func (o *EventStoreCmd) newRenameCmd(common *cliu.CommonFlags) *cliu.BaseCommand {
+	from := cliu.NewStringFlag(&cli.StringFlag{
+		Name:     "from",
+		Usage:    "The event type to rename",
+		Required: true,
+	})
+	to := cliu.NewStringFlag(&cli.StringFlag{
+		Name:     "to",
+		Usage:    "The new event type",
+		Required: true,
+	})
+	return cliu.NewBaseCommand(common, &cli.Command{
+		Name:  "rename",
+		Usage: "Rename the event type of the events, offline only",
+		Flags: []cli.Flag{from, to},
+		Action: func(c *cli.Context) (err error) {
+			var store *filestore.EventStore
+			if store, err = o.writableEventStore(); err != nil {
+				return
+			}
+			err = store.RenameEvent(o.context(c), eh.EventType(from.CurrentValue), eh.EventType(to.CurrentValue))
+			return
+		},
+	})
+}
+
+// formattedEventStore returns the event store for the commands with the format flag.
+func (o *EventStoreCmd) formattedEventStore() (ret *filestore.EventStore, err error) {
+	if o.Format.CurrentValue != FormatTable && o.Format.CurrentValue != FormatJSON {
+		return nil, fmt.Errorf("unsupported format '%v'", o.Format.CurrentValue)
+	}
+	return o.eventStore()
+}
+
+// writableEventStore returns the event store for the maintenance commands, which recovers torn lines.
+func (o *EventStoreCmd) writableEventStore() (ret *filestore.EventStore, err error) {
+	if ret, err = o.eventStore(); err == nil {
+		ret.ReadOnly = false
+	}
+	return
+}
+
+func (o *EventStoreCmd) eventStore() (ret *filestore.EventStore, err error) {
+	ret = filestore.NewEventStore(o.Folder.CurrentValue)
+	ret.ReadOnly = true
+	if o.Passphrase.CurrentValue != "" {
+		if o.KeyID.CurrentValue == "" {
+			return nil, fmt.Errorf("the key id of the passphrase is required")
+		}
+		var keyring *filestore.KeyringKeys
+		if keyring, err = filestore.NewKeyringKeysPassphrase(o.KeyID.CurrentValue, o.Passphrase.CurrentValue); err != nil {
+			return
+		}
+		if o.KeysFolder.CurrentValue != "" {
+			ret.Keys = filestore.NewAggregateKeys(o.KeysFolder.CurrentValue, keyring)
+		} else {
+			ret.Keys = keyring
+		}
+	}
+	return
+}
+
+func (o *EventStoreCmd) context(c *cli.Context) context.Context {
+	return namespace.NewContext(c.Context, o.Namespace.CurrentValue)
+}
+
+// eventRecord is the output of an event.
+type eventRecord struct {
+	Position      int64                  `json:"position,omitempty"`
+	AggregateID   uuid.UUID              `json:"aggregate_id"`
+	AggregateType eh.AggregateType       `json:"aggregate_type"`
+	EventType     eh.EventType           `json:"event_type"`
+	Version       int                    `json:"version"`
+	Timestamp     time.Time              `json:"timestamp"`
+	Data          eh.EventData           `json:"data,omitempty"`
+	Metadata      map[string]interface{} `json:"metadata,omitempty"`
+}
+
+func newEventRecord(position int64, event eh.Event) *eventRecord {
+	return &eventRecord{
+		Position:      position,
+		AggregateID:   event.AggregateID(),
+		AggregateType: event.AggregateType(),
+		EventType:     event.EventType(),
+		Version:       event.Version(),
+		Timestamp:     event.Timestamp(),
+		Data:          event.Data(),
+		Metadata:      event.Metadata(),
+	}
+}
+
+func writeEventsTable(writer io.Writer, tail bool, records []*eventRecord) error {
+	var header []string
+	if !tail {
+		header = []string{"VERSION", "TIMESTAMP", "TYPE", "DATA"}
+	}
+	return writeTable(writer, header, func(row func(values ...interface{})) {
+		for _, record := range records {
+			data, _ := json.Marshal(record.Data)
+			if tail {
+				row(record.Position, record.AggregateID, record.Version, formatTime(record.Timestamp),
+					record.EventType, string(data))
+			} else {
+				row(record.Version, formatTime(record.Timestamp), record.EventType, string(data))
+			}
+		}
+	})
+}
+
+func writeTable(writer io.Writer, header []string, rows func(row func(values ...interface{}))) error {
+	tableWriter := tabwriter.NewWriter(writer, 0, 4, 2, ' ', 0)
+	if len(header) > 0 {
+		for i, column := range header {
+			if i > 0 {
+				fmt.Fprint(tableWriter, "\t")
+			}
+			fmt.Fprint(tableWriter, column)
+		}
+		fmt.Fprintln(tableWriter)
+	}
+	rows(func(values ...interface{}) {
+		for i, value := range values {
+			if i > 0 {
+				fmt.Fprint(tableWriter, "\t")
+			}
+			fmt.Fprint(tableWriter, value)
+		}
+		fmt.Fprintln(tableWriter)
+	})
+	return tableWriter.Flush()
+}
+
+func writeJSON(writer io.Writer, value interface{}) error {
+	encoder := json.NewEncoder(writer)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(value)
+}
+
+func formatTime(value time.Time) string {
+	return value.Format(time.RFC3339)
+}
@@ -0,0 +1,111 @@
+package inspect
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-ee/utils/cliu"
+	"github.com/go-ee/utils/ehu/filestore"
+	"github.com/google/uuid"
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/namespace"
+	"github.com/urfave/cli/v2"
+)
+
+func runApp(t *testing.T, args ...string) (output string, err error) {
+	var buffer bytes.Buffer
+	app := &cli.App{
+		Name:     "test",
+		Writer:   &buffer,
+		Commands: []*cli.Command{NewEventStoreCmd(cliu.NewCommonFlags()).Command},
+	}
+	err = app.Run(append([]string{"test"}, args...))
+	return buffer.String(), err
+}
+
+func TestEventStoreCmd(t *testing.T) {
+	ctx := namespace.NewContext(context.Background(), "tenant")
+	folder := t.TempDir()
+	store := filestore.NewEventStore(folder)
+	id := uuid.New()
+	for version := 1; version <= 2; version++ {
+		event := eh.NewEvent("InspectEvent", nil, time.Now(), eh.ForAggregate("Inspect", id, version))
+		if err := store.Save(ctx, []eh.Event{event}, version-1); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if output, err := runApp(t, "eventstore", "--folder", folder, "namespaces"); err != nil ||
+		strings.TrimSpace(output) != "tenant" {
+		t.Fatalf("expected tenant namespace, got %q, %v", output, err)
+	}
+
+	output, err := runApp(t, "eventstore", "--folder", folder, "--namespace", "tenant", "aggregates")
+	if err != nil || !strings.Contains(output, id.String()) || !strings.Contains(output, "Inspect") {
+		t.Fatalf("expected aggregate table, got %q, %v", output, err)
+	}
+
+	output, err = runApp(t, "eventstore", "--folder", folder, "--namespace", "tenant",
+		"dump", "--id", id.String(), "--format", "json")
+	var records []*eventRecord
+	if err != nil || json.Unmarshal([]byte(output), &records) != nil || len(records) != 2 || records[1].Version != 2 {
+		t.Fatalf("expected 2 events, got %q, %v", output, err)
+	}
+
+	if output, err = runApp(t, "eventstore", "--folder", folder, "--namespace", "tenant", "verify"); err != nil {
+		t.Fatalf("expected no issues, got %q, %v", output, err)
+	}
+
+	if _, err = runApp(t, "eventstore", "--folder", folder, "--namespace", "tenant",
+		"rename", "--from", "InspectEvent", "--to", "RenamedEvent"); err != nil {
+		t.Fatal(err)
+	}
+	if events, err := store.Load(ctx, id); err != nil || events[0].EventType() != "RenamedEvent" {
+		t.Fatalf("expected renamed events, got %v, %v", events, err)
+	}
+	if output, err = runApp(t, "eventstore", "--folder", folder, "--namespace", "tenant", "migrate"); err != nil ||
+		strings.TrimSpace(output) != "0 events migrated" {
+		t.Fatalf("expected no migrated events, got %q, %v", output, err)
+	}
+
+	// a corrupt line and a gap of the versions
+	eventsFile, err := os.OpenFile(filepath.Join(folder, "tenant", id.String()+".json"), os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	line := `{"aggregate_id":"` + id.String() + `","aggregate_type":"Inspect","event_type":"InspectEvent","version":4}`
+	if _, err = eventsFile.WriteString("{corrupt\n" + line + "\n"); err != nil {
+		t.Fatal(err)
+	}
+	eventsFile.Close()
+
+	output, err = runApp(t, "eventstore", "--folder", folder, "--namespace", "tenant", "verify")
+	if err == nil || !strings.Contains(output, ":3: ") || !strings.Contains(output, "version 4 after version 2") ||
+		!strings.Contains(output, "missing in the event log") {
+		t.Fatalf("expected issues, got %q, %v", output, err)
+	}
+
+	// the inspection keeps a torn line
+	eventsFileName := filepath.Join(folder, "tenant", id.String()+".json")
+	if eventsFile, err = os.OpenFile(eventsFileName, os.O_APPEND|os.O_WRONLY, 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = eventsFile.WriteString(`{"aggregate_id":`); err != nil {
+		t.Fatal(err)
+	}
+	eventsFile.Close()
+	_, _ = runApp(t, "eventstore", "--folder", folder, "--namespace", "tenant", "dump", "--id", id.String())
+	if data, _ := os.ReadFile(eventsFileName); !strings.HasSuffix(string(data), `{"aggregate_id":`) {
+		t.Fatalf("expected the torn line kept, got %q", data)
+	}
+	if output, err = runApp(t, "eventstore", "--folder", folder, "--namespace", "tenant", "verify"); err == nil ||
+		!strings.Contains(output, ":5: torn line") {
+		t.Fatalf("expected the torn line reported, got %q, %v", output, err)
+	}
+}
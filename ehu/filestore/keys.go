@@ -0,0 +1,279 @@
+package filestore
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/go-ee/utils/eio"
+	"github.com/go-ee/utils/encrypt"
+	"github.com/google/uuid"
+)
+
+// Keys provides the encryptors of the stores by key id, the key id is recorded with each encrypted record.
+type Keys interface {
+	// ActiveKey returns the key for new records of the aggregate, uuid.Nil is for records of no aggregate.
+	ActiveKey(ctx context.Context, aggregateID uuid.UUID) (keyID string, encryptor *encrypt.Encryptor, err error)
+	// Key returns the encryptor of the key id, the error is encrypt.ErrKeyNotFound if the key doesn't exist.
+	Key(ctx context.Context, keyID string) (*encrypt.Encryptor, error)
+}
+
+// KeyringKeys uses the keys of the keyring for all aggregates.
+type KeyringKeys struct {
+	*encrypt.Keyring
+}
+
+func NewKeyringKeys() *KeyringKeys {
+	return &KeyringKeys{Keyring: encrypt.NewKeyring()}
+}
+
+// NewKeyringKeysPassphrase creates the keys with the encryptor of the passphrase as active key.
+func NewKeyringKeysPassphrase(keyID string, passphrase string) (ret *KeyringKeys, err error) {
+	var keyring *encrypt.Keyring
+	if keyring, err = encrypt.NewKeyringPassphrase(keyID, passphrase); err == nil {
+		ret = &KeyringKeys{Keyring: keyring}
+	}
+	return
+}
+
+func (o *KeyringKeys) ActiveKey(_ context.Context, _ uuid.UUID) (string, *encrypt.Encryptor, error) {
+	return o.Keyring.Active()
+}
+
+func (o *KeyringKeys) Key(_ context.Context, keyID string) (*encrypt.Encryptor, error) {
+	return o.Keyring.Key(keyID)
+}
+
+const aggregateKeyPrefix = "aggregate:"
+
+// KeyFilePerm is the permission of the key files, readable by the owner only.
+const KeyFilePerm os.FileMode = 0600
+
+// AggregateKeyKDF derives the encryption keys of the aggregate keys, they are random,
+// so that a light key derivation suffices.
+var AggregateKeyKDF = encrypt.Argon2idKDF(1, 8*1024, 1)
+
+// AggregateKeys are random keys per aggregate, stored encrypted by the keyring in a file per aggregate,
+// in a folder per namespace. Records of no aggregate are encrypted by the keyring directly.
+// Shred removes the key of an aggregate, which makes its events unreadable.
+type AggregateKeys struct {
+	*Base
+	Keyring *KeyringKeys
+
+	keys map[string]*encrypt.Encryptor
+	mu   sync.Mutex
+}
+
+func NewAggregateKeys(folder string, keyring *KeyringKeys) *AggregateKeys {
+	base := NewBase(folder)
+	base.defaultFilePerm = KeyFilePerm
+	return &AggregateKeys{
+		Base:    base,
+		Keyring: keyring,
+		keys:    map[string]*encrypt.Encryptor{},
+	}
+}
+
+func (o *AggregateKeys) ActiveKey(
+	ctx context.Context, aggregateID uuid.UUID) (keyID string, ret *encrypt.Encryptor, err error) {
+
+	if aggregateID == uuid.Nil {
+		return o.Keyring.Active()
+	}
+	keyID = aggregateKeyPrefix + aggregateID.String()
+	ret, err = o.aggregateKey(ctx, aggregateID, true)
+	return
+}
+
+func (o *AggregateKeys) Key(ctx context.Context, keyID string) (ret *encrypt.Encryptor, err error) {
+	if !strings.HasPrefix(keyID, aggregateKeyPrefix) {
+		return o.Keyring.Key(ctx, keyID)
+	}
+	var aggregateID uuid.UUID
+	if aggregateID, err = uuid.Parse(strings.TrimPrefix(keyID, aggregateKeyPrefix)); err == nil {
+		ret, err = o.aggregateKey(ctx, aggregateID, false)
+	}
+	return
+}
+
+// Shred removes the key of the aggregate, the crypto-shredding of its events for erasure,
+// and of its snapshots, if the SnapshotStore has the keys. Projections of the aggregate are not affected,
+// they must be removed separately.
+// Other processes may still decrypt with the key, until they are restarted.
+func (o *AggregateKeys) Shred(ctx context.Context, aggregateID uuid.UUID) (err error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	var namespaceFolder string
+	if namespaceFolder, err = o.buildFolderName(ctx); err != nil {
+		return
+	}
+	keyFileName := buildKeyFileName(namespaceFolder, aggregateID)
+	delete(o.keys, keyFileName)
+	if err = os.Remove(keyFileName); err != nil && os.IsNotExist(err) {
+		err = nil
+	}
+	return
+}
+
+// Clear removes the keys of all aggregates of the namespace, the crypto-shredding of the namespace.
+func (o *AggregateKeys) Clear(ctx context.Context) (err error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	var namespaceFolder string
+	if namespaceFolder, err = o.buildFolderName(ctx); err != nil {
+		return
+	}
+	for keyFileName := range o.keys {
+		if filepath.Dir(keyFileName) == namespaceFolder {
+			delete(o.keys, keyFileName)
+		}
+	}
+	err = removeNamespaceFiles(namespaceFolder)
+	return
+}
+
+// RewrapKeys encrypts the aggregate keys of the namespace by the active key of the keyring,
+// after the rotation of the keyring, and returns the count of rewrapped keys.
+func (o *AggregateKeys) RewrapKeys(ctx context.Context) (ret int, err error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	var namespaceFolder string
+	if namespaceFolder, err = o.buildFolderName(ctx); err != nil {
+		return
+	}
+	var entries []os.DirEntry
+	if entries, err = os.ReadDir(namespaceFolder); err != nil {
+		if os.IsNotExist(err) {
+			err = nil
+		}
+		return
+	}
+
+	var activeKeyID string
+	if activeKeyID, _, err = o.Keyring.Active(); err != nil {
+		return
+	}
+	for _, entry := range entries {
+		aggregateID, parseErr := uuid.Parse(strings.TrimSuffix(entry.Name(), keyFileSuffix))
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), keyFileSuffix) || parseErr != nil {
+			continue
+		}
+
+		keyFileName := buildKeyFileName(namespaceFolder, aggregateID)
+		var record *dbAggregateKey
+		if record, err = o.readKeyFile(keyFileName); err != nil {
+			return
+		}
+		if record.KeyID == activeKeyID {
+			continue
+		}
+
+		var passphrase []byte
+		if passphrase, err = o.unwrap(ctx, aggregateID, record); err != nil {
+			return
+		}
+		if err = o.writeKeyFile(keyFileName, aggregateID, passphrase); err != nil {
+			return
+		}
+		ret++
+	}
+	return
+}
+
+func (o *AggregateKeys) aggregateKey(
+	ctx context.Context, aggregateID uuid.UUID, create bool) (ret *encrypt.Encryptor, err error) {
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	var namespaceFolder string
+	if namespaceFolder, err = o.buildFolderName(ctx); err != nil {
+		return
+	}
+	keyFileName := buildKeyFileName(namespaceFolder, aggregateID)
+	if ret = o.keys[keyFileName]; ret != nil {
+		return
+	}
+
+	var passphrase []byte
+	var record *dbAggregateKey
+	if record, err = o.readKeyFile(keyFileName); err == nil {
+		passphrase, err = o.unwrap(ctx, aggregateID, record)
+	} else if os.IsNotExist(err) {
+		if !create {
+			err = fmt.Errorf("%w: %v%v", encrypt.ErrKeyNotFound, aggregateKeyPrefix, aggregateID)
+			return
+		}
+		key := make([]byte, 32)
+		if _, err = rand.Read(key); err != nil {
+			return
+		}
+		passphrase = []byte(hex.EncodeToString(key))
+		if err = os.MkdirAll(namespaceFolder, o.defaultFolderPerm); err == nil {
+			err = o.writeKeyFile(keyFileName, aggregateID, passphrase)
+		}
+	}
+	if err != nil {
+		return
+	}
+
+	if ret, err = encrypt.NewEncryptorKDF(string(passphrase), AggregateKeyKDF); err == nil {
+		o.keys[keyFileName] = ret
+	}
+	return
+}
+
+func (o *AggregateKeys) unwrap(ctx context.Context, aggregateID uuid.UUID, record *dbAggregateKey) (ret []byte, err error) {
+	var encryptor *encrypt.Encryptor
+	if encryptor, err = o.Keyring.Key(ctx, record.KeyID); err == nil {
+		ret, err = encryptor.DecryptWithData(record.Key, aggregateID[:])
+	}
+	return
+}
+
+func (o *AggregateKeys) readKeyFile(keyFileName string) (ret *dbAggregateKey, err error) {
+	var data []byte
+	if data, err = os.ReadFile(keyFileName); err == nil {
+		ret = &dbAggregateKey{}
+		err = json.Unmarshal(data, ret)
+	}
+	return
+}
+
+func (o *AggregateKeys) writeKeyFile(keyFileName string, aggregateID uuid.UUID, passphrase []byte) (err error) {
+	record := &dbAggregateKey{}
+	var encryptor *encrypt.Encryptor
+	if record.KeyID, encryptor, err = o.Keyring.Active(); err != nil {
+		return
+	}
+	if record.Key, err = encryptor.EncryptWithData(passphrase, aggregateID[:]); err != nil {
+		return
+	}
+
+	var data []byte
+	if data, err = json.Marshal(record); err == nil {
+		err = eio.WriteFileAtomic(keyFileName, data, o.defaultFilePerm)
+	}
+	return
+}
+
+// dbAggregateKey is the key of an aggregate, encrypted by the key of the keyring with KeyID.
+type dbAggregateKey struct {
+	KeyID string `json:"key_id"`
+	Key   []byte `json:"key"`
+}
+
+const keyFileSuffix = ".key"
+
+func buildKeyFileName(folder string, id uuid.UUID) string {
+	return filepath.Join(folder, id.String()) + keyFileSuffix
+}
@@ -0,0 +1,61 @@
+package filestore
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// lockFileName is the advisory lock file of a namespace folder, it is locked exclusively while events are saved
+// and shared while events are read, so that processes sharing a store folder don't interleave their appends.
+const lockFileName = "events.lock"
+
+type fileLock struct {
+	file *os.File
+}
+
+// lockFile opens or creates the file and blocks until the advisory lock is acquired.
+func lockFile(name string, exclusive bool, perm os.FileMode) (ret *fileLock, err error) {
+	var file *os.File
+	if file, err = os.OpenFile(name, os.O_CREATE|os.O_RDWR, perm); err != nil {
+		return
+	}
+	if err = lockFd(file, exclusive); err != nil {
+		file.Close()
+		return
+	}
+	ret = &fileLock{file: file}
+	return
+}
+
+// lockExistingFile acquires the shared lock of the file without creating it,
+// the lock is empty, if the file doesn't exist.
+func lockExistingFile(name string) (ret *fileLock, err error) {
+	var file *os.File
+	if file, err = os.Open(name); err != nil {
+		if os.IsNotExist(err) {
+			return &fileLock{}, nil
+		}
+		return
+	}
+	if err = lockFd(file, false); err != nil {
+		file.Close()
+		return
+	}
+	return &fileLock{file: file}, nil
+}
+
+func (o *fileLock) Unlock() (err error) {
+	if o == nil || o.file == nil {
+		return
+	}
+	if err = unlockFd(o.file); err == nil {
+		err = o.file.Close()
+	} else {
+		o.file.Close()
+	}
+	return
+}
+
+func buildLockFileName(folder string) string {
+	return filepath.Join(folder, lockFileName)
+}
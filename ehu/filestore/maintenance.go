@@ -0,0 +1,297 @@
+package filestore
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/go-ee/utils/ehu"
+	"github.com/go-ee/utils/eio"
+	"github.com/go-ee/utils/encrypt"
+	"github.com/google/uuid"
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/namespace"
+)
+
+// rewriteRecord returns the new record of the stored event, or nil if the record is unchanged.
+// The codec is the one of the aggregate events file.
+type rewriteRecord func(codec Codec, record *dbEventRecord) (interface{}, error)
+
+// Replace implements the Replace method of the eventhorizon.EventStoreMaintenance interface.
+// The event replaces the stored event of the same aggregate and version, its position in the event log is kept.
+// Snapshots of the aggregate are not removed, they must be removed by the caller if they are affected.
+func (s *EventStore) Replace(ctx context.Context, event eh.Event) (err error) {
+	id := event.AggregateID()
+	replaced := 0
+	err = s.rewrite(ctx, eh.EventStoreOpReplace, []uuid.UUID{id},
+		func(_ Codec, record *dbEventRecord) (ret interface{}, err error) {
+			if record.Version_ == event.Version() {
+				replaced++
+				ret, err = newDbEvent(event)
+			}
+			return
+		})
+	if err == nil && replaced == 0 {
+		err = &eh.EventStoreError{
+			Err:              fmt.Errorf("%w, %v", eh.ErrEventNotFound, namespace.FromContext(ctx)),
+			Op:               eh.EventStoreOpReplace,
+			AggregateID:      id,
+			AggregateVersion: event.Version(),
+		}
+	}
+	return
+}
+
+// RenameEvent implements the RenameEvent method of the eventhorizon.EventStoreMaintenance interface.
+// All events of the type in the namespace are renamed. The data of the current schema version of the old type
+// is the first schema version of the new type: the data is upcast by the registered upcasters of the old type
+// and the schema version is reset to 1, so that the upcasters of the new type start with it.
+func (s *EventStore) RenameEvent(ctx context.Context, from, to eh.EventType) (err error) {
+	err = s.rewrite(ctx, eh.EventStoreOpRename, nil,
+		func(codec Codec, record *dbEventRecord) (ret interface{}, err error) {
+			if record.EventType_ != from {
+				return
+			}
+			schemaVersion := record.SchemaVersion_
+			if schemaVersion < 1 {
+				schemaVersion = 1
+			}
+			if ehu.DefaultUpcasters.SchemaVersion(from) > schemaVersion {
+				if err = record.decodeData(codec); err != nil {
+					return
+				}
+				record.dbEvent.EventType_, record.dbEvent.SchemaVersion_ = to, 1
+				ret = &record.dbEvent
+			} else {
+				record.EventType_, record.SchemaVersion_ = to, 1
+				ret = record
+			}
+			return
+		})
+	return
+}
+
+// Migrate rewrites all events of the namespace, which are stored with an older schema version,
+// with the data upcast to the current schema version of the registered upcasters.
+// The positions in the event log are kept. It is meant to be run offline, snapshots of the migrated
+// aggregates may be outdated and should be removed.
+func (s *EventStore) Migrate(ctx context.Context) (ret int, err error) {
+	err = s.rewrite(ctx, eh.EventStoreOpSave, nil,
+		func(codec Codec, record *dbEventRecord) (migrated interface{}, err error) {
+			schemaVersion := record.SchemaVersion_
+			if schemaVersion < 1 {
+				schemaVersion = 1
+			}
+			if ehu.DefaultUpcasters.SchemaVersion(record.EventType_) > schemaVersion {
+				if err = record.decodeData(codec); err == nil {
+					ret++
+					migrated = &record.dbEvent
+				}
+			}
+			return
+		})
+	return
+}
+
+// RotateKeys encrypts all events of the namespace, which are not encrypted by the active key of their aggregate,
+// by the active key, e.g. after adding a new active key to the keyring or after enabling the encryption.
+// The positions in the event log are kept.
+func (s *EventStore) RotateKeys(ctx context.Context) (ret int, err error) {
+	if s.Keys == nil {
+		return 0, s.rewriteError(eh.EventStoreOpSave, ErrKeysNotSet, uuid.Nil)
+	}
+	err = s.rewrite(ctx, eh.EventStoreOpSave, nil,
+		func(_ Codec, record *dbEventRecord) (rotated interface{}, err error) {
+			var activeKeyID string
+			if activeKeyID, _, err = s.Keys.ActiveKey(ctx, record.AggregateID_); err == nil && record.KeyID_ != activeKeyID {
+				ret++
+				rotated = record
+			}
+			return
+		})
+	return
+}
+
+// rewrite rewrites the events files of the aggregates, all aggregates of the namespace, if ids is nil,
+// and updates the offsets in the event log for the rewritten files.
+// Catch-up readers of the event log, which are running concurrently, may read events at outdated offsets.
+func (s *EventStore) rewrite(
+	ctx context.Context, op eh.EventStoreOperation, ids []uuid.UUID, transform rewriteRecord) (err error) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var namespaceFolder string
+	if namespaceFolder, err = s.buildFolderName(ctx); err != nil {
+		return s.rewriteError(op, err, uuid.Nil)
+	}
+	if _, err = os.Stat(namespaceFolder); err != nil {
+		if os.IsNotExist(err) {
+			err = nil
+			if ids != nil {
+				err = s.rewriteError(op, fmt.Errorf("%w, %v", eh.ErrAggregateNotFound, namespace.FromContext(ctx)), ids[0])
+			}
+		}
+		return
+	}
+
+	if err = s.recoverNamespace(ctx, namespaceFolder); err != nil {
+		return
+	}
+
+	var lock *fileLock
+	if lock, err = s.lockNamespace(ctx, namespaceFolder, true); err != nil {
+		return
+	}
+	defer lock.Unlock()
+
+	if err = s.ensureLog(ctx, namespaceFolder); err != nil {
+		return
+	}
+
+	if ids == nil {
+		if ids, err = listAggregateIds(namespaceFolder); err != nil {
+			return s.rewriteError(op, err, uuid.Nil)
+		}
+	}
+
+	moved := map[logKey]dbLogEntry{}
+	for _, id := range ids {
+		if err = s.rewriteAggregate(ctx, namespaceFolder, id, transform, moved); err != nil {
+			return s.rewriteError(op, err, id)
+		}
+	}
+
+	if len(moved) > 0 {
+		if err = s.rewriteLog(namespaceFolder, moved); err != nil {
+			return s.rewriteError(op, err, uuid.Nil)
+		}
+		s.notifyChanged()
+	}
+	return
+}
+
+// rewriteAggregate rewrites the changed lines of the events file of the aggregate and collects
+// the new offsets of all its events, if any line is changed.
+func (s *EventStore) rewriteAggregate(ctx context.Context, namespaceFolder string, id uuid.UUID,
+	transform rewriteRecord, moved map[logKey]dbLogEntry) (err error) {
+
+	eventsFileName := buildEventsFileName(namespaceFolder, id)
+	var data []byte
+	if data, err = os.ReadFile(eventsFileName); err != nil {
+		if os.IsNotExist(err) {
+			err = fmt.Errorf("%w, %v", eh.ErrAggregateNotFound, namespace.FromContext(ctx))
+		}
+		return
+	}
+
+	var codec Codec
+	var headerLength int
+	if codec, headerLength, err = parseCodecHeader(data); err != nil {
+		return
+	}
+	codec = s.fileCodec(codec)
+
+	var buffer bytes.Buffer
+	buffer.Write(data[:headerLength])
+	var entries []dbLogEntry
+	changed := false
+	for _, line := range bytes.Split(data[headerLength:], []byte("\n")) {
+		if len(line) == 0 {
+			continue
+		}
+
+		envelope := &dbEventRecord{}
+		if err = decodeLine(codec, line, envelope); err != nil {
+			return
+		}
+
+		// the events of crypto-shredded aggregates are kept as they are
+		var newRecord interface{}
+		if record, openErr := openEventRecord(ctx, codec, envelope); openErr == nil {
+			if newRecord, err = transform(codec, record); err != nil {
+				return
+			}
+		} else if !errors.Is(openErr, encrypt.ErrKeyNotFound) {
+			return openErr
+		}
+		if newRecord != nil {
+			if line, err = encodeEventLine(ctx, codec, newRecord); err != nil {
+				return
+			}
+			changed = true
+		}
+
+		entries = append(entries, dbLogEntry{
+			AggregateID: envelope.AggregateID_,
+			Version:     envelope.Version_,
+			Offset:      int64(buffer.Len()),
+			Length:      len(line),
+		})
+		buffer.Write(line)
+		buffer.WriteByte('\n')
+	}
+
+	if !changed {
+		return
+	}
+	if err = eio.WriteFileAtomic(eventsFileName, buffer.Bytes(), s.defaultFilePerm); err != nil {
+		return
+	}
+	for _, entry := range entries {
+		moved[logKey{aggregateID: entry.AggregateID, version: entry.Version}] = entry
+	}
+	return
+}
+
+// rewriteLog updates the offsets and lengths of the moved events, the positions are kept.
+func (s *EventStore) rewriteLog(namespaceFolder string, moved map[logKey]dbLogEntry) (err error) {
+	logFileName := buildLogFileName(namespaceFolder)
+	var logFile *os.File
+	if logFile, err = os.Open(logFileName); err != nil {
+		return
+	}
+	defer logFile.Close()
+
+	var buffer bytes.Buffer
+	scanner := bufio.NewScanner(logFile)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		entry := dbLogEntry{}
+		if err = json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return
+		}
+		if movedEntry, ok := moved[logKey{aggregateID: entry.AggregateID, version: entry.Version}]; ok {
+			entry.Offset = movedEntry.Offset
+			entry.Length = movedEntry.Length
+		}
+
+		var data []byte
+		if data, err = json.Marshal(entry); err != nil {
+			return
+		}
+		buffer.Write(data)
+		buffer.WriteByte('\n')
+	}
+	if err = scanner.Err(); err != nil {
+		return
+	}
+	logFile.Close()
+
+	err = eio.WriteFileAtomic(logFileName, buffer.Bytes(), s.defaultFilePerm)
+	return
+}
+
+func (s *EventStore) rewriteError(op eh.EventStoreOperation, err error, id uuid.UUID) error {
+	return &eh.EventStoreError{
+		Err:         err,
+		Op:          op,
+		AggregateID: id,
+	}
+}
@@ -0,0 +1,126 @@
+package filestore
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-ee/utils/ehu"
+	"github.com/google/uuid"
+	eh "github.com/looplab/eventhorizon"
+)
+
+const testOldEventType eh.EventType = "TestOldEvent"
+const testUpcastEventType eh.EventType = "TestUpcastEvent"
+
+type testUpcastEventData struct {
+	Text string `json:"text"`
+}
+
+func init() {
+	eh.RegisterEventData(testUpcastEventType, func() eh.EventData { return &testUpcastEventData{} })
+	ehu.RegisterUpcaster(testUpcastEventType, 1, func(data json.RawMessage) (ret json.RawMessage, err error) {
+		old := testEventData{}
+		if err = json.Unmarshal(data, &old); err == nil {
+			ret, err = json.Marshal(testUpcastEventData{Text: old.Content})
+		}
+		return
+	})
+}
+
+func TestEventStoreMaintenance(t *testing.T) {
+	ctx := newTestContext()
+	store := NewEventStore(t.TempDir())
+	id1, id2 := uuid.New(), uuid.New()
+
+	for version := 1; version <= 2; version++ {
+		if err := store.Save(ctx, []eh.Event{eh.NewEvent(testOldEventType, &testEventData{Content: "content"},
+			time.Now(), eh.ForAggregate(testAggregateType, id1, version))}, version-1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := store.Save(ctx, newTestEvents(id2, 1, 1), 0); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.RenameEvent(ctx, testOldEventType, testUpcastEventType); err != nil {
+		t.Fatal(err)
+	}
+	events, err := store.Load(ctx, id1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, ok := events[1].Data().(*testUpcastEventData); !ok || data.Text != "content" {
+		t.Fatalf("expected upcast event data, got %v", events[1].Data())
+	}
+
+	if migrated, err := store.Migrate(ctx); err != nil || migrated != 2 {
+		t.Fatalf("expected 2 migrated events, got %v, %v", migrated, err)
+	}
+	if migrated, err := store.Migrate(ctx); err != nil || migrated != 0 {
+		t.Fatalf("expected no migrated events, got %v, %v", migrated, err)
+	}
+
+	replacement := eh.NewEvent(testUpcastEventType, &testUpcastEventData{Text: "replaced"}, time.Now(),
+		eh.ForAggregate(testAggregateType, id1, 1))
+	if err = store.Replace(ctx, replacement); err != nil {
+		t.Fatal(err)
+	}
+
+	var texts []string
+	if err = store.LoadAllFrom(ctx, 1, func(position int64, event eh.Event) error {
+		if data, ok := event.Data().(*testUpcastEventData); ok {
+			texts = append(texts, data.Text)
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if len(texts) != 2 || texts[0] != "replaced" || texts[1] != "content" {
+		t.Fatalf("unexpected events of the log after replace, %v", texts)
+	}
+
+	err = store.Replace(ctx, eh.NewEvent(testUpcastEventType, &testUpcastEventData{}, time.Now(),
+		eh.ForAggregate(testAggregateType, id1, 5)))
+	if !errors.Is(err, eh.ErrEventNotFound) {
+		t.Fatalf("expected event not found, got %v", err)
+	}
+}
+
+func TestEventStoreRenameEventSchemaVersion(t *testing.T) {
+	const renamedEventType eh.EventType = "TestRenamedEvent"
+	ctx := newTestContext()
+	store := NewEventStore(t.TempDir())
+	saveRenamed := func(id uuid.UUID, content string) {
+		if err := store.Save(ctx, []eh.Event{eh.NewEvent(renamedEventType, &testEventData{Content: content},
+			time.Now(), eh.ForAggregate(testAggregateType, id, 1))}, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the events of schema version 1 and 2 of the old type
+	id1, id2 := uuid.New(), uuid.New()
+	saveRenamed(id1, "content")
+	ehu.RegisterUpcaster(renamedEventType, 1, func(data json.RawMessage) (ret json.RawMessage, err error) {
+		old := testEventData{}
+		if err = json.Unmarshal(data, &old); err == nil {
+			ret, err = json.Marshal(testEventData{Content: old.Content + "!"})
+		}
+		return
+	})
+	saveRenamed(id2, "content!")
+
+	if err := store.RenameEvent(ctx, renamedEventType, testUpcastEventType); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []uuid.UUID{id1, id2} {
+		events, err := store.Load(ctx, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if data, ok := events[0].Data().(*testUpcastEventData); !ok || data.Text != "content!" {
+			t.Fatalf("expected the data upcast by the old and the new type, got %v", events[0].Data())
+		}
+	}
+}
@@ -0,0 +1,537 @@
+package filestore
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-ee/utils/eio"
+	"github.com/looplab/eventhorizon/namespace"
+)
+
+// ErrInvalidNamespace is when a namespace name is empty or would resolve outside of the folder of a store.
+var ErrInvalidNamespace = errors.New("invalid namespace")
+
+// ErrNamespaceExists is when a namespace is restored, which already exists.
+var ErrNamespaceExists = errors.New("namespace already exists")
+
+// ValidateNamespace checks that the namespace is a relative, slash separated name, without "." and ".." elements,
+// so that the folder of the namespace is inside the folder of the store.
+func ValidateNamespace(ns string) (err error) {
+	if ns == "" || strings.ContainsAny(ns, "\\:\x00") {
+		return fmt.Errorf("%w: %q", ErrInvalidNamespace, ns)
+	}
+	for _, element := range strings.Split(ns, "/") {
+		if element == "" || element == "." || element == ".." {
+			return fmt.Errorf("%w: %q", ErrInvalidNamespace, ns)
+		}
+	}
+	return
+}
+
+// Namespaces manages the namespaces, the tenants, across the stores of an application:
+// list, archive to a tarball, restore from it and delete.
+// A namespace contains only its own files, not the ones of nested namespaces like "app/structure" of "app".
+type Namespaces struct {
+	EventStore    *EventStore
+	SnapshotStore *SnapshotStore
+	Keys          *AggregateKeys
+	Repos         []*Repo
+}
+
+func NewNamespaces(eventStore *EventStore, snapshotStore *SnapshotStore, repos ...*Repo) *Namespaces {
+	return &Namespaces{
+		EventStore:    eventStore,
+		SnapshotStore: snapshotStore,
+		Repos:         repos,
+	}
+}
+
+// AddRepo adds a repo to the managed stores, the files of repos sharing the folder are managed once.
+func (o *Namespaces) AddRepo(repo *Repo) {
+	o.Repos = append(o.Repos, repo)
+}
+
+// List returns the sorted names of the namespaces, which have files in any of the stores.
+func (o *Namespaces) List() (ret []string, err error) {
+	names := map[string]bool{}
+	for _, base := range o.folderBases() {
+		if err = listFolderNamespaces(base.folder, names); err != nil {
+			return
+		}
+	}
+	for _, repo := range o.repos() {
+		if err = listRepoNamespaces(repo.folder, names); err != nil {
+			return
+		}
+	}
+
+	for name := range names {
+		if ValidateNamespace(name) == nil {
+			ret = append(ret, name)
+		}
+	}
+	sort.Strings(ret)
+	return
+}
+
+// Exists returns true, if the namespace of the context has files in any of the stores.
+func (o *Namespaces) Exists(ctx context.Context) (ret bool, err error) {
+	ns := namespace.FromContext(ctx)
+	if err = ValidateNamespace(ns); err != nil {
+		return
+	}
+	var names []string
+	if names, err = o.List(); err == nil {
+		index := sort.SearchStrings(names, ns)
+		ret = index < len(names) && names[index] == ns
+	}
+	return
+}
+
+// Archive writes the files of the namespace of the context, from all stores, as gzipped tarball.
+// The events are archived under the lock of the namespace, consistent with concurrent saves.
+func (o *Namespaces) Archive(ctx context.Context, writer io.Writer) (err error) {
+	ns := namespace.FromContext(ctx)
+	if err = ValidateNamespace(ns); err != nil {
+		return
+	}
+
+	gzipWriter := gzip.NewWriter(writer)
+	tarWriter := tar.NewWriter(gzipWriter)
+
+	if err = o.archive(ctx, ns, tarWriter); err == nil {
+		if err = tarWriter.Close(); err == nil {
+			err = gzipWriter.Close()
+		}
+	}
+	if err != nil {
+		err = fmt.Errorf("could not archive namespace %v: %w", ns, err)
+	}
+	return
+}
+
+func (o *Namespaces) archive(ctx context.Context, ns string, tarWriter *tar.Writer) (err error) {
+	var manifest []byte
+	if manifest, err = json.Marshal(&dbArchiveManifest{Namespace: ns, Archived: time.Now()}); err != nil {
+		return
+	}
+	if err = writeArchiveEntry(tarWriter, archiveManifestName, manifest); err != nil {
+		return
+	}
+
+	if o.EventStore != nil {
+		if err = o.archiveEvents(ctx, tarWriter); err != nil {
+			return
+		}
+	}
+	if o.SnapshotStore != nil {
+		if err = archiveFolder(ctx, tarWriter, archiveSnapshots, o.SnapshotStore.Base); err != nil {
+			return
+		}
+	}
+	if o.Keys != nil {
+		o.Keys.mu.Lock()
+		err = archiveFolder(ctx, tarWriter, archiveKeys, o.Keys.Base)
+		o.Keys.mu.Unlock()
+		if err != nil {
+			return
+		}
+	}
+	for _, repo := range o.repos() {
+		if err = archiveRepo(tarWriter, repo, ns); err != nil {
+			return
+		}
+	}
+	return
+}
+
+func (o *Namespaces) archiveEvents(ctx context.Context, tarWriter *tar.Writer) (err error) {
+	s := o.EventStore
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var namespaceFolder string
+	if namespaceFolder, err = s.buildFolderName(ctx); err != nil {
+		return
+	}
+	var lock *fileLock
+	if lock, err = s.openNamespace(ctx, namespaceFolder); err != nil {
+		return
+	}
+	defer lock.Unlock()
+
+	err = archiveFolder(ctx, tarWriter, archiveEvents, s.Base)
+	return
+}
+
+// Restore restores the namespace of the context from the tarball of Archive, the namespace must not exist.
+// The namespace may differ from the archived one, a copy of a tenant, but encrypted Repo files are bound
+// to the name of the archived namespace. On an error the partially restored namespace is deleted.
+func (o *Namespaces) Restore(ctx context.Context, reader io.Reader) (err error) {
+	ns := namespace.FromContext(ctx)
+	var exists bool
+	if exists, err = o.Exists(ctx); err != nil {
+		return
+	}
+	if exists {
+		return fmt.Errorf("%w: %v", ErrNamespaceExists, ns)
+	}
+
+	if err = o.restore(ctx, ns, reader); err != nil {
+		err = fmt.Errorf("could not restore namespace %v: %w", ns, err)
+		if deleteErr := o.Delete(ctx); deleteErr != nil {
+			err = fmt.Errorf("%w, %v", err, deleteErr)
+		}
+		return
+	}
+	o.unload(ctx, ns)
+	return
+}
+
+func (o *Namespaces) restore(ctx context.Context, ns string, reader io.Reader) (err error) {
+	var gzipReader *gzip.Reader
+	if gzipReader, err = gzip.NewReader(reader); err != nil {
+		return
+	}
+	defer gzipReader.Close()
+
+	var manifest *dbArchiveManifest
+	tarReader := tar.NewReader(gzipReader)
+	for {
+		var header *tar.Header
+		if header, err = tarReader.Next(); err != nil {
+			if err == io.EOF {
+				err = nil
+			}
+			return
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		var data []byte
+		if data, err = io.ReadAll(tarReader); err != nil {
+			return
+		}
+		if header.Name == archiveManifestName {
+			manifest = &dbArchiveManifest{}
+			if err = json.Unmarshal(data, manifest); err != nil {
+				return
+			}
+			continue
+		}
+		if manifest == nil {
+			return fmt.Errorf("archive without manifest")
+		}
+
+		if err = o.restoreEntry(ctx, ns, manifest.Namespace, header, data); err != nil {
+			return
+		}
+	}
+}
+
+func (o *Namespaces) restoreEntry(
+	ctx context.Context, ns string, archivedNs string, header *tar.Header, data []byte) (err error) {
+
+	store, name := path.Split(header.Name)
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, "\\:\x00") {
+		return fmt.Errorf("invalid archive entry %q", header.Name)
+	}
+
+	var base *Base
+	switch store {
+	case archiveEvents + "/":
+		if o.EventStore != nil {
+			base = o.EventStore.Base
+		}
+	case archiveSnapshots + "/":
+		if o.SnapshotStore != nil {
+			base = o.SnapshotStore.Base
+		}
+	case archiveKeys + "/":
+		if o.Keys != nil {
+			base = o.Keys.Base
+		}
+	case archiveRepos + "/":
+		return o.restoreRepo(ns, archivedNs, name, data)
+	}
+	if base == nil {
+		return fmt.Errorf("no store for archive entry %q", header.Name)
+	}
+
+	var namespaceFolder string
+	if namespaceFolder, err = base.buildFolderName(ctx); err != nil {
+		return
+	}
+	if err = os.MkdirAll(namespaceFolder, base.defaultFolderPerm); err == nil {
+		err = eio.WriteFileAtomic(filepath.Join(namespaceFolder, name), data, base.defaultFilePerm)
+	}
+	return
+}
+
+func (o *Namespaces) restoreRepo(ns string, archivedNs string, name string, data []byte) (err error) {
+	var repo *Repo
+	for _, item := range o.repos() {
+		if archiveRepoName(item) == name {
+			repo = item
+			break
+		}
+	}
+	if repo == nil {
+		return fmt.Errorf("no repo for archive entry %v", name)
+	}
+
+	if ns != archivedNs {
+		var headerLength int
+		if _, headerLength, err = parseCodecHeader(data); err != nil {
+			return
+		}
+		if bytes.HasPrefix(data[headerLength:], []byte(keyHeaderPrefix)) {
+			return fmt.Errorf("encrypted repo %v of namespace %v can't be restored as %v", name, archivedNs, ns)
+		}
+	}
+
+	repo.dbMu.Lock()
+	defer repo.dbMu.Unlock()
+
+	var fileName string
+	if fileName, err = repo.buildFileNameAndMkdirParents(ns); err == nil {
+		err = eio.WriteFileAtomic(fileName, data, repo.defaultFilePerm)
+	}
+	return
+}
+
+// Delete removes the namespace of the context from all stores, with the aggregate keys.
+func (o *Namespaces) Delete(ctx context.Context) (err error) {
+	ns := namespace.FromContext(ctx)
+	if err = ValidateNamespace(ns); err != nil {
+		return
+	}
+
+	// the repos sharing the folder share the file, but each loads the entities
+	distinct := map[*Repo]bool{}
+	for _, repo := range o.repos() {
+		distinct[repo] = true
+	}
+	for _, repo := range o.Repos {
+		if !distinct[repo] {
+			repo.unload(ns)
+		} else if err = repo.Clear(ctx); err != nil {
+			return
+		}
+	}
+	if o.SnapshotStore != nil {
+		if err = o.SnapshotStore.Clear(ctx); err != nil {
+			return
+		}
+	}
+	if o.Keys != nil {
+		if err = o.Keys.Clear(ctx); err != nil {
+			return
+		}
+	}
+	if o.EventStore != nil {
+		err = o.EventStore.Clear(ctx)
+	}
+	return
+}
+
+// unload drops the cached state of the restored namespace, so it is loaded from the restored files.
+func (o *Namespaces) unload(ctx context.Context, ns string) {
+	for _, repo := range o.Repos {
+		repo.unload(ns)
+	}
+	if o.EventStore != nil {
+		if namespaceFolder, err := o.EventStore.buildFolderName(ctx); err == nil {
+			o.EventStore.recoverMu.Lock()
+			delete(o.EventStore.recovered, namespaceFolder)
+			o.EventStore.recoverMu.Unlock()
+		}
+		o.EventStore.mu.Lock()
+		o.EventStore.notifyChanged()
+		o.EventStore.mu.Unlock()
+	}
+}
+
+func (o *Namespaces) folderBases() (ret []*Base) {
+	if o.EventStore != nil {
+		ret = append(ret, o.EventStore.Base)
+	}
+	if o.SnapshotStore != nil {
+		ret = append(ret, o.SnapshotStore.Base)
+	}
+	if o.Keys != nil {
+		ret = append(ret, o.Keys.Base)
+	}
+	return
+}
+
+// repos returns the repos with distinct folders.
+func (o *Namespaces) repos() (ret []*Repo) {
+	folders := map[string]bool{}
+	for _, repo := range o.Repos {
+		if folder := filepath.Clean(repo.folder); !folders[folder] {
+			folders[folder] = true
+			ret = append(ret, repo)
+		}
+	}
+	return
+}
+
+const (
+	archiveManifestName = "namespace.json"
+	archiveEvents       = EventStoreFolder
+	archiveSnapshots    = SnapshotStoreFolder
+	archiveKeys         = KeysFolder
+	archiveRepos        = ReposFolder
+)
+
+type dbArchiveManifest struct {
+	Namespace string    `json:"namespace"`
+	Archived  time.Time `json:"archived"`
+}
+
+// archiveRepoName is the name of the repo in the archive, by the name of its folder.
+func archiveRepoName(repo *Repo) string {
+	return filepath.Base(repo.folder) + repoFileSuffix
+}
+
+func archiveRepo(tarWriter *tar.Writer, repo *Repo, ns string) (err error) {
+	repo.dbMu.RLock()
+	defer repo.dbMu.RUnlock()
+
+	var data []byte
+	if data, err = os.ReadFile(repo.buildFileName(ns)); err != nil {
+		if os.IsNotExist(err) {
+			err = nil
+		}
+		return
+	}
+	err = writeArchiveEntry(tarWriter, archiveRepos+"/"+archiveRepoName(repo), data)
+	return
+}
+
+// archiveFolder archives the files of the namespace folder of the store, without the lock file.
+func archiveFolder(ctx context.Context, tarWriter *tar.Writer, store string, base *Base) (err error) {
+	var namespaceFolder string
+	if namespaceFolder, err = base.buildFolderName(ctx); err != nil {
+		return
+	}
+	var entries []os.DirEntry
+	if entries, err = os.ReadDir(namespaceFolder); err != nil {
+		if os.IsNotExist(err) {
+			err = nil
+		}
+		return
+	}
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() || entry.Name() == lockFileName {
+			continue
+		}
+		var data []byte
+		if data, err = os.ReadFile(filepath.Join(namespaceFolder, entry.Name())); err != nil {
+			return
+		}
+		if err = writeArchiveEntry(tarWriter, store+"/"+entry.Name(), data); err != nil {
+			return
+		}
+	}
+	return
+}
+
+func writeArchiveEntry(tarWriter *tar.Writer, name string, data []byte) (err error) {
+	if err = tarWriter.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Mode:     0600,
+		Size:     int64(len(data)),
+		ModTime:  time.Now(),
+	}); err == nil {
+		_, err = tarWriter.Write(data)
+	}
+	return
+}
+
+// listFolderNamespaces adds the namespaces of a store with a folder per namespace, the folders with files.
+func listFolderNamespaces(folder string, names map[string]bool) (err error) {
+	err = filepath.WalkDir(folder, func(path string, entry fs.DirEntry, walkErr error) error {
+		if walkErr != nil {
+			if os.IsNotExist(walkErr) {
+				return nil
+			}
+			return walkErr
+		}
+		if !entry.Type().IsRegular() || entry.Name() == lockFileName {
+			return nil
+		}
+		ns, relErr := filepath.Rel(folder, filepath.Dir(path))
+		if relErr == nil && ns != "." {
+			names[filepath.ToSlash(ns)] = true
+		}
+		return relErr
+	})
+	return
+}
+
+// listRepoNamespaces adds the namespaces of the files of a repo folder.
+func listRepoNamespaces(folder string, names map[string]bool) (err error) {
+	err = filepath.WalkDir(folder, func(path string, entry fs.DirEntry, walkErr error) error {
+		if walkErr != nil {
+			if os.IsNotExist(walkErr) {
+				return nil
+			}
+			return walkErr
+		}
+		if !entry.Type().IsRegular() || !strings.HasSuffix(entry.Name(), repoFileSuffix) {
+			return nil
+		}
+		ns, relErr := filepath.Rel(folder, strings.TrimSuffix(path, repoFileSuffix))
+		if relErr == nil {
+			names[filepath.ToSlash(ns)] = true
+		}
+		return relErr
+	})
+	return
+}
+
+// removeNamespaceFiles removes the files of the namespace folder and the folder, if it is empty then.
+// The folders of nested namespaces are kept.
+func removeNamespaceFiles(namespaceFolder string) (err error) {
+	var entries []os.DirEntry
+	if entries, err = os.ReadDir(namespaceFolder); err != nil {
+		if os.IsNotExist(err) {
+			err = nil
+		}
+		return
+	}
+	nested := false
+	for _, entry := range entries {
+		if entry.IsDir() {
+			nested = true
+			continue
+		}
+		if err = os.Remove(filepath.Join(namespaceFolder, entry.Name())); err != nil && !os.IsNotExist(err) {
+			return
+		}
+	}
+	err = nil
+	if !nested {
+		if err = os.Remove(namespaceFolder); err != nil && os.IsNotExist(err) {
+			err = nil
+		}
+	}
+	return
+}
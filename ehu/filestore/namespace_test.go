@@ -0,0 +1,126 @@
+package filestore
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/google/uuid"
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/namespace"
+)
+
+func TestValidateNamespace(t *testing.T) {
+	for _, ns := range []string{"default", "app/structure", "tenant-1.eu"} {
+		if err := ValidateNamespace(ns); err != nil {
+			t.Errorf("expected valid namespace %q, got %v", ns, err)
+		}
+	}
+	for _, ns := range []string{"", "..", "../evil", "app/../../evil", "/abs", "app//x", "a\\b", "c:x"} {
+		if err := ValidateNamespace(ns); !errors.Is(err, ErrInvalidNamespace) {
+			t.Errorf("expected invalid namespace %q, got %v", ns, err)
+		}
+	}
+
+	store := NewEventStore(t.TempDir())
+	evil := namespace.NewContext(context.Background(), "../evil")
+	if err := store.Save(evil, newTestEvents(uuid.New(), 1, 1), 0); !errors.Is(err, ErrInvalidNamespace) {
+		t.Fatalf("expected invalid namespace, got %v", err)
+	}
+	if _, err := newTestRepo(t).FindAll(evil); !errors.Is(err, ErrInvalidNamespace) {
+		t.Fatalf("expected invalid namespace, got %v", err)
+	}
+}
+
+func TestNamespaces(t *testing.T) {
+	ctx := newTestContext()
+	nested := namespace.NewContext(context.Background(), "test/nested")
+	copied := namespace.NewContext(context.Background(), "copy")
+	folder := t.TempDir()
+
+	namespaces := NewNamespaces(
+		NewEventStore(filepath.Join(folder, "eventstore")),
+		NewSnapshotStore(filepath.Join(folder, "snapshots")),
+		newTestFolderRepo(t, filepath.Join(folder, "repos")))
+	id := uuid.New()
+	if err := namespaces.EventStore.Save(ctx, newTestEvents(id, 1, 2), 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := namespaces.EventStore.Save(nested, newTestEvents(uuid.New(), 1, 1), 0); err != nil {
+		t.Fatal(err)
+	}
+	anna := &testEntity{ID: uuid.New(), Name: "Anna"}
+	saveTestEntities(t, namespaces.Repos[0], anna)
+
+	if names, err := namespaces.List(); err != nil || !reflect.DeepEqual(names, []string{"test", "test/nested"}) {
+		t.Fatalf("expected test namespaces, got %v, %v", names, err)
+	}
+
+	var archive bytes.Buffer
+	if err := namespaces.Archive(ctx, &archive); err != nil {
+		t.Fatal(err)
+	}
+	if err := namespaces.Restore(ctx, bytes.NewReader(archive.Bytes())); !errors.Is(err, ErrNamespaceExists) {
+		t.Fatalf("expected namespace exists, got %v", err)
+	}
+	if err := namespaces.Restore(copied, bytes.NewReader(archive.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+	if events, err := namespaces.EventStore.Load(copied, id); err != nil || len(events) != 2 {
+		t.Fatalf("expected 2 restored events, got %v, %v", events, err)
+	}
+	if entity, err := namespaces.Repos[0].Find(copied, anna.ID); err != nil || entity.(*testEntity).Name != "Anna" {
+		t.Fatalf("expected restored Anna, got %v, %v", entity, err)
+	}
+
+	// the nested namespace is kept
+	if err := namespaces.Delete(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if names, err := namespaces.List(); err != nil || !reflect.DeepEqual(names, []string{"copy", "test/nested"}) {
+		t.Fatalf("expected copy and nested namespaces, got %v, %v", names, err)
+	}
+	if events, err := namespaces.EventStore.Load(ctx, id); err != nil || len(events) != 0 {
+		t.Fatalf("expected no events, got %v, %v", events, err)
+	}
+}
+
+func TestNamespacesSharedRepoFolder(t *testing.T) {
+	ctx := newTestContext()
+	copied := namespace.NewContext(context.Background(), "copy")
+	folder := filepath.Join(t.TempDir(), "repos")
+	first, second := newTestFolderRepo(t, folder), newTestFolderRepo(t, folder)
+	namespaces := NewNamespaces(nil, nil, first, second)
+
+	anna := &testEntity{ID: uuid.New(), Name: "Anna"}
+	saveTestEntities(t, first, anna)
+	if _, err := second.Find(ctx, anna.ID); err != nil {
+		t.Fatal(err)
+	}
+	if entities, err := second.FindAll(copied); err != nil || len(entities) != 0 {
+		t.Fatalf("expected no copied entities, got %v, %v", entities, err)
+	}
+
+	var archive bytes.Buffer
+	if err := namespaces.Archive(ctx, &archive); err != nil {
+		t.Fatal(err)
+	}
+	if err := namespaces.Restore(copied, &archive); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := second.Find(copied, anna.ID); err != nil {
+		t.Fatalf("expected restored Anna, got %v", err)
+	}
+
+	if err := namespaces.Delete(ctx); err != nil {
+		t.Fatal(err)
+	}
+	for _, repo := range namespaces.Repos {
+		if _, err := repo.Find(ctx, anna.ID); !errors.Is(err, eh.ErrEntityNotFound) {
+			t.Fatalf("expected deleted Anna, got %v", err)
+		}
+	}
+}
@@ -0,0 +1,225 @@
+package filestore
+
+import (
+	"context"
+	"encoding/json"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/go-ee/utils/eio"
+	"github.com/go-ee/utils/lg"
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/namespace"
+)
+
+// DefaultRetryInterval is the interval the Outbox retries an event after an error of the handler.
+const DefaultRetryInterval = 5 * time.Second
+
+// outboxAckFileName records the position of the last event in the event log acknowledged by the handler.
+const outboxAckFileName = "outbox.ack"
+
+// Outbox dispatches the events saved in the EventStore to the handler, usually the eh.EventBus,
+// with at-least-once delivery. The event log is the outbox: events after the acknowledged position
+// are pending, so an event is pending as soon as it is saved, with no extra write.
+// The position is acknowledged after the handler returned without error, a failed event is retried
+// and after a restart the dispatching resumes after the acknowledged position.
+// The delivery is at-least-once only, if the handler returns after the event is handled, like ehu.SyncEventBus,
+// an asynchronous event bus, like the local one of eventhorizon, returns before its handlers ran.
+// The Outbox dispatches the events of all namespaces of the store, each namespace in order.
+type Outbox struct {
+	store   *EventStore
+	handler eh.EventHandler
+
+	RetryInterval time.Duration
+
+	errCh  chan error
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+	mu     sync.Mutex
+}
+
+func NewOutbox(store *EventStore, handler eh.EventHandler) *Outbox {
+	return &Outbox{
+		store:         store,
+		handler:       handler,
+		RetryInterval: DefaultRetryInterval,
+		errCh:         make(chan error, 100),
+	}
+}
+
+// Start starts the dispatching in the background, for the existing and new namespaces of the store.
+// The handlers of the event bus should be added before.
+func (o *Outbox) Start() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.cancel != nil {
+		return
+	}
+	var ctx context.Context
+	ctx, o.cancel = context.WithCancel(context.Background())
+	o.wg.Add(1)
+	go o.run(ctx)
+}
+
+// Close stops the dispatching and waits until the running handlers returned.
+func (o *Outbox) Close() (err error) {
+	o.mu.Lock()
+	cancel := o.cancel
+	o.mu.Unlock()
+
+	if cancel != nil {
+		cancel()
+		o.wg.Wait()
+	}
+	return
+}
+
+// Errors returns the errors of the dispatching, as eh.OutboxError for errors of the handler.
+// Errors are dropped, if they are not received.
+func (o *Outbox) Errors() <-chan error {
+	return o.errCh
+}
+
+// Acknowledged returns the position of the last acknowledged event of the namespace, 0 if there is none.
+func (o *Outbox) Acknowledged(ctx context.Context) (ret int64, err error) {
+	var ackFileName string
+	if ackFileName, err = o.buildAckFileName(ctx); err != nil {
+		return
+	}
+	var data []byte
+	if data, err = os.ReadFile(ackFileName); err != nil {
+		if os.IsNotExist(err) {
+			err = nil
+		}
+		return
+	}
+	ack := dbOutboxAck{}
+	if err = json.Unmarshal(data, &ack); err == nil {
+		ret = ack.Position
+	}
+	return
+}
+
+// Pending returns the count of the events of the namespace, which are not acknowledged yet.
+func (o *Outbox) Pending(ctx context.Context) (ret int64, err error) {
+	var last, acknowledged int64
+	if last, err = o.store.LastPosition(ctx); err != nil {
+		return
+	}
+	if acknowledged, err = o.Acknowledged(ctx); err == nil && last > acknowledged {
+		ret = last - acknowledged
+	}
+	return
+}
+
+func (o *Outbox) run(ctx context.Context) {
+	defer o.wg.Done()
+
+	started := map[string]bool{}
+	for {
+		changed := o.store.changes()
+		if namespaces, err := o.store.logNamespaces(); err == nil {
+			for _, ns := range namespaces {
+				if !started[ns] {
+					started[ns] = true
+					o.wg.Add(1)
+					go o.dispatch(namespace.NewContext(ctx, ns))
+				}
+			}
+		} else {
+			o.report(err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-changed:
+		case <-time.After(o.store.PollInterval):
+		}
+	}
+}
+
+// dispatch handles the events of the namespace after the acknowledged position, until the context is done.
+func (o *Outbox) dispatch(ctx context.Context) {
+	defer o.wg.Done()
+
+	for {
+		position, err := o.Acknowledged(ctx)
+		if err == nil {
+			err = o.store.Subscribe(ctx, position+1, func(current int64, event eh.Event) (handleErr error) {
+				if handleErr = o.handler.HandleEvent(ctx, event); handleErr != nil {
+					return &eh.OutboxError{Err: handleErr, Ctx: ctx, Event: event}
+				}
+				return o.acknowledge(ctx, current)
+			})
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			o.report(err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(o.RetryInterval):
+		}
+	}
+}
+
+func (o *Outbox) acknowledge(ctx context.Context, position int64) (err error) {
+	var ackFileName string
+	if ackFileName, err = o.buildAckFileName(ctx); err != nil {
+		return
+	}
+	var data []byte
+	if data, err = json.Marshal(&dbOutboxAck{Position: position}); err == nil {
+		err = eio.WriteFileAtomic(ackFileName, data, o.store.defaultFilePerm)
+	}
+	return
+}
+
+func (o *Outbox) report(err error) {
+	lg.LOG.Warnf("outbox: %v", err)
+	select {
+	case o.errCh <- err:
+	default:
+	}
+}
+
+func (o *Outbox) buildAckFileName(ctx context.Context) (ret string, err error) {
+	if ret, err = o.store.buildFolderName(ctx); err == nil {
+		ret = filepath.Join(ret, outboxAckFileName)
+	}
+	return
+}
+
+type dbOutboxAck struct {
+	Position int64 `json:"position"`
+}
+
+// logNamespaces returns the namespaces of the store with an event log.
+func (s *EventStore) logNamespaces() (ret []string, err error) {
+	err = filepath.WalkDir(s.folder, func(path string, entry fs.DirEntry, walkErr error) error {
+		if walkErr != nil {
+			if os.IsNotExist(walkErr) {
+				return nil
+			}
+			return walkErr
+		}
+		if entry.IsDir() || entry.Name() != logFileName {
+			return nil
+		}
+		ns, relErr := filepath.Rel(s.folder, filepath.Dir(path))
+		if relErr == nil {
+			ret = append(ret, filepath.ToSlash(ns))
+		}
+		return relErr
+	})
+	return
+}
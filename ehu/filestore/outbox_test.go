@@ -0,0 +1,168 @@
+package filestore
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-ee/utils/ehu"
+	"github.com/google/uuid"
+	eh "github.com/looplab/eventhorizon"
+)
+
+type testOutboxHandler struct {
+	events []eh.Event
+	failOn int
+	mu     sync.Mutex
+}
+
+func (o *testOutboxHandler) HandlerType() eh.EventHandlerType {
+	return "test-outbox"
+}
+
+func (o *testOutboxHandler) HandleEvent(_ context.Context, event eh.Event) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.failOn == event.Version() {
+		o.failOn = 0
+		return errors.New("handler failed")
+	}
+	o.events = append(o.events, event)
+	return nil
+}
+
+func (o *testOutboxHandler) count() int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return len(o.events)
+}
+
+func waitForOutbox(t *testing.T, handler *testOutboxHandler, count int) {
+	deadline := time.Now().Add(5 * time.Second)
+	for handler.count() < count {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %v dispatched events, got %v", count, handler.count())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestOutbox(t *testing.T) {
+	ctx := newTestContext()
+	folder := t.TempDir()
+	store := NewEventStore(folder)
+	store.PollInterval = 10 * time.Millisecond
+	id := uuid.New()
+
+	// events saved before the start are pending and dispatched, a failed event is retried
+	if err := store.Save(ctx, newTestEvents(id, 1, 2), 0); err != nil {
+		t.Fatal(err)
+	}
+	handler := &testOutboxHandler{failOn: 2}
+	outbox := NewOutbox(store, handler)
+	outbox.RetryInterval = 10 * time.Millisecond
+	outbox.Start()
+	waitForOutbox(t, handler, 2)
+
+	if err := <-outbox.Errors(); !errors.As(err, new(*eh.OutboxError)) {
+		t.Fatalf("expected outbox error, got %v", err)
+	}
+	if err := outbox.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if pending, err := outbox.Pending(ctx); err != nil || pending != 0 {
+		t.Fatalf("expected no pending events, got %v, %v", pending, err)
+	}
+
+	// a restarted outbox resumes after the acknowledged position
+	if err := store.Save(ctx, newTestEvents(id, 3, 1), 2); err != nil {
+		t.Fatal(err)
+	}
+	restarted := NewOutbox(NewEventStore(folder), handler)
+	if pending, err := restarted.Pending(ctx); err != nil || pending != 1 {
+		t.Fatalf("expected 1 pending event, got %v, %v", pending, err)
+	}
+	restarted.Start()
+	defer restarted.Close()
+	waitForOutbox(t, handler, 3)
+
+	time.Sleep(50 * time.Millisecond)
+	if handler.count() != 3 || handler.events[2].Version() != 3 {
+		t.Fatalf("expected events dispatched once, got %v", handler.events)
+	}
+}
+
+// blockingHandler stands for a projector, which runs until it is released or the context is done.
+type blockingHandler struct {
+	started  chan eh.Event
+	release  chan struct{}
+	projects int
+	mu       sync.Mutex
+}
+
+func (o *blockingHandler) HandlerType() eh.EventHandlerType {
+	return "test-blocking"
+}
+
+func (o *blockingHandler) HandleEvent(ctx context.Context, event eh.Event) error {
+	o.started <- event
+	select {
+	case <-o.release:
+		o.mu.Lock()
+		o.projects++
+		o.mu.Unlock()
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func TestOutboxAcknowledgesAfterTheHandlers(t *testing.T) {
+	ctx := newTestContext()
+	store := NewEventStore(t.TempDir())
+	store.PollInterval = 10 * time.Millisecond
+	if err := store.Save(ctx, newTestEvents(uuid.New(), 1, 1), 0); err != nil {
+		t.Fatal(err)
+	}
+
+	handler := &blockingHandler{started: make(chan eh.Event, 10), release: make(chan struct{})}
+	bus := ehu.NewSyncEventBus()
+	if err := bus.AddHandler(ctx, eh.MatchAll{}, handler); err != nil {
+		t.Fatal(err)
+	}
+
+	// the process crashes while the handler runs, the event is not acknowledged
+	outbox := NewOutbox(store, bus)
+	outbox.Start()
+	<-handler.started
+	if acknowledged, err := outbox.Acknowledged(ctx); err != nil || acknowledged != 0 {
+		t.Fatalf("expected no acknowledged event while the handler runs, got %v, %v", acknowledged, err)
+	}
+	if err := outbox.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the restarted outbox dispatches the event again
+	close(handler.release)
+	outbox = NewOutbox(store, bus)
+	outbox.Start()
+	defer outbox.Close()
+	<-handler.started
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if pending, err := outbox.Pending(ctx); err == nil && pending == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expected the event acknowledged after the handler")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	handler.mu.Lock()
+	defer handler.mu.Unlock()
+	if handler.projects != 1 {
+		t.Fatalf("expected the event projected once, got %v", handler.projects)
+	}
+}
@@ -0,0 +1,158 @@
+package filestore
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/go-ee/utils/ehu"
+	"github.com/go-ee/utils/lg"
+	"os"
+)
+
+// ErrReadOnly is returned by the writing operations of a read only EventStore.
+var ErrReadOnly = errors.New("event store is read only")
+
+// lockNamespace acquires the advisory lock of the namespace folder.
+// A shared lock is not acquired, if the namespace folder doesn't exist, then the returned lock is nil.
+// A read only store acquires the shared lock only, if the lock file exists.
+func (s *EventStore) lockNamespace(ctx context.Context, namespaceFolder string, exclusive bool) (ret *fileLock, err error) {
+	if exclusive && s.ReadOnly {
+		return nil, ehu.NewErrCouldNotSaveAggregate(ctx, ErrReadOnly)
+	}
+	if !exclusive {
+		if _, err = os.Stat(namespaceFolder); err != nil {
+			if os.IsNotExist(err) {
+				err = nil
+			} else {
+				err = ehu.NewErrCouldNotLoadAggregate(ctx, err)
+			}
+			return
+		}
+	}
+	if s.ReadOnly {
+		if ret, err = lockExistingFile(buildLockFileName(namespaceFolder)); err != nil {
+			err = ehu.NewErrCouldNotLoadAggregate(ctx, err)
+		}
+		return
+	}
+	if ret, err = lockFile(buildLockFileName(namespaceFolder), exclusive, s.defaultFilePerm); err != nil {
+		if exclusive {
+			err = ehu.NewErrCouldNotSaveAggregate(ctx, err)
+		} else {
+			err = ehu.NewErrCouldNotLoadAggregate(ctx, err)
+		}
+	}
+	return
+}
+
+// openNamespace recovers the namespace once per process, unless the store is read only,
+// and acquires the shared lock for reading.
+func (s *EventStore) openNamespace(ctx context.Context, namespaceFolder string) (ret *fileLock, err error) {
+	if !s.ReadOnly {
+		err = s.recoverNamespace(ctx, namespaceFolder)
+	}
+	if err == nil {
+		ret, err = s.lockNamespace(ctx, namespaceFolder, false)
+	}
+	return
+}
+
+// recoverNamespace repairs the files of the namespace after a crash, once per process, before the first access:
+// torn trailing lines of the aggregate events files and of the event log are truncated and
+// events missing in the event log are appended to it.
+func (s *EventStore) recoverNamespace(ctx context.Context, namespaceFolder string) (err error) {
+	s.recoverMu.Lock()
+	defer s.recoverMu.Unlock()
+
+	if s.recovered[namespaceFolder] {
+		return
+	}
+	if _, err = os.Stat(namespaceFolder); err != nil {
+		if os.IsNotExist(err) {
+			err = nil
+		}
+		return
+	}
+
+	var lock *fileLock
+	if lock, err = s.lockNamespace(ctx, namespaceFolder, true); err != nil {
+		return
+	}
+	defer lock.Unlock()
+
+	if err = s.recover(ctx, namespaceFolder); err == nil {
+		s.recovered[namespaceFolder] = true
+	}
+	return
+}
+
+func (s *EventStore) recover(ctx context.Context, namespaceFolder string) (err error) {
+	ids, err := listAggregateIds(namespaceFolder)
+	if err != nil {
+		return ehu.NewErrCouldNotLoadAggregate(ctx, err)
+	}
+	for _, id := range ids {
+		if err = truncateTornLine(buildEventsFileName(namespaceFolder, id)); err != nil {
+			return ehu.NewErrCouldNotLoadAggregate(ctx, err)
+		}
+	}
+
+	logFileName := buildLogFileName(namespaceFolder)
+	if err = truncateTornLine(logFileName); err != nil {
+		return ehu.NewErrCouldNotLoadAggregate(ctx, err)
+	}
+
+	var logged map[logKey]bool
+	if logged, err = loadLogged(ctx, logFileName); err == nil {
+		err = s.appendMissingToLog(ctx, namespaceFolder, logged)
+	}
+	return
+}
+
+// truncateTornLine removes a trailing line without line break, which is left by an interrupted append.
+func truncateTornLine(fileName string) (err error) {
+	var file *os.File
+	if file, err = os.OpenFile(fileName, os.O_RDWR, 0); err != nil {
+		if os.IsNotExist(err) {
+			err = nil
+		}
+		return
+	}
+	defer file.Close()
+
+	var size int64
+	if size, err = fileSize(file); err != nil || size == 0 {
+		return
+	}
+
+	last := make([]byte, 1)
+	if _, err = file.ReadAt(last, size-1); err != nil || last[0] == '\n' {
+		return
+	}
+
+	// search the line break before the torn line
+	end := size
+	chunkSize := int64(4096)
+	validSize := int64(0)
+	for end > 0 {
+		start := end - chunkSize
+		if start < 0 {
+			start = 0
+		}
+		chunk := make([]byte, end-start)
+		if _, err = file.ReadAt(chunk, start); err != nil {
+			return
+		}
+		if index := bytes.LastIndexByte(chunk, '\n'); index >= 0 {
+			validSize = start + int64(index) + 1
+			break
+		}
+		end = start
+	}
+
+	lg.LOG.Warnf("truncate torn line of '%v' at %v, %v bytes removed", fileName, validSize, size-validSize)
+	if err = file.Truncate(validSize); err == nil {
+		err = file.Sync()
+	}
+	return
+}
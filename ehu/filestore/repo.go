@@ -2,9 +2,9 @@ package filestore
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
+	"github.com/go-ee/utils/ehu"
 	"github.com/go-ee/utils/eio"
 	"github.com/looplab/eventhorizon/namespace"
 	"os"
@@ -32,15 +32,25 @@ type Repo struct {
 	ids        map[string][]uuid.UUID
 	factoryFn  func() eh.Entity
 	entityType reflect.Type
+
+	// The secondary indexes with the lower case field name as key.
+	indexes map[string]*repoIndex
+
+	// Codec of the files, existing files are loaded with the codec of their header.
+	Codec Codec
+	// Keys encrypt the files, if set.
+	Keys Keys
 }
 
 // NewRepo creates a new Repo.
 func NewRepo(folder string) (ret *Repo, err error) {
 	if err = os.MkdirAll(folder, DefaultFolderPerm); err == nil {
 		ret = &Repo{
-			Base: NewBase(folder),
-			ids:  map[string][]uuid.UUID{},
-			db:   map[string]map[uuid.UUID]eh.Entity{},
+			Base:    NewBase(folder),
+			ids:     map[string][]uuid.UUID{},
+			db:      map[string]map[uuid.UUID]eh.Entity{},
+			indexes: map[string]*repoIndex{},
+			Codec:   JSONCodec,
 		}
 	}
 	return
@@ -60,18 +70,16 @@ func (r *Repo) Find(ctx context.Context, id uuid.UUID) (ret eh.Entity, err error
 		}
 	}
 
-	r.dbMu.RLock()
-	defer r.dbMu.RUnlock()
-
 	var ns string
-	if ns, err = r.namespace(ctx); err != nil {
+	if ns, err = r.readNamespace(ctx); err != nil {
 		return
 	}
+	defer r.dbMu.RUnlock()
 
 	item, ok := r.db[ns][id]
 	if !ok {
 		return nil, &eh.RepoError{
-			Err:      fmt.Errorf("%v: %v", eh.ErrEntityNotFound, namespace.FromContext(ctx)),
+			Err:      fmt.Errorf("%w: %v", eh.ErrEntityNotFound, namespace.FromContext(ctx)),
 			Op:       eh.RepoOpFind,
 			EntityID: id,
 		}
@@ -91,13 +99,11 @@ func (r *Repo) FindAll(ctx context.Context) (ret []eh.Entity, err error) {
 		}
 	}
 
-	r.dbMu.RLock()
-	defer r.dbMu.RUnlock()
-
 	var ns string
-	if ns, err = r.namespace(ctx); err != nil {
+	if ns, err = r.readNamespace(ctx); err != nil {
 		return
 	}
+	defer r.dbMu.RUnlock()
 
 	ret = []eh.Entity{}
 	for _, id := range r.ids[ns] {
@@ -112,6 +118,85 @@ func (r *Repo) FindAll(ctx context.Context) (ret []eh.Entity, err error) {
 	return
 }
 
+// Query implements the Query method of the ehu.QueryRepo interface.
+// Only the entities of the requested page are copied.
+func (r *Repo) Query(ctx context.Context, query *ehu.Query) (ret *ehu.QueryResult, err error) {
+	var selected []eh.Entity
+	if selected, err = r.selectEntities(ctx, query); err != nil {
+		return
+	}
+	defer r.dbMu.RUnlock()
+
+	if ret, err = ehu.PageEntities(selected, query); err != nil {
+		err = r.queryError(ctx, err)
+		return
+	}
+
+	items := make([]eh.Entity, len(ret.Items))
+	for i, item := range ret.Items {
+		items[i] = r.factoryFn()
+		if err = copier.Copy(items[i], item); err != nil {
+			return
+		}
+	}
+	ret.Items = items
+	return
+}
+
+// Count implements the Count method of the ehu.QueryRepo interface, paging of the query is ignored.
+func (r *Repo) Count(ctx context.Context, query *ehu.Query) (ret int, err error) {
+	var selected []eh.Entity
+	if selected, err = r.selectEntities(ctx, query); err == nil {
+		ret = len(selected)
+		r.dbMu.RUnlock()
+	}
+	return
+}
+
+// Exist implements the Exist method of the ehu.QueryRepo interface, paging of the query is ignored.
+func (r *Repo) Exist(ctx context.Context, query *ehu.Query) (ret bool, err error) {
+	var count int
+	if count, err = r.Count(ctx, query); err == nil {
+		ret = count > 0
+	}
+	return
+}
+
+// selectEntities returns the entities of the query with the read lock held, it is released on errors only.
+func (r *Repo) selectEntities(ctx context.Context, query *ehu.Query) (ret []eh.Entity, err error) {
+	if r.factoryFn == nil {
+		return nil, &eh.RepoError{
+			Err: fmt.Errorf("%v: %v", ErrModelNotSet, namespace.FromContext(ctx)),
+			Op:  eh.RepoOpFindQuery,
+		}
+	}
+
+	var ns string
+	if ns, err = r.readNamespace(ctx); err != nil {
+		return
+	}
+
+	entities := make([]eh.Entity, 0, len(r.ids[ns]))
+	for _, id := range r.ids[ns] {
+		if item, ok := r.db[ns][id]; ok {
+			entities = append(entities, item)
+		}
+	}
+
+	if ret, err = ehu.SelectEntities(entities, query); err != nil {
+		r.dbMu.RUnlock()
+		err = r.queryError(ctx, err)
+	}
+	return
+}
+
+func (r *Repo) queryError(ctx context.Context, err error) error {
+	return &eh.RepoError{
+		Err: fmt.Errorf("%w: %v", err, namespace.FromContext(ctx)),
+		Op:  eh.RepoOpFindQuery,
+	}
+}
+
 // Save implements the Save method of the eventhorizon.WriteRepo interface.
 func (r *Repo) Save(ctx context.Context, entity eh.Entity) (err error) {
 	if r.factoryFn == nil {
@@ -139,8 +224,13 @@ func (r *Repo) Save(ctx context.Context, entity eh.Entity) (err error) {
 		return
 	}
 
+	if err = r.checkIndexes(ctx, ns, entity); err != nil {
+		return
+	}
+
 	id := entity.EntityID()
-	if _, ok := r.db[ns][id]; !ok {
+	previous, ok := r.db[ns][id]
+	if !ok {
 		r.ids[ns] = append(r.ids[ns], id)
 	}
 	toInsert := r.factoryFn()
@@ -148,6 +238,7 @@ func (r *Repo) Save(ctx context.Context, entity eh.Entity) (err error) {
 		return
 	}
 	r.db[ns][id] = toInsert
+	r.indexEntity(ns, previous, toInsert)
 
 	err = r.saveFile(ns)
 
@@ -156,16 +247,17 @@ func (r *Repo) Save(ctx context.Context, entity eh.Entity) (err error) {
 
 // Remove implements the Remove method of the eventhorizon.WriteRepo interface.
 func (r *Repo) Remove(ctx context.Context, id uuid.UUID) (err error) {
+	r.dbMu.Lock()
+	defer r.dbMu.Unlock()
+
 	var ns string
 	if ns, err = r.namespace(ctx); err != nil {
 		return
 	}
 
-	r.dbMu.Lock()
-	defer r.dbMu.Unlock()
-
-	if _, ok := r.db[ns][id]; ok {
+	if previous, ok := r.db[ns][id]; ok {
 		delete(r.db[ns], id)
+		r.indexEntity(ns, previous, nil)
 
 		index := -1
 		for i, d := range r.ids[ns] {
@@ -181,21 +273,90 @@ func (r *Repo) Remove(ctx context.Context, id uuid.UUID) (err error) {
 	}
 
 	err = &eh.RepoError{
-		Err: fmt.Errorf("%v: %v", eh.ErrEntityNotFound, namespace.FromContext(ctx)),
+		Err: fmt.Errorf("%w: %v", eh.ErrEntityNotFound, namespace.FromContext(ctx)),
 		Op:  eh.RepoOpRemove,
 	}
 	return
 }
 
+// Clear removes all entities of the namespace.
+func (r *Repo) Clear(ctx context.Context) (err error) {
+	r.dbMu.Lock()
+	defer r.dbMu.Unlock()
+
+	ns := namespace.FromContext(ctx)
+	if err = ValidateNamespace(ns); err != nil {
+		return &eh.RepoError{
+			Err: err,
+			Op:  eh.RepoOpClear,
+		}
+	}
+	r.dropNamespace(ns)
+
+	var fileJson string
+	if fileJson, err = r.buildFileNameAndMkdirParents(ns); err != nil {
+		return
+	}
+	if err = os.Remove(fileJson); err != nil && !os.IsNotExist(err) {
+		err = &eh.RepoError{
+			Err: fmt.Errorf("could not clear entities, %v: %v", err, ns),
+			Op:  eh.RepoOpClear,
+		}
+	} else {
+		err = nil
+	}
+	return
+}
+
+// unload drops the loaded entities of the namespace, so they are loaded from the file again.
+func (r *Repo) unload(ns string) {
+	r.dbMu.Lock()
+	defer r.dbMu.Unlock()
+	r.dropNamespace(ns)
+}
+
+func (r *Repo) dropNamespace(ns string) {
+	delete(r.db, ns)
+	delete(r.ids, ns)
+	r.clearIndexes(ns)
+}
+
 // SetEntityFactory sets a factory function that creates concrete entity types.
 func (r *Repo) SetEntityFactory(f func() eh.Entity) {
 	r.factoryFn = f
 	r.entityType = reflect.TypeOf(f())
 }
 
-// Helper to get the namespace and ensure that its data exists.
+// readNamespace returns the namespace with the read lock held, if there is no error.
+// The data of the namespace is loaded under the write lock, the lock is downgraded afterwards
+// and the data is checked again, because it may be unloaded in between.
+func (r *Repo) readNamespace(ctx context.Context) (ns string, err error) {
+	for {
+		r.dbMu.RLock()
+		ns = namespace.FromContext(ctx)
+		if _, ok := r.db[ns]; ok {
+			return
+		}
+		r.dbMu.RUnlock()
+
+		r.dbMu.Lock()
+		ns, err = r.namespace(ctx)
+		r.dbMu.Unlock()
+		if err != nil {
+			return
+		}
+	}
+}
+
+// Helper to get the namespace and ensure that its data exists, the write lock must be held.
 func (r *Repo) namespace(ctx context.Context) (ns string, err error) {
 	ns = namespace.FromContext(ctx)
+	if err = ValidateNamespace(ns); err != nil {
+		return ns, &eh.RepoError{
+			Err: err,
+			Op:  eh.RepoOpFind,
+		}
+	}
 	err = r.loadFile(ns)
 	return
 }
@@ -206,21 +367,59 @@ func (r *Repo) loadFile(ns string) (err error) {
 		if fileJson, err = r.buildFileNameAndMkdirParents(ns); err != nil {
 			return
 		}
-		if items, jsonErr := eio.LoadArrayJsonByReflect(fileJson, r.entityType); err != nil {
-			err = &eh.RepoError{
-				Err: fmt.Errorf("could not load entity, %v: %v", jsonErr, ns),
+
+		var items []eh.Entity
+		if items, err = r.decodeFile(ns, fileJson); err != nil {
+			return &eh.RepoError{
+				Err: fmt.Errorf("could not load entity, %w: %v", err, ns),
 				Op:  eh.RepoOpFind,
 			}
-		} else {
-			data := map[uuid.UUID]eh.Entity{}
-			ids := make([]uuid.UUID, len(items))
-			for i, item := range items {
-				entity := item.(eh.Entity)
-				data[entity.EntityID()] = entity
-				ids[i] = entity.EntityID()
-			}
-			r.db[ns] = data
-			r.ids[ns] = ids
+		}
+
+		data := map[uuid.UUID]eh.Entity{}
+		ids := make([]uuid.UUID, len(items))
+		for i, entity := range items {
+			data[entity.EntityID()] = entity
+			ids[i] = entity.EntityID()
+		}
+		// the namespace is published with complete indexes only, violations of unique indexes are reported
+		// by the lookups and by saving
+		if err = r.buildIndexes(ns, ids, data); err != nil {
+			return
+		}
+		r.db[ns] = data
+		r.ids[ns] = ids
+	}
+	return
+}
+
+// decodeFile decrypts and decodes the entities of the file with the codec of its header,
+// no entities if the file doesn't exist.
+func (r *Repo) decodeFile(ns string, fileName string) (ret []eh.Entity, err error) {
+	var data []byte
+	if data, err = os.ReadFile(fileName); err != nil {
+		if os.IsNotExist(err) {
+			err = nil
+		}
+		return
+	}
+
+	var codec Codec
+	var headerLength int
+	if codec, headerLength, err = parseCodecHeader(data); err != nil || len(data) == headerLength {
+		return
+	}
+	if data, err = decryptFile(namespace.NewContext(context.Background(), ns), r.Keys, ns, data[headerLength:]); err != nil {
+		return
+	}
+
+	items := reflect.New(reflect.SliceOf(r.entityType))
+	if err = codec.Unmarshal(data, items.Interface()); err != nil {
+		return
+	}
+	for i := 0; i < items.Elem().Len(); i++ {
+		if entity, ok := items.Elem().Index(i).Interface().(eh.Entity); ok && entity != nil {
+			ret = append(ret, entity)
 		}
 	}
 	return
@@ -234,13 +433,29 @@ func (r *Repo) saveFile(ns string) (err error) {
 		items[i] = db[id]
 	}
 
-	data, _ := json.MarshalIndent(items, "", "  ")
+	var data []byte
+	if data, err = r.Codec.Marshal(items); err != nil {
+		return &eh.RepoError{
+			Err: fmt.Errorf("could not marshal entities, %v: %v", err, ns),
+			Op:  eh.RepoOpSave,
+		}
+	}
+	if r.Keys != nil {
+		if data, err = encryptFile(namespace.NewContext(context.Background(), ns), r.Keys, ns, data); err != nil {
+			return &eh.RepoError{
+				Err: fmt.Errorf("could not encrypt entities, %v: %v", err, ns),
+				Op:  eh.RepoOpSave,
+			}
+		}
+	}
+	data = append(codecHeader(r.Codec), data...)
+
 	var fileJson string
 	if fileJson, err = r.buildFileNameAndMkdirParents(ns); err != nil {
 		return
 	}
 
-	if writeErr := os.WriteFile(fileJson, data, r.defaultFilePerm); writeErr != nil {
+	if writeErr := eio.WriteFileAtomic(fileJson, data, r.defaultFilePerm); writeErr != nil {
 		err = &eh.RepoError{
 			Err: fmt.Errorf("could not save entity:  %v", ns),
 			Op:  eh.RepoOpSave,
@@ -250,11 +465,18 @@ func (r *Repo) saveFile(ns string) (err error) {
 }
 
 func (r *Repo) buildFileNameAndMkdirParents(ns string) (ret string, err error) {
-	ret = filepath.Join(r.folder, ns+".json")
+	ret = r.buildFileName(ns)
 	err = r.MkdirParents(ret)
 	return
 }
 
+// repoFileSuffix is the suffix of the file of a namespace.
+const repoFileSuffix = ".json"
+
+func (r *Repo) buildFileName(ns string) string {
+	return filepath.Join(r.folder, filepath.FromSlash(ns)+repoFileSuffix)
+}
+
 func (r *Repo) MkdirParents(file string) error {
 	return os.MkdirAll(filepath.Dir(file), r.defaultFolderPerm)
 }
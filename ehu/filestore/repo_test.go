@@ -0,0 +1,262 @@
+package filestore
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/go-ee/utils/ehu"
+	"github.com/google/uuid"
+	eh "github.com/looplab/eventhorizon"
+)
+
+type testEntity struct {
+	ID    uuid.UUID `json:"id"`
+	Name  string    `json:"name"`
+	Email string    `json:"email"`
+	Age   int       `json:"age"`
+}
+
+func (o *testEntity) EntityID() uuid.UUID {
+	return o.ID
+}
+
+func newTestRepo(t *testing.T) *Repo {
+	return newTestFolderRepo(t, t.TempDir())
+}
+
+func newTestFolderRepo(t *testing.T, folder string) *Repo {
+	repo, err := NewRepo(folder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo.SetEntityFactory(func() eh.Entity { return &testEntity{} })
+	return repo
+}
+
+func saveTestEntities(t *testing.T, repo *Repo, entities ...*testEntity) {
+	for _, entity := range entities {
+		if err := repo.Save(newTestContext(), entity); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestRepoQuery(t *testing.T) {
+	ctx := newTestContext()
+	repo := newTestRepo(t)
+	saveTestEntities(t, repo,
+		&testEntity{ID: uuid.New(), Name: "Anna", Age: 30},
+		&testEntity{ID: uuid.New(), Name: "Bert", Age: 17},
+		&testEntity{ID: uuid.New(), Name: "Carl", Age: 45},
+		&testEntity{ID: uuid.New(), Name: "Dora", Age: 22})
+
+	adults := &ehu.Query{
+		Filters: []ehu.Filter{{Field: "age", Op: ehu.FilterGte, Value: "18"}},
+		Sort:    []ehu.SortField{{Field: "Age", Desc: true}},
+		Limit:   2,
+	}
+
+	result, err := repo.Query(ctx, adults)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Total != 3 || len(result.Items) != 2 || result.Items[0].(*testEntity).Name != "Carl" {
+		t.Fatalf("unexpected first page %+v", result)
+	}
+
+	adults.Cursor = result.NextCursor
+	if result, err = repo.Query(ctx, adults); err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Items) != 1 || result.Items[0].(*testEntity).Name != "Dora" || result.NextCursor != "" {
+		t.Fatalf("unexpected second page %+v", result)
+	}
+
+	if count, err := repo.Count(ctx, &ehu.Query{
+		Filters: []ehu.Filter{{Field: "name", Op: ehu.FilterContains, Value: "a"}}}); err != nil || count != 3 {
+		t.Fatalf("expected count 3, got %v, %v", count, err)
+	}
+
+	if exist, err := repo.Exist(ctx, &ehu.Query{
+		Filters: []ehu.Filter{{Field: "name", Value: "Zoe"}}}); err != nil || exist {
+		t.Fatalf("expected not exist, got %v, %v", exist, err)
+	}
+
+	if _, err = repo.Count(ctx, &ehu.Query{Filters: []ehu.Filter{{Field: "unknown", Value: "x"}}}); err == nil {
+		t.Fatal("expected error for unknown field")
+	}
+}
+
+func TestRepoIndexes(t *testing.T) {
+	ctx := newTestContext()
+	folder := t.TempDir()
+	repo, err := NewRepo(folder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo.SetEntityFactory(func() eh.Entity { return &testEntity{} })
+	if err = repo.AddIndex("email", true); err != nil {
+		t.Fatal(err)
+	}
+	if err = repo.AddIndex("age", false); err != nil {
+		t.Fatal(err)
+	}
+
+	anna := &testEntity{ID: uuid.New(), Name: "Anna", Email: "anna@example.com", Age: 30}
+	saveTestEntities(t, repo, anna,
+		&testEntity{ID: uuid.New(), Name: "Bert", Email: "bert@example.com", Age: 30},
+		&testEntity{ID: uuid.New(), Name: "Carl", Age: 45},
+		&testEntity{ID: uuid.New(), Name: "Dora", Age: 22})
+
+	err = repo.Save(ctx, &testEntity{ID: uuid.New(), Name: "Anna2", Email: "anna@example.com"})
+	if !errors.Is(err, ErrUniqueIndexViolation) {
+		t.Fatalf("expected unique index violation, got %v", err)
+	}
+
+	anna.Email = "anna@example.org"
+	saveTestEntities(t, repo, anna)
+	if _, err = repo.FindOneBy(ctx, "email", "anna@example.com"); !errors.Is(err, eh.ErrEntityNotFound) {
+		t.Fatalf("expected not found for the old email, got %v", err)
+	}
+
+	// a new repo loads the file and rebuilds the indexes
+	reloaded, err := NewRepo(folder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reloaded.SetEntityFactory(func() eh.Entity { return &testEntity{} })
+	if err = reloaded.AddIndex("age", false); err != nil {
+		t.Fatal(err)
+	}
+	if err = reloaded.AddIndex("email", true); err != nil {
+		t.Fatal(err)
+	}
+
+	entity, err := reloaded.FindOneBy(ctx, "email", "anna@example.org")
+	if err != nil || entity.(*testEntity).Name != "Anna" {
+		t.Fatalf("expected Anna, got %v, %v", entity, err)
+	}
+	if entities, err := reloaded.FindBy(ctx, "age", 30); err != nil || len(entities) != 2 {
+		t.Fatalf("expected 2 entities of age 30, got %v, %v", entities, err)
+	}
+
+	if err = reloaded.Remove(ctx, anna.ID); err != nil {
+		t.Fatal(err)
+	}
+	if entities, err := reloaded.FindBy(ctx, "age", 30); err != nil || len(entities) != 1 {
+		t.Fatalf("expected 1 entity of age 30, got %v, %v", entities, err)
+	}
+}
+
+func TestRepoUniqueIndexesWithZeroValues(t *testing.T) {
+	ctx := newTestContext()
+	folder := t.TempDir()
+	repo := newTestFolderRepo(t, folder)
+	for _, field := range []string{"email", "name"} {
+		if err := repo.AddIndex(field, true); err != nil {
+			t.Fatal(err)
+		}
+	}
+	saveTestEntities(t, repo, &testEntity{ID: uuid.New(), Name: "Anna"})
+
+	// the zero email doesn't skip the check of the name
+	if err := repo.Save(ctx, &testEntity{ID: uuid.New(), Name: "Anna"}); !errors.Is(err, ErrUniqueIndexViolation) {
+		t.Fatalf("expected unique index violation, got %v", err)
+	}
+
+	// a violation in the file is loaded and reported by the lookups and by saving, until it is repaired
+	unindexed := newTestFolderRepo(t, folder)
+	duplicate := &testEntity{ID: uuid.New(), Name: "Anna"}
+	saveTestEntities(t, unindexed, duplicate)
+	reloaded := newTestFolderRepo(t, folder)
+	if err := reloaded.AddIndex("name", true); err != nil {
+		t.Fatal(err)
+	}
+	if entities, err := reloaded.FindAll(ctx); err != nil || len(entities) != 2 {
+		t.Fatalf("expected 2 entities, got %v, %v", entities, err)
+	}
+	if _, err := reloaded.FindOneBy(ctx, "name", "Anna"); !errors.Is(err, ErrUniqueIndexViolation) {
+		t.Fatalf("expected unique index violation, got %v", err)
+	}
+	duplicate.Age = 30
+	if err := reloaded.Save(ctx, duplicate); !errors.Is(err, ErrUniqueIndexViolation) {
+		t.Fatalf("expected unique index violation, got %v", err)
+	}
+	duplicate.Name = "Anna2"
+	saveTestEntities(t, reloaded, duplicate)
+	if entity, err := reloaded.FindOneBy(ctx, "name", "Anna"); err != nil || entity.EntityID() == duplicate.ID {
+		t.Fatalf("expected the first Anna, got %v, %v", entity, err)
+	}
+}
+
+func TestRepoIndexKeysWithTypes(t *testing.T) {
+	if indexKey(reflect.ValueOf(1)) == indexKey(reflect.ValueOf("1")) {
+		t.Fatalf("expected different keys of int 1 and string 1")
+	}
+	one := 1
+	if indexKey(reflect.ValueOf(&one)) != indexKey(reflect.ValueOf(1)) {
+		t.Fatalf("expected the key of the pointed value")
+	}
+
+	ctx := newTestContext()
+	repo := newTestRepo(t)
+	if err := repo.AddIndex("name", true); err != nil {
+		t.Fatal(err)
+	}
+	saveTestEntities(t, repo, &testEntity{ID: uuid.New(), Name: "30", Age: 30})
+	if entities, err := repo.FindBy(ctx, "name", 30); err != nil || len(entities) != 0 {
+		t.Fatalf("expected no entity with the name of int 30, got %v, %v", entities, err)
+	}
+	if entity, err := repo.FindOneBy(ctx, "name", "30"); err != nil || entity.(*testEntity).Age != 30 {
+		t.Fatalf("expected the entity of the name 30, got %v, %v", entity, err)
+	}
+}
+
+func TestRepoConcurrentFirstLoad(t *testing.T) {
+	ctx := newTestContext()
+	folder := t.TempDir()
+	saveTestEntities(t, newTestFolderRepo(t, folder),
+		&testEntity{ID: uuid.New(), Name: "Anna", Age: 30},
+		&testEntity{ID: uuid.New(), Name: "Bert", Age: 17})
+
+	repo := newTestFolderRepo(t, folder)
+	if err := repo.AddIndex("age", false); err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for i := 0; i < cap(errs); i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			var err error
+			switch i % 4 {
+			case 0:
+				var entities []eh.Entity
+				if entities, err = repo.FindAll(ctx); err == nil && len(entities) != 2 {
+					err = fmt.Errorf("expected 2 entities, got %v", entities)
+				}
+			case 1:
+				_, err = repo.Count(ctx, &ehu.Query{})
+			case 2:
+				_, err = repo.FindBy(ctx, "age", 30)
+			default:
+				err = repo.Remove(ctx, uuid.New())
+				if errors.Is(err, eh.ErrEntityNotFound) {
+					err = nil
+				}
+			}
+			errs <- err
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
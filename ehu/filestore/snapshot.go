@@ -0,0 +1,195 @@
+package filestore
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/go-ee/utils/ehu"
+	"github.com/go-ee/utils/eio"
+	"github.com/go-ee/utils/encrypt"
+	"github.com/google/uuid"
+	eh "github.com/looplab/eventhorizon"
+	"os"
+	"strconv"
+	"time"
+)
+
+// SnapshotStore keeps the latest snapshot of each aggregate in a file per aggregate,
+// in a folder per namespace, same as the EventStore does for the events.
+type SnapshotStore struct {
+	*Base
+	// Keys encrypt the states with the key of the aggregate, if set, so that shredding the aggregate
+	// makes its snapshot unreadable too. Set the same keys as for the EventStore.
+	Keys Keys
+}
+
+func NewSnapshotStore(folder string) *SnapshotStore {
+	return &SnapshotStore{
+		Base: NewBase(folder),
+	}
+}
+
+// LoadSnapshot implements the LoadSnapshot method of the eventhorizon.SnapshotStore interface.
+// It returns nil, if there is no snapshot for the aggregate.
+func (s *SnapshotStore) LoadSnapshot(ctx context.Context, id uuid.UUID) (ret *eh.Snapshot, err error) {
+	var namespaceFolder string
+	if namespaceFolder, err = s.buildFolderName(ctx); err != nil {
+		return nil, ehu.NewErrCouldNotLoadSnapshot(ctx, err)
+	}
+
+	var data []byte
+	if data, err = os.ReadFile(buildEventsFileName(namespaceFolder, id)); err != nil {
+		if os.IsNotExist(err) {
+			err = nil
+		} else {
+			err = ehu.NewErrCouldNotLoadSnapshot(ctx, err)
+		}
+		return
+	}
+
+	record := dbSnapshot{}
+	if err = json.Unmarshal(data, &record); err != nil {
+		err = ehu.NewErrCouldNotLoadSnapshot(ctx, err)
+		return
+	}
+
+	if len(record.Cipher) > 0 {
+		if record.State, err = s.decryptState(ctx, &record); err != nil {
+			err = ehu.NewErrCouldNotLoadSnapshot(ctx, err)
+			return
+		}
+	}
+
+	var state eh.SnapshotData
+	if state, err = eh.CreateSnapshotData(id, record.AggregateType); err != nil {
+		err = ehu.NewErrCouldNotLoadSnapshot(ctx, err)
+		return
+	}
+
+	if err = json.Unmarshal(record.State, state); err != nil {
+		err = ehu.NewErrCouldNotLoadSnapshot(ctx, err)
+		return
+	}
+
+	ret = &eh.Snapshot{
+		Version:       record.Version,
+		AggregateType: record.AggregateType,
+		Timestamp:     record.Timestamp,
+		State:         state,
+	}
+	return
+}
+
+// SaveSnapshot implements the SaveSnapshot method of the eventhorizon.SnapshotStore interface.
+// The previous snapshot of the aggregate is replaced.
+func (s *SnapshotStore) SaveSnapshot(ctx context.Context, id uuid.UUID, snapshot eh.Snapshot) (err error) {
+	if snapshot.AggregateType == "" {
+		return ehu.NewErrCouldNotSaveSnapshot(ctx, errors.New("aggregate type is empty"))
+	}
+	if snapshot.State == nil {
+		return ehu.NewErrCouldNotSaveSnapshot(ctx, errors.New("snapshot state is nil"))
+	}
+
+	record := dbSnapshot{
+		AggregateID:   id,
+		AggregateType: snapshot.AggregateType,
+		Timestamp:     snapshot.Timestamp,
+		Version:       snapshot.Version,
+	}
+	if record.Timestamp.IsZero() {
+		record.Timestamp = time.Now()
+	}
+
+	if record.State, err = json.Marshal(snapshot.State); err != nil {
+		return ehu.NewErrCouldNotSaveSnapshot(ctx, err)
+	}
+	if s.Keys != nil {
+		if err = s.encryptState(ctx, &record); err != nil {
+			return ehu.NewErrCouldNotSaveSnapshot(ctx, err)
+		}
+	}
+
+	var data []byte
+	if data, err = json.Marshal(record); err != nil {
+		return ehu.NewErrCouldNotSaveSnapshot(ctx, err)
+	}
+
+	var namespaceFolder string
+	if namespaceFolder, err = s.buildFolderName(ctx); err != nil {
+		return ehu.NewErrCouldNotSaveSnapshot(ctx, err)
+	}
+	if err = os.MkdirAll(namespaceFolder, s.defaultFolderPerm); err != nil {
+		return ehu.NewErrCouldNotSaveSnapshot(ctx, err)
+	}
+
+	if err = eio.WriteFileAtomic(buildEventsFileName(namespaceFolder, id), data, s.defaultFilePerm); err != nil {
+		return ehu.NewErrCouldNotSaveSnapshot(ctx, err)
+	}
+	return
+}
+
+// RemoveSnapshot removes the snapshot of the aggregate, e.g. when the aggregate's events are changed.
+func (s *SnapshotStore) RemoveSnapshot(ctx context.Context, id uuid.UUID) (err error) {
+	var namespaceFolder string
+	if namespaceFolder, err = s.buildFolderName(ctx); err != nil {
+		return ehu.NewErrCouldNotSaveSnapshot(ctx, err)
+	}
+	if err = os.Remove(buildEventsFileName(namespaceFolder, id)); err != nil && os.IsNotExist(err) {
+		err = nil
+	}
+	return
+}
+
+// Clear removes all snapshots of the namespace, the snapshots of nested namespaces are kept.
+func (s *SnapshotStore) Clear(ctx context.Context) (err error) {
+	var namespaceFolder string
+	if namespaceFolder, err = s.buildFolderName(ctx); err == nil {
+		err = removeNamespaceFiles(namespaceFolder)
+	}
+	if err != nil {
+		err = ehu.NewErrCouldNotSaveSnapshot(ctx, err)
+	}
+	return
+}
+
+// encryptState replaces the state of the record by its cipher, encrypted with the active key of the aggregate.
+func (s *SnapshotStore) encryptState(ctx context.Context, record *dbSnapshot) (err error) {
+	var encryptor *encrypt.Encryptor
+	if record.KeyID, encryptor, err = s.Keys.ActiveKey(ctx, record.AggregateID); err != nil {
+		return
+	}
+	if record.Cipher, err = encryptor.EncryptWithData(
+		record.State, snapshotAdditionalData(record.AggregateID, record.Version)); err == nil {
+		record.State = nil
+	}
+	return
+}
+
+// decryptState returns the state of the cipher of the record, the error is encrypt.ErrKeyNotFound,
+// if the aggregate is shredded.
+func (s *SnapshotStore) decryptState(ctx context.Context, record *dbSnapshot) (ret json.RawMessage, err error) {
+	if s.Keys == nil {
+		return nil, fmt.Errorf("%w: %v", ErrKeysNotSet, record.KeyID)
+	}
+	var encryptor *encrypt.Encryptor
+	if encryptor, err = s.Keys.Key(ctx, record.KeyID); err == nil {
+		ret, err = encryptor.DecryptWithData(record.Cipher, snapshotAdditionalData(record.AggregateID, record.Version))
+	}
+	return
+}
+
+// snapshotAdditionalData binds the encrypted state to the aggregate and version of the snapshot.
+func snapshotAdditionalData(aggregateID uuid.UUID, version int) []byte {
+	return []byte("snapshot:" + aggregateID.String() + "@" + strconv.Itoa(version))
+}
+
+type dbSnapshot struct {
+	AggregateID   uuid.UUID        `json:"aggregate_id"`
+	AggregateType eh.AggregateType `json:"aggregate_type"`
+	Timestamp     time.Time        `json:"timestamp"`
+	Version       int              `json:"version"`
+	State         json.RawMessage  `json:"state,omitempty"`
+	KeyID         string           `json:"key_id,omitempty"`
+	Cipher        []byte           `json:"cipher,omitempty"`
+}
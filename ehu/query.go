@@ -0,0 +1,407 @@
+package ehu
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-ee/utils/net"
+	"github.com/google/uuid"
+	"github.com/looplab/eventhorizon"
+)
+
+type FilterOp string
+
+const (
+	FilterEq       FilterOp = "eq"
+	FilterNe       FilterOp = "ne"
+	FilterGt       FilterOp = "gt"
+	FilterGte      FilterOp = "gte"
+	FilterLt       FilterOp = "lt"
+	FilterLte      FilterOp = "lte"
+	FilterContains FilterOp = "contains"
+	FilterPrefix   FilterOp = "prefix"
+)
+
+// Filter is a predicate on an entity field, the field is matched by the struct field name or the json name,
+// case-insensitive, also the promoted fields of embedded structs. The value is converted to the type of the field.
+// The text operations contains and prefix are case-insensitive, the comparisons are case-sensitive.
+type Filter struct {
+	Field string
+	Op    FilterOp
+	Value interface{}
+}
+
+type SortField struct {
+	Field string
+	Desc  bool
+}
+
+// Query selects, sorts and pages entities. Paging is by Offset or by Cursor, the cursor is the NextCursor of
+// the previous result, the paging fails with ErrCursorNotFound, if its entity is not selected anymore.
+// A Limit of 0 means no limit.
+type Query struct {
+	Filters []Filter
+	Sort    []SortField
+	Limit   int
+	Offset  int
+	Cursor  string
+}
+
+type QueryResult struct {
+	Items      []eventhorizon.Entity `json:"items"`
+	Total      int                   `json:"total"`
+	NextCursor string                `json:"nextCursor,omitempty"`
+}
+
+// QueryRepo is implemented by repositories supporting queries.
+type QueryRepo interface {
+	Query(ctx context.Context, query *Query) (*QueryResult, error)
+	Count(ctx context.Context, query *Query) (int, error)
+	Exist(ctx context.Context, query *Query) (bool, error)
+}
+
+// SelectEntities filters and sorts the entities by the query, without paging.
+func SelectEntities(entities []eventhorizon.Entity, query *Query) (ret []eventhorizon.Entity, err error) {
+	if query == nil {
+		return entities, nil
+	}
+
+	ret = make([]eventhorizon.Entity, 0, len(entities))
+	for _, entity := range entities {
+		var ok bool
+		if ok, err = query.Match(entity); err != nil {
+			return
+		}
+		if ok {
+			ret = append(ret, entity)
+		}
+	}
+
+	if len(query.Sort) > 0 {
+		var sortErr error
+		sort.SliceStable(ret, func(i, j int) bool {
+			less, lessErr := query.less(ret[i], ret[j])
+			if lessErr != nil && sortErr == nil {
+				sortErr = lessErr
+			}
+			return less
+		})
+		err = sortErr
+	}
+	return
+}
+
+// PageEntities applies the offset or cursor and the limit of the query to the selected entities.
+func PageEntities(selected []eventhorizon.Entity, query *Query) (ret *QueryResult, err error) {
+	ret = &QueryResult{Total: len(selected)}
+
+	start := 0
+	if query != nil {
+		if query.Cursor != "" {
+			var cursorId uuid.UUID
+			if cursorId, err = uuid.Parse(query.Cursor); err != nil {
+				err = fmt.Errorf("invalid cursor '%v': %v", query.Cursor, err)
+				return
+			}
+			start = -1
+			for i, entity := range selected {
+				if entity.EntityID() == cursorId {
+					start = i + 1
+					break
+				}
+			}
+			if start < 0 {
+				err = fmt.Errorf("%w: '%v'", ErrCursorNotFound, query.Cursor)
+				return
+			}
+		} else if query.Offset > 0 {
+			start = query.Offset
+		}
+	}
+	if start > len(selected) {
+		start = len(selected)
+	}
+
+	end := len(selected)
+	if query != nil && query.Limit > 0 && start+query.Limit < end {
+		end = start + query.Limit
+	}
+
+	ret.Items = selected[start:end]
+	if end < len(selected) && end > start {
+		ret.NextCursor = selected[end-1].EntityID().String()
+	}
+	return
+}
+
+// Match checks all filters of the query against the entity.
+func (o *Query) Match(entity eventhorizon.Entity) (ret bool, err error) {
+	for _, filter := range o.Filters {
+		if ret, err = filter.Match(entity); err != nil || !ret {
+			return
+		}
+	}
+	return true, nil
+}
+
+func (o *Query) less(a, b eventhorizon.Entity) (ret bool, err error) {
+	for _, sortField := range o.Sort {
+		var valueA, valueB reflect.Value
+		if valueA, err = FieldValue(a, sortField.Field); err != nil {
+			return
+		}
+		if valueB, err = FieldValue(b, sortField.Field); err != nil {
+			return
+		}
+		var cmp int
+		if cmp, err = compareValues(valueA, valueB.Interface()); err != nil {
+			return
+		}
+		if cmp != 0 {
+			return (cmp < 0) != sortField.Desc, nil
+		}
+	}
+	return
+}
+
+func (o *Filter) Match(entity eventhorizon.Entity) (ret bool, err error) {
+	var value reflect.Value
+	if value, err = FieldValue(entity, o.Field); err != nil {
+		return
+	}
+
+	switch o.Op {
+	case FilterContains, FilterPrefix:
+		text, filterText := strings.ToLower(fmt.Sprint(value.Interface())), strings.ToLower(fmt.Sprint(o.Value))
+		if o.Op == FilterContains {
+			ret = strings.Contains(text, filterText)
+		} else {
+			ret = strings.HasPrefix(text, filterText)
+		}
+		return
+	}
+
+	var cmp int
+	if cmp, err = compareValues(value, o.Value); err != nil {
+		return
+	}
+	switch o.Op {
+	case FilterEq, "":
+		ret = cmp == 0
+	case FilterNe:
+		ret = cmp != 0
+	case FilterGt:
+		ret = cmp > 0
+	case FilterGte:
+		ret = cmp >= 0
+	case FilterLt:
+		ret = cmp < 0
+	case FilterLte:
+		ret = cmp <= 0
+	default:
+		err = fmt.Errorf("filter operation '%v' not supported", o.Op)
+	}
+	return
+}
+
+// FieldValue resolves the field of the entity, nested fields are separated by '.'.
+// The field is matched by the struct field name or the json name, case-insensitive.
+func FieldValue(entity interface{}, field string) (ret reflect.Value, err error) {
+	ret = reflect.ValueOf(entity)
+	for _, name := range strings.Split(field, ".") {
+		for ret.Kind() == reflect.Ptr || ret.Kind() == reflect.Interface {
+			if ret.IsNil() {
+				return
+			}
+			ret = ret.Elem()
+		}
+		if ret.Kind() != reflect.Struct {
+			err = fmt.Errorf("field '%v' not found in %v", field, reflect.TypeOf(entity))
+			return
+		}
+		index := structFieldIndex(ret.Type(), name)
+		if index == nil {
+			err = fmt.Errorf("field '%v' not found in %v", field, reflect.TypeOf(entity))
+			return
+		}
+		// a promoted field of a nil embedded struct pointer is a nil value
+		if ret, err = ret.FieldByIndexErr(index); err != nil {
+			ret, err = reflect.Value{}, nil
+			return
+		}
+	}
+	for ret.Kind() == reflect.Ptr && !ret.IsNil() {
+		ret = ret.Elem()
+	}
+	return
+}
+
+// structFieldIndex returns the index of the field for reflect.Value.FieldByIndex, nil if not found.
+// The promoted fields of embedded structs are visible like the direct fields.
+func structFieldIndex(t reflect.Type, name string) []int {
+	for _, structField := range reflect.VisibleFields(t) {
+		if !structField.IsExported() {
+			continue
+		}
+		jsonName := strings.Split(structField.Tag.Get("json"), ",")[0]
+		if strings.EqualFold(structField.Name, name) || (jsonName != "" && strings.EqualFold(jsonName, name)) {
+			return structField.Index
+		}
+	}
+	return nil
+}
+
+// compareValues compares the field value with the value, which is converted to the type of the field,
+// e.g. from a string of a http request.
+func compareValues(field reflect.Value, value interface{}) (ret int, err error) {
+	if !field.IsValid() || (field.Kind() == reflect.Ptr && field.IsNil()) {
+		if value == nil {
+			return 0, nil
+		}
+		return -1, nil
+	}
+
+	switch fieldVal := field.Interface().(type) {
+	case time.Time:
+		var other time.Time
+		switch v := value.(type) {
+		case time.Time:
+			other = v
+		case *time.Time:
+			other = *v
+		default:
+			if other, err = time.Parse(time.RFC3339, fmt.Sprint(value)); err != nil {
+				return
+			}
+		}
+		ret = fieldVal.Compare(other)
+		return
+	case uuid.UUID:
+		ret = strings.Compare(fieldVal.String(), fmt.Sprint(value))
+		return
+	}
+
+	text := fmt.Sprint(value)
+	switch field.Kind() {
+	case reflect.String:
+		ret = strings.Compare(field.String(), text)
+	case reflect.Bool:
+		var other bool
+		if other, err = strconv.ParseBool(text); err == nil {
+			ret = compareInt64(boolToInt64(field.Bool()), boolToInt64(other))
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var other int64
+		if other, err = strconv.ParseInt(text, 10, 64); err == nil {
+			ret = compareInt64(field.Int(), other)
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		var other uint64
+		if other, err = strconv.ParseUint(text, 10, 64); err == nil {
+			ret = compareUint64(field.Uint(), other)
+		}
+	case reflect.Float32, reflect.Float64:
+		var other float64
+		if other, err = strconv.ParseFloat(text, 64); err == nil {
+			ret = compareFloat64(field.Float(), other)
+		}
+	default:
+		ret = strings.Compare(fmt.Sprint(field.Interface()), text)
+	}
+	return
+}
+
+func boolToInt64(value bool) int64 {
+	if value {
+		return 1
+	}
+	return 0
+}
+
+func compareInt64(a, b int64) int {
+	if a < b {
+		return -1
+	} else if a > b {
+		return 1
+	}
+	return 0
+}
+
+func compareUint64(a, b uint64) int {
+	if a < b {
+		return -1
+	} else if a > b {
+		return 1
+	}
+	return 0
+}
+
+func compareFloat64(a, b float64) int {
+	if a < b {
+		return -1
+	} else if a > b {
+		return 1
+	}
+	return 0
+}
+
+// ParseQuery builds the query from the request parameters, e.g.
+// ?filter=name:eq:John&filter=age:gte:18&sort=name,-age&limit=10&offset=20 or &cursor=<id>.
+// A filter without operation, e.g. filter=name:John, is an equality filter.
+// The operations contains and prefix are case-insensitive, e.g. filter=name:prefix:jo matches John.
+func ParseQuery(r *http.Request) (ret *Query, err error) {
+	if err = r.ParseForm(); err != nil {
+		return
+	}
+
+	ret = &Query{}
+	for _, filterParam := range r.Form[net.QueryFilter] {
+		parts := strings.SplitN(filterParam, ":", 3)
+		switch len(parts) {
+		case 2:
+			ret.Filters = append(ret.Filters, Filter{Field: parts[0], Op: FilterEq, Value: parts[1]})
+		case 3:
+			ret.Filters = append(ret.Filters, Filter{Field: parts[0], Op: FilterOp(parts[1]), Value: parts[2]})
+		default:
+			err = fmt.Errorf("invalid filter '%v'", filterParam)
+			return
+		}
+	}
+
+	for _, sortParam := range r.Form[net.QuerySort] {
+		for _, field := range strings.Split(sortParam, ",") {
+			if field = strings.TrimSpace(field); field == "" {
+				continue
+			}
+			if strings.HasPrefix(field, "-") {
+				ret.Sort = append(ret.Sort, SortField{Field: field[1:], Desc: true})
+			} else {
+				ret.Sort = append(ret.Sort, SortField{Field: strings.TrimPrefix(field, "+")})
+			}
+		}
+	}
+
+	if ret.Limit, err = parseIntParam(r, net.QueryLimit); err != nil {
+		return
+	}
+	if ret.Offset, err = parseIntParam(r, net.QueryOffset); err != nil {
+		return
+	}
+	ret.Cursor = r.Form.Get(net.QueryCursor)
+	return
+}
+
+func parseIntParam(r *http.Request, name string) (ret int, err error) {
+	if value := r.Form.Get(name); value != "" {
+		if ret, err = strconv.Atoi(value); err != nil {
+			err = fmt.Errorf("invalid %v '%v'", name, value)
+		}
+	}
+	return
+}
@@ -0,0 +1,56 @@
+package ehu
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/looplab/eventhorizon"
+)
+
+type auditFields struct {
+	CreatedBy string `json:"createdBy"`
+}
+
+type queryEntity struct {
+	*auditFields
+	ID   uuid.UUID
+	Name string `json:"name"`
+}
+
+func (o *queryEntity) EntityID() uuid.UUID {
+	return o.ID
+}
+
+func TestQueryPromotedFieldsAndTextFilters(t *testing.T) {
+	entities := []eventhorizon.Entity{
+		&queryEntity{auditFields: &auditFields{CreatedBy: "anna"}, ID: uuid.New(), Name: "John"},
+		&queryEntity{auditFields: &auditFields{CreatedBy: "bert"}, ID: uuid.New(), Name: "Joanna"},
+		&queryEntity{ID: uuid.New(), Name: "Mary"},
+	}
+
+	selected, err := SelectEntities(entities, &Query{Filters: []Filter{{Field: "createdBy", Op: FilterEq, Value: "anna"}}})
+	if err != nil || len(selected) != 1 || selected[0] != entities[0] {
+		t.Fatalf("expected the entity created by anna, got %v, %v", selected, err)
+	}
+
+	selected, err = SelectEntities(entities, &Query{Filters: []Filter{{Field: "name", Op: FilterPrefix, Value: "jo"}}})
+	if err != nil || len(selected) != 2 {
+		t.Fatalf("expected 2 entities with the prefix jo, got %v, %v", selected, err)
+	}
+}
+
+func TestPageEntitiesCursorNotFound(t *testing.T) {
+	entities := []eventhorizon.Entity{
+		&queryEntity{ID: uuid.New(), Name: "John"},
+		&queryEntity{ID: uuid.New(), Name: "Mary"},
+	}
+
+	result, err := PageEntities(entities, &Query{Cursor: entities[0].EntityID().String()})
+	if err != nil || len(result.Items) != 1 || result.Items[0] != entities[1] {
+		t.Fatalf("expected the entity after the cursor, got %v, %v", result, err)
+	}
+	if _, err = PageEntities(entities, &Query{Cursor: uuid.NewString()}); !errors.Is(err, ErrCursorNotFound) {
+		t.Fatalf("expected cursor not found, got %v", err)
+	}
+}
@@ -0,0 +1,198 @@
+package ehu
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/namespace"
+)
+
+// RebuildProgress reports the state of a projection rebuild.
+type RebuildProgress struct {
+	ProjectorType string
+	Aggregates    int
+	Events        int
+	Applied       int
+	Errors        []error
+	Done          bool
+}
+
+func (o *RebuildProgress) String() string {
+	return fmt.Sprintf("rebuild %v: aggregates=%v, events=%v, applied=%v, errors=%v, done=%v",
+		o.ProjectorType, o.Aggregates, o.Events, o.Applied, len(o.Errors), o.Done)
+}
+
+// RepoClearer is implemented by repositories, which can remove all entities of a namespace at once.
+type RepoClearer interface {
+	Clear(ctx context.Context) error
+}
+
+// AggregateLister is implemented by event stores, which list the ids of the stored aggregates of a type.
+type AggregateLister interface {
+	AggregateIDs(ctx context.Context, aggregateType eventhorizon.AggregateType) ([]uuid.UUID, error)
+}
+
+// RebuildProjector clears the repository of the projector for the namespace of the context and
+// replays all stored events of the aggregate type through the projector, in the order they were saved.
+//
+// If the event store provides an EventLog, all events are replayed in the global order.
+// Otherwise, the event store must be an AggregateLister, like the AggregateTracker or the mongo EventStore of the app,
+// and the events are replayed per aggregate, in the order of the listed aggregates.
+// Other event stores fail with ErrAggregateIDsNotSupported.
+//
+// Errors of the projector don't stop the rebuild, they are collected in the progress,
+// which is passed to the report function after each aggregate or each 100 events.
+func (o *AggregateEngine) RebuildProjector(ctx context.Context, proj *ProjectorEventHandler,
+	report func(progress *RebuildProgress)) (ret *RebuildProgress, err error) {
+
+	ret = &RebuildProgress{ProjectorType: proj.ProjectorType().String()}
+	if report == nil {
+		report = func(*RebuildProgress) {}
+	}
+
+	repo, ok := proj.Repo.(eventhorizon.ReadWriteRepo)
+	if !ok {
+		err = fmt.Errorf("repo of the projector %v is not writable", ret.ProjectorType)
+		return
+	}
+	var handler eventhorizon.EventHandler
+	if handler, err = o.projectorHandler(proj); err != nil {
+		return
+	}
+
+	eventLog, hasEventLog := o.EventStore.(EventLog)
+
+	var ids []uuid.UUID
+	if !hasEventLog {
+		lister, isLister := o.EventStore.(AggregateLister)
+		if !isLister {
+			err = fmt.Errorf("could not rebuild %v: %w", ret.ProjectorType, ErrAggregateIDsNotSupported)
+			return
+		}
+		if ids, err = lister.AggregateIDs(ctx, o.AggregateType); err != nil {
+			return
+		}
+	}
+
+	if err = clearRepo(ctx, repo); err != nil {
+		return
+	}
+
+	matcher := eventhorizon.MatchEvents(proj.EventTypes())
+	apply := func(event eventhorizon.Event) {
+		if event.AggregateType() != o.AggregateType || !matcher.Match(event) {
+			return
+		}
+		ret.Events++
+		if applyErr := handler.HandleEvent(ctx, event); applyErr != nil {
+			ret.Errors = append(ret.Errors, applyErr)
+		} else {
+			ret.Applied++
+		}
+		if ret.Events%100 == 0 {
+			report(ret)
+		}
+	}
+
+	if hasEventLog {
+		aggregates := map[uuid.UUID]bool{}
+		err = eventLog.LoadAllFrom(ctx, 0, func(_ int64, event eventhorizon.Event) error {
+			if event.AggregateType() == o.AggregateType && !aggregates[event.AggregateID()] {
+				aggregates[event.AggregateID()] = true
+				ret.Aggregates++
+			}
+			apply(event)
+			return ctx.Err()
+		})
+	} else {
+		for _, id := range ids {
+			var events []eventhorizon.Event
+			if events, err = o.EventStore.Load(ctx, id); err != nil {
+				break
+			}
+			ret.Aggregates++
+			for _, event := range events {
+				apply(event)
+			}
+			report(ret)
+			if err = ctx.Err(); err != nil {
+				break
+			}
+		}
+	}
+
+	ret.Done = err == nil
+	report(ret)
+	return
+}
+
+func findEntityIds(ctx context.Context, repo eventhorizon.ReadRepo) (ret []uuid.UUID, err error) {
+	var entities []eventhorizon.Entity
+	if entities, err = repo.FindAll(ctx); err == nil {
+		ret = make([]uuid.UUID, len(entities))
+		for i, entity := range entities {
+			ret[i] = entity.EntityID()
+		}
+	}
+	return
+}
+
+func clearRepo(ctx context.Context, repo eventhorizon.ReadWriteRepo) (err error) {
+	if clearer, ok := repo.(RepoClearer); ok {
+		return clearer.Clear(ctx)
+	}
+
+	var ids []uuid.UUID
+	if ids, err = findEntityIds(ctx, repo); err != nil {
+		return
+	}
+	for _, id := range ids {
+		if err = repo.Remove(ctx, id); err != nil {
+			break
+		}
+	}
+	return
+}
+
+// AggregateTracker is an AggregateLister over an event store without the listing of the aggregates,
+// like the memory event store. It lists the aggregates created by Save through the tracker since its creation,
+// per namespace and aggregate type, in the order of their creation.
+type AggregateTracker struct {
+	eventhorizon.EventStore
+
+	aggregates map[trackedType][]uuid.UUID
+	lock       sync.RWMutex
+}
+
+type trackedType struct {
+	namespace     string
+	aggregateType eventhorizon.AggregateType
+}
+
+func NewAggregateTracker(eventStore eventhorizon.EventStore) *AggregateTracker {
+	return &AggregateTracker{EventStore: eventStore, aggregates: map[trackedType][]uuid.UUID{}}
+}
+
+// Save saves the events and tracks the aggregate, when it is created by the events.
+func (o *AggregateTracker) Save(ctx context.Context, events []eventhorizon.Event, originalVersion int) (err error) {
+	if err = o.EventStore.Save(ctx, events, originalVersion); err == nil && originalVersion == 0 {
+		key := trackedType{namespace: namespace.FromContext(ctx), aggregateType: events[0].AggregateType()}
+		o.lock.Lock()
+		o.aggregates[key] = append(o.aggregates[key], events[0].AggregateID())
+		o.lock.Unlock()
+	}
+	return
+}
+
+// AggregateIDs returns the ids of the tracked aggregates of the type in the namespace of the context.
+func (o *AggregateTracker) AggregateIDs(
+	ctx context.Context, aggregateType eventhorizon.AggregateType) (ret []uuid.UUID, err error) {
+
+	o.lock.RLock()
+	ret = append(ret, o.aggregates[trackedType{namespace: namespace.FromContext(ctx), aggregateType: aggregateType}]...)
+	o.lock.RUnlock()
+	return
+}
@@ -0,0 +1,98 @@
+package ehu
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/looplab/eventhorizon"
+	es "github.com/looplab/eventhorizon/eventstore/memory"
+	repo "github.com/looplab/eventhorizon/repo/memory"
+)
+
+type counterEntity struct {
+	ID    uuid.UUID
+	Count int
+}
+
+func (o *counterEntity) EntityID() uuid.UUID {
+	return o.ID
+}
+
+type counterProjector struct{}
+
+func (o *counterProjector) EventTypes() []eventhorizon.EventType {
+	return []eventhorizon.EventType{"Counted"}
+}
+
+func (o *counterProjector) Apply(event eventhorizon.Event, entity eventhorizon.Entity) (err error) {
+	counter := entity.(*counterEntity)
+	counter.ID = event.AggregateID()
+	counter.Count++
+	return
+}
+
+func saveCounted(t *testing.T, store eventhorizon.EventStore, aggregateType eventhorizon.AggregateType,
+	id uuid.UUID, count int) {
+
+	var events []eventhorizon.Event
+	for version := 1; version <= count; version++ {
+		events = append(events, eventhorizon.NewEvent("Counted", nil, time.Now(),
+			eventhorizon.ForAggregate(aggregateType, id, version)))
+	}
+	if err := store.Save(context.Background(), events, 0); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRebuildProjector(t *testing.T) {
+	ctx := context.Background()
+	memoryStore, _ := es.NewEventStore()
+	store := NewAggregateTracker(memoryStore)
+	first, second := uuid.New(), uuid.New()
+	saveCounted(t, store, "Counter", first, 2)
+	saveCounted(t, store, "Counter", second, 3)
+	saveCounted(t, store, "Other", uuid.New(), 1)
+
+	counters := repo.NewRepo()
+	counters.SetEntityFactory(func() eventhorizon.Entity { return &counterEntity{} })
+	stale := &counterEntity{ID: uuid.New(), Count: 1}
+	if err := counters.Save(ctx, stale); err != nil {
+		t.Fatal(err)
+	}
+
+	engine := &AggregateEngine{
+		Middleware:    &Middleware{EventStore: store},
+		AggregateType: "Counter",
+		EntityFactory: func() eventhorizon.Entity { return &counterEntity{} },
+	}
+	proj := NewProjector("counter", &counterProjector{}, counters)
+	progress, err := engine.RebuildProjector(ctx, proj, nil)
+	if err != nil || !progress.Done || progress.Aggregates != 2 || progress.Applied != 5 || len(progress.Errors) != 0 {
+		t.Fatalf("expected 2 rebuilt aggregates, got %v, %v", progress, err)
+	}
+	if entity, err := counters.Find(ctx, second); err != nil || entity.(*counterEntity).Count != 3 {
+		t.Fatalf("expected count 3, got %v, %v", entity, err)
+	}
+	if _, err = counters.Find(ctx, stale.ID); !errors.Is(err, eventhorizon.ErrEntityNotFound) {
+		t.Fatalf("expected the stale entity removed, got %v", err)
+	}
+
+	// the delegate of the mongo app lists the aggregates of its event store
+	engine.EventStore = &EventStoreDelegate{Factory: func() (eventhorizon.EventStore, error) { return store, nil }}
+	if progress, err = engine.RebuildProjector(ctx, proj, nil); err != nil || progress.Aggregates != 2 {
+		t.Fatalf("expected 2 rebuilt aggregates by the delegate, got %v, %v", progress, err)
+	}
+
+	engine.EventStore = &EventStoreDelegate{Factory: func() (eventhorizon.EventStore, error) { return memoryStore, nil }}
+	if _, err = engine.RebuildProjector(ctx, proj, nil); !errors.Is(err, ErrAggregateIDsNotSupported) {
+		t.Fatalf("expected aggregate ids not supported, got %v", err)
+	}
+
+	engine.EventStore = memoryStore
+	if _, err = engine.RebuildProjector(ctx, proj, nil); !errors.Is(err, ErrAggregateIDsNotSupported) {
+		t.Fatalf("expected aggregate ids not supported, got %v", err)
+	}
+}
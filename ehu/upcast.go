@@ -0,0 +1,86 @@
+package ehu
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/looplab/eventhorizon"
+)
+
+// Upcaster transforms the raw data of a stored event from its schema version to the next schema version.
+type Upcaster func(data json.RawMessage) (json.RawMessage, error)
+
+// Upcasters is a registry of upcasters by event type and schema version.
+// Events without schema version are of the first schema version 1.
+type Upcasters struct {
+	upcasters map[eventhorizon.EventType]map[int]Upcaster
+	mu        sync.RWMutex
+}
+
+func NewUpcasters() *Upcasters {
+	return &Upcasters{upcasters: map[eventhorizon.EventType]map[int]Upcaster{}}
+}
+
+// DefaultUpcasters is the registry used by the event stores, like the event data registry of eventhorizon.
+var DefaultUpcasters = NewUpcasters()
+
+// RegisterUpcaster registers the upcaster from the schema version of the event type to the next one
+// in the DefaultUpcasters.
+func RegisterUpcaster(eventType eventhorizon.EventType, fromSchemaVersion int, upcaster Upcaster) {
+	DefaultUpcasters.Register(eventType, fromSchemaVersion, upcaster)
+}
+
+// Register registers the upcaster from the schema version of the event type to the next one.
+func (o *Upcasters) Register(eventType eventhorizon.EventType, fromSchemaVersion int, upcaster Upcaster) {
+	if fromSchemaVersion < 1 {
+		panic(fmt.Sprintf("eventhorizon: invalid schema version %v of upcaster for %v", fromSchemaVersion, eventType))
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	versions := o.upcasters[eventType]
+	if versions == nil {
+		versions = map[int]Upcaster{}
+		o.upcasters[eventType] = versions
+	}
+	if _, ok := versions[fromSchemaVersion]; ok {
+		panic(fmt.Sprintf("eventhorizon: upcaster for %v from schema version %v registered twice",
+			eventType, fromSchemaVersion))
+	}
+	versions[fromSchemaVersion] = upcaster
+}
+
+// SchemaVersion returns the current schema version of the event type, the version new events are stored with.
+func (o *Upcasters) SchemaVersion(eventType eventhorizon.EventType) (ret int) {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+
+	ret = 1
+	for _, ok := o.upcasters[eventType][ret]; ok; _, ok = o.upcasters[eventType][ret] {
+		ret++
+	}
+	return
+}
+
+// Upcast applies the upcasters from the schema version to the current schema version of the event type.
+func (o *Upcasters) Upcast(
+	eventType eventhorizon.EventType, schemaVersion int, data json.RawMessage) (ret json.RawMessage, retSchemaVersion int, err error) {
+
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+
+	ret = data
+	if retSchemaVersion = schemaVersion; retSchemaVersion < 1 {
+		retSchemaVersion = 1
+	}
+	for upcaster, ok := o.upcasters[eventType][retSchemaVersion]; ok; upcaster, ok = o.upcasters[eventType][retSchemaVersion] {
+		if ret, err = upcaster(ret); err != nil {
+			err = fmt.Errorf("upcast %v from schema version %v: %w", eventType, retSchemaVersion, err)
+			return
+		}
+		retSchemaVersion++
+	}
+	return
+}
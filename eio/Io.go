@@ -3,6 +3,7 @@ package eio
 import (
 	"io"
 	"os"
+	"path/filepath"
 	"regexp"
 	"strconv"
 )
@@ -63,6 +64,52 @@ func FileExists(filename string) bool {
 	return !info.IsDir()
 }
 
+// WriteFileAtomic writes the data to a temporary file in the folder of the file, syncs it to disk and
+// renames it to the file, so that after a crash either the old or the new content exists.
+func WriteFileAtomic(filename string, data []byte, perm os.FileMode) (err error) {
+	var tmp *os.File
+	if tmp, err = os.CreateTemp(filepath.Dir(filename), filepath.Base(filename)+".*.tmp"); err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	if _, err = tmp.Write(data); err != nil {
+		return
+	}
+	if err = tmp.Chmod(perm); err != nil {
+		return
+	}
+	if err = tmp.Sync(); err != nil {
+		return
+	}
+	if err = tmp.Close(); err != nil {
+		return
+	}
+	if err = os.Rename(tmp.Name(), filename); err != nil {
+		return
+	}
+	err = SyncFolder(filepath.Dir(filename))
+	return
+}
+
+// SyncFolder syncs the folder entries to disk, e.g. after a file was created or renamed.
+func SyncFolder(folder string) (err error) {
+	var dir *os.File
+	if dir, err = os.Open(folder); err != nil {
+		return
+	}
+	defer dir.Close()
+
+	// syncing folders is not supported on all platforms, e.g. Windows, therefore the result is ignored
+	_ = dir.Sync()
+	return
+}
+
 func compileFileNameReg() *regexp.Regexp {
 	reg, _ := regexp.Compile("[^a-zA-Z0-9]+")
 	return reg
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/go-ee/utils/cfg"
 	"github.com/kelseyhightower/envconfig"
 	"github.com/matcornic/hermes/v2"
 	"gopkg.in/yaml.v2"
@@ -165,7 +166,7 @@ func (o *EngineConfig) Setup() (err error) {
 	return
 }
 
-func EngineConfigFileYamlLoad(configFileYaml string, cfg *EngineConfig) (err error) {
+func EngineConfigFileYamlLoad(configFileYaml string, config *EngineConfig) (err error) {
 	var file *os.File
 	if file, err = os.Open(configFileYaml); err != nil {
 		return
@@ -173,13 +174,16 @@ func EngineConfigFileYamlLoad(configFileYaml string, cfg *EngineConfig) (err err
 	defer file.Close()
 
 	decoder := yaml.NewDecoder(file)
-	if err = decoder.Decode(cfg); err != nil {
+	if err = decoder.Decode(config); err != nil {
 		err = errors.New(fmt.Sprintf("can't load the engine config '%v', '%v", configFileYaml, err))
 		return
 	}
-	err = envconfig.Process("", cfg)
+	// unsealed after the processing of the environment, whose values may be sealed too
+	if err = envconfig.Process("", config); err == nil {
+		err = cfg.UnsealValues(config)
+	}
 
-	cfg.Setup()
+	config.Setup()
 	return
 }
 
@@ -1,12 +1,13 @@
 package email
 
 import (
+	"github.com/go-ee/utils/cfg"
 	"github.com/kelseyhightower/envconfig"
 	"gopkg.in/yaml.v3"
 	"os"
 )
 
-func LoadSenderConfig(configFileYaml string, cfg *Sender) (err error) {
+func LoadSenderConfig(configFileYaml string, config *Sender) (err error) {
 	var file *os.File
 	if file, err = os.Open(configFileYaml); err != nil {
 		return
@@ -14,10 +15,13 @@ func LoadSenderConfig(configFileYaml string, cfg *Sender) (err error) {
 	defer file.Close()
 
 	decoder := yaml.NewDecoder(file)
-	if err = decoder.Decode(cfg); err != nil {
+	if err = decoder.Decode(config); err != nil {
 		return
 	}
-	err = envconfig.Process("", cfg)
+	// unsealed after the processing of the environment, whose values may be sealed too
+	if err = envconfig.Process("", config); err == nil {
+		err = cfg.UnsealValues(config)
+	}
 	return
 }
 
@@ -0,0 +1,32 @@
+package email
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-ee/utils/cfg"
+	"github.com/go-ee/utils/encrypt"
+)
+
+func TestLoadSenderConfigSealedEnvironment(t *testing.T) {
+	encryptor, err := encrypt.NewEncryptorKDF("master", encrypt.Argon2idKDF(1, 64, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := cfg.MasterKey
+	cfg.MasterKey = func() (*encrypt.Encryptor, error) { return encryptor, nil }
+	t.Cleanup(func() { cfg.MasterKey = previous })
+
+	fileName := filepath.Join(t.TempDir(), "sender-config.yml")
+	if err = os.WriteFile(fileName, []byte("smtp:\n  user: sender\n  password: file secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	sealed, _ := cfg.Seal("env secret", encryptor)
+	t.Setenv("SMTP_PASSWORD", sealed)
+
+	var sender Sender
+	if err = LoadSenderConfig(fileName, &sender); err != nil || sender.SMTP.Password != "env secret" {
+		t.Fatalf("expected the unsealed password of the environment, got %q, %v", sender.SMTP.Password, err)
+	}
+}
@@ -7,22 +7,67 @@ import (
 	"crypto/rand"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"io"
 	"io/ioutil"
 	"os"
+	"sync"
 )
 
+var ErrCipherTextTooShort = errors.New("cipher text too short")
+
+// ErrKeyNotFound is returned, if the key of a key id doesn't exist.
+var ErrKeyNotFound = errors.New("key not found")
+
+// saltLength is the length of the random salt of an Encryptor.
+const saltLength = 16
+
+// maxDerivedKeys limits the cached keys, derived for the salts of envelopes of other encryptors.
+const maxDerivedKeys = 32
+
+// Encryptor encrypts by AES-GCM with a key derived from the passphrase by the KDF and a random salt,
+// to an envelope with the parameters to derive the key again, see envelope.go.
+// The key is derived once for the salt of the encryptor, the keys for the salts of other envelopes
+// are derived and cached on decryption. Data of the legacy format, encrypted with the MD5 hash of
+// the passphrase as key, is still decrypted.
 type Encryptor struct {
+	// AEAD of the key derived with the salt of the encryptor.
 	cipher.AEAD
+	// KeyID is written to the envelopes, e.g. the key id of a keyring.
+	KeyID string
+
+	kdf        *KDF
+	salt       []byte
+	passphrase []byte
+	legacy     cipher.AEAD
+	derived    map[string]cipher.AEAD
+	mu         sync.Mutex
 }
 
+// NewEncryptor creates an encryptor of the passphrase with the DefaultKDF.
 func NewEncryptor(passphrase string) (ret *Encryptor, err error) {
+	return NewEncryptorKDF(passphrase, DefaultKDF)
+}
+
+// NewEncryptorKDF creates an encryptor of the passphrase, it derives the key with the KDF and a random salt.
+func NewEncryptorKDF(passphrase string, kdf *KDF) (ret *Encryptor, err error) {
+	ret = &Encryptor{kdf: kdf, passphrase: []byte(passphrase), derived: map[string]cipher.AEAD{}}
+	if ret.salt, err = randomBytes(saltLength); err != nil {
+		return nil, err
+	}
+	if ret.AEAD, err = ret.derive(kdf, ret.salt); err != nil {
+		return nil, err
+	}
+	if ret.legacy, err = newGCM([]byte(createHash(passphrase))); err != nil {
+		return nil, err
+	}
+	return
+}
+
+func newGCM(key []byte) (ret cipher.AEAD, err error) {
 	var block cipher.Block
-	if block, err = aes.NewCipher([]byte(createHash(passphrase))); err == nil {
-		var gcm cipher.AEAD
-		if gcm, err = cipher.NewGCM(block); err == nil {
-			ret = &Encryptor{AEAD: gcm}
-		}
+	if block, err = aes.NewCipher(key); err == nil {
+		ret, err = cipher.NewGCM(block)
 	}
 	return
 }
@@ -33,19 +78,90 @@ func createHash(key string) string {
 	return hex.EncodeToString(hasher.Sum(nil))
 }
 
+func randomBytes(length int) (ret []byte, err error) {
+	ret = make([]byte, length)
+	_, err = io.ReadFull(rand.Reader, ret)
+	return
+}
+
 func (o *Encryptor) Encrypt(data []byte) (ret []byte, err error) {
-	nonce := make([]byte, o.NonceSize())
-	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+	return o.EncryptWithData(data, nil)
+}
+
+func (o *Encryptor) Decrypt(data []byte) (ret []byte, err error) {
+	return o.DecryptWithData(data, nil)
+}
+
+// EncryptWithData encrypts the data like Encrypt and authenticates the additional data, which is not encrypted.
+func (o *Encryptor) EncryptWithData(data []byte, additionalData []byte) (ret []byte, err error) {
+	var header []byte
+	if header, err = buildEnvelopeHeader(o.kdf, o.salt, o.KeyID); err != nil {
+		return
+	}
+	var nonce []byte
+	if nonce, err = randomBytes(o.NonceSize()); err != nil {
 		return
 	}
-	ret = o.Seal(nonce, nonce, data, nil)
+	ret = append(header, nonce...)
+	ret = o.Seal(ret, nonce, data, append(header[:len(header):len(header)], additionalData...))
 	return
 }
 
-func (o *Encryptor) Decrypt(data []byte) (ret []byte, err error) {
-	nonceSize := o.NonceSize()
+// DecryptWithData decrypts the data of EncryptWithData, it fails if the additional data is different.
+// Data without envelope is decrypted by the legacy format.
+func (o *Encryptor) DecryptWithData(data []byte, additionalData []byte) (ret []byte, err error) {
+	if !isEnvelope(data) {
+		return o.open(o.legacy, data, additionalData)
+	}
+
+	var env *envelope
+	var aead cipher.AEAD
+	if env, err = parseEnvelope(data); err == nil {
+		if aead, err = o.derive(env.kdf, env.salt); err == nil {
+			ret, err = o.open(aead, env.body, append(env.header[:len(env.header):len(env.header)], additionalData...))
+		}
+	}
+	// legacy data starting with the magic by chance
+	if err != nil {
+		if legacy, legacyErr := o.open(o.legacy, data, additionalData); legacyErr == nil {
+			return legacy, nil
+		}
+	}
+	return
+}
+
+func (o *Encryptor) open(aead cipher.AEAD, data []byte, additionalData []byte) (ret []byte, err error) {
+	nonceSize := aead.NonceSize()
+	if len(data) < nonceSize {
+		err = ErrCipherTextTooShort
+		return
+	}
 	nonce, cipherText := data[:nonceSize], data[nonceSize:]
-	ret, err = o.Open(nil, nonce, cipherText, nil)
+	ret, err = aead.Open(nil, nonce, cipherText, additionalData)
+	return
+}
+
+// derive returns the AEAD of the key derived from the passphrase with the KDF and the salt, cached.
+func (o *Encryptor) derive(kdf *KDF, salt []byte) (ret cipher.AEAD, err error) {
+	cacheKey := string(kdf.marshal()) + string(salt)
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	var ok bool
+	if ret, ok = o.derived[cacheKey]; ok {
+		return
+	}
+	var key []byte
+	if key, err = kdf.Key(o.passphrase, salt); err != nil {
+		return
+	}
+	if ret, err = newGCM(key); err != nil {
+		return
+	}
+	if len(o.derived) >= maxDerivedKeys {
+		o.derived = map[string]cipher.AEAD{string(o.kdf.marshal()) + string(o.salt): o.AEAD}
+	}
+	o.derived[cacheKey] = ret
 	return
 }
 
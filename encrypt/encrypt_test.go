@@ -0,0 +1,82 @@
+package encrypt
+
+import (
+	"crypto/rand"
+	"errors"
+	"testing"
+)
+
+var testKDF = Argon2idKDF(1, 64, 1)
+
+func TestEncryptorEnvelope(t *testing.T) {
+	encryptor, err := NewEncryptorKDF("secret", testKDF)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encryptor.KeyID = "key1"
+	encrypted, err := encryptor.EncryptWithData([]byte("data"), []byte("name"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keyID, err := EnvelopeKeyID(encrypted); err != nil || keyID != "key1" {
+		t.Fatalf("expected key1, got %v, %v", keyID, err)
+	}
+
+	// another encryptor of the passphrase derives the key with the salt and the parameters of the envelope
+	for _, kdf := range []*KDF{testKDF, ScryptKDF(4, 8, 1)} {
+		other, _ := NewEncryptorKDF("secret", kdf)
+		if decrypted, err := other.DecryptWithData(encrypted, []byte("name")); err != nil || string(decrypted) != "data" {
+			t.Fatalf("expected data, got %s, %v", decrypted, err)
+		}
+	}
+
+	if _, err = encryptor.DecryptWithData(encrypted, []byte("other")); err == nil {
+		t.Fatal("expected an error for other additional data")
+	}
+	tampered := append([]byte{}, encrypted...)
+	tampered[len(envelopeMagic)+kdfLength+3] ^= 1
+	if _, err = encryptor.DecryptWithData(tampered, []byte("name")); err == nil {
+		t.Fatal("expected an error for a changed salt")
+	}
+	wrong, _ := NewEncryptorKDF("wrong", testKDF)
+	if _, err = wrong.DecryptWithData(encrypted, []byte("name")); err == nil {
+		t.Fatal("expected an error for the wrong passphrase")
+	}
+}
+
+func TestEncryptorLegacy(t *testing.T) {
+	legacy, _ := newGCM([]byte(createHash("secret")))
+	nonce := make([]byte, legacy.NonceSize())
+	_, _ = rand.Read(nonce)
+	encrypted := legacy.Seal(nonce, nonce, []byte("data"), nil)
+
+	encryptor, _ := NewEncryptorKDF("secret", testKDF)
+	if decrypted, err := encryptor.Decrypt(encrypted); err != nil || string(decrypted) != "data" {
+		t.Fatalf("expected data, got %s, %v", decrypted, err)
+	}
+	if _, err := EnvelopeKeyID(encrypted); !errors.Is(err, ErrLegacyFormat) {
+		t.Fatalf("expected legacy format, got %v", err)
+	}
+}
+
+func TestEnvelopeKDFBounds(t *testing.T) {
+	header, _ := buildEnvelopeHeader(Argon2idKDF(1, 1<<31, 1), []byte("salt"), "")
+	if _, err := parseEnvelope(append(header, make([]byte, 32)...)); !errors.Is(err, ErrInvalidKDF) {
+		t.Fatalf("expected invalid KDF, got %v", err)
+	}
+}
+
+func TestDecryptTamperedKDF(t *testing.T) {
+	encryptor, _ := NewEncryptorKDF("secret", testKDF)
+	encrypted, err := encryptor.Encrypt([]byte("data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, kdf := range []*KDF{ScryptKDF(24, 1<<29, 1), ScryptKDF(24, 8, 1), Argon2idKDF(1, 4*1024*1024, 1)} {
+		tampered := append([]byte{}, encrypted...)
+		copy(tampered[len(envelopeMagic)+1:], kdf.marshal())
+		if _, err = encryptor.Decrypt(tampered); !errors.Is(err, ErrInvalidKDF) {
+			t.Fatalf("%+v: expected invalid KDF, got %v", kdf, err)
+		}
+	}
+}
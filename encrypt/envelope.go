@@ -0,0 +1,104 @@
+package encrypt
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+// The envelope of the encrypted data is
+//
+//	magic "GEEC" | version | KDF parameters | salt length | salt | key id length | key id | nonce | cipher text
+//
+// the header up to the nonce is authenticated as additional data, so its fields can't be changed.
+var envelopeMagic = []byte("GEEC")
+
+const envelopeVersion byte = 1
+
+var (
+	// ErrInvalidEnvelope is returned for envelopes, which can't be parsed.
+	ErrInvalidEnvelope = errors.New("invalid envelope")
+	// ErrLegacyFormat is returned by EnvelopeKeyID for data of the legacy format without envelope.
+	ErrLegacyFormat = errors.New("legacy format without envelope")
+)
+
+type envelope struct {
+	kdf    *KDF
+	salt   []byte
+	keyID  string
+	header []byte
+	body   []byte
+}
+
+func isEnvelope(data []byte) bool {
+	return len(data) > len(envelopeMagic) && bytes.HasPrefix(data, envelopeMagic)
+}
+
+func buildEnvelopeHeader(kdf *KDF, salt []byte, keyID string) (ret []byte, err error) {
+	return buildHeader(envelopeMagic, kdf, salt, keyID)
+}
+
+// buildHeader builds the header of the envelopes and the streams.
+func buildHeader(magic []byte, kdf *KDF, salt []byte, keyID string) (ret []byte, err error) {
+	if len(salt) > 255 || len(keyID) > 255 {
+		err = fmt.Errorf("%w: salt or key id longer than 255 bytes", ErrInvalidEnvelope)
+		return
+	}
+	ret = make([]byte, 0, len(magic)+1+kdfLength+2+len(salt)+len(keyID))
+	ret = append(ret, magic...)
+	ret = append(ret, envelopeVersion)
+	ret = append(ret, kdf.marshal()...)
+	ret = append(ret, byte(len(salt)))
+	ret = append(ret, salt...)
+	ret = append(ret, byte(len(keyID)))
+	ret = append(ret, keyID...)
+	return
+}
+
+func parseEnvelope(data []byte) (ret *envelope, err error) {
+	if !isEnvelope(data) {
+		return nil, ErrLegacyFormat
+	}
+	pos := len(envelopeMagic)
+	if len(data) <= pos || data[pos] != envelopeVersion {
+		return nil, fmt.Errorf("%w: unsupported version", ErrInvalidEnvelope)
+	}
+	pos++
+
+	ret = &envelope{}
+	if ret.kdf, err = unmarshalKDF(data[pos:]); err != nil {
+		return nil, err
+	}
+	pos += kdfLength
+
+	var field []byte
+	if field, pos, err = readLengthPrefixed(data, pos); err != nil {
+		return nil, err
+	}
+	ret.salt = field
+	if field, pos, err = readLengthPrefixed(data, pos); err != nil {
+		return nil, err
+	}
+	ret.keyID = string(field)
+	ret.header, ret.body = data[:pos], data[pos:]
+	return
+}
+
+func readLengthPrefixed(data []byte, pos int) (ret []byte, next int, err error) {
+	if pos >= len(data) || pos+1+int(data[pos]) > len(data) {
+		err = fmt.Errorf("%w: truncated header", ErrInvalidEnvelope)
+		return
+	}
+	next = pos + 1 + int(data[pos])
+	ret = data[pos+1 : next]
+	return
+}
+
+// EnvelopeKeyID returns the key id of the envelope of the encrypted data, ErrLegacyFormat for the legacy format.
+func EnvelopeKeyID(data []byte) (ret string, err error) {
+	var env *envelope
+	if env, err = parseEnvelope(data); err == nil {
+		ret = env.keyID
+	}
+	return
+}
@@ -0,0 +1,136 @@
+package encrypt
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/scrypt"
+)
+
+// ErrInvalidKDF is returned for unknown KDF algorithms and parameters out of the accepted bounds.
+var ErrInvalidKDF = errors.New("invalid key derivation parameters")
+
+// keyLength is the length of the derived AES-256 keys.
+const keyLength = 32
+
+type KDFAlgorithm byte
+
+const (
+	KDFArgon2id KDFAlgorithm = 1
+	KDFScrypt   KDFAlgorithm = 2
+)
+
+func (o KDFAlgorithm) String() string {
+	switch o {
+	case KDFArgon2id:
+		return "argon2id"
+	case KDFScrypt:
+		return "scrypt"
+	}
+	return fmt.Sprintf("unknown(%d)", byte(o))
+}
+
+// KDF are the parameters to derive keys from passphrases, Time, Memory and Threads of argon2id
+// or LogN, R and P of scrypt.
+type KDF struct {
+	Algorithm KDFAlgorithm
+	// Time is the count of the passes of argon2id.
+	Time uint32
+	// Memory of argon2id in KiB.
+	Memory  uint32
+	Threads uint8
+	// LogN is the base 2 logarithm of the cost N of scrypt.
+	LogN uint8
+	R    uint32
+	P    uint32
+}
+
+// DefaultKDF is used by NewEncryptor, argon2id with the parameters recommended by RFC 9106 for constrained memory.
+var DefaultKDF = Argon2idKDF(3, 64*1024, 4)
+
+func Argon2idKDF(time uint32, memory uint32, threads uint8) *KDF {
+	return &KDF{Algorithm: KDFArgon2id, Time: time, Memory: memory, Threads: threads}
+}
+
+func ScryptKDF(logN uint8, r uint32, p uint32) *KDF {
+	return &KDF{Algorithm: KDFScrypt, LogN: logN, R: r, P: p}
+}
+
+// Key derives the key of the passphrase and the salt.
+func (o *KDF) Key(passphrase []byte, salt []byte) (ret []byte, err error) {
+	if err = o.validate(); err != nil {
+		return
+	}
+	switch o.Algorithm {
+	case KDFArgon2id:
+		ret = argon2.IDKey(passphrase, salt, o.Time, o.Memory, o.Threads, keyLength)
+	case KDFScrypt:
+		ret, err = scrypt.Key(passphrase, salt, 1<<o.LogN, int(o.R), int(o.P), keyLength)
+	}
+	return
+}
+
+// The bounds of the memory, which the parameters of an envelope may require.
+const (
+	maxArgon2idMemory = 1024 * 1024       // KiB, 1 GiB
+	maxScryptMemory   = 256 * 1024 * 1024 // bytes, 128·r·N
+)
+
+// validate checks the bounds of the parameters, so that the parameters of an envelope can't exhaust the resources.
+func (o *KDF) validate() (err error) {
+	switch o.Algorithm {
+	case KDFArgon2id:
+		if o.Time < 1 || o.Time > 16 || o.Memory < 8 || o.Memory > maxArgon2idMemory || o.Threads < 1 {
+			err = fmt.Errorf("%w: argon2id t=%v, m=%v, p=%v", ErrInvalidKDF, o.Time, o.Memory, o.Threads)
+		}
+	case KDFScrypt:
+		if o.LogN < 1 || o.LogN > 24 || o.R < 1 || o.R > 32 || o.P < 1 || o.P > 16 ||
+			128*uint64(o.R)<<o.LogN > maxScryptMemory {
+			err = fmt.Errorf("%w: scrypt ln=%v, r=%v, p=%v", ErrInvalidKDF, o.LogN, o.R, o.P)
+		}
+	default:
+		err = fmt.Errorf("%w: algorithm %v", ErrInvalidKDF, o.Algorithm)
+	}
+	return
+}
+
+// kdfLength is the length of the encoded parameters.
+const kdfLength = 10
+
+// marshal encodes the algorithm and its parameters in kdfLength bytes.
+func (o *KDF) marshal() (ret []byte) {
+	ret = make([]byte, kdfLength)
+	ret[0] = byte(o.Algorithm)
+	switch o.Algorithm {
+	case KDFArgon2id:
+		binary.BigEndian.PutUint32(ret[1:], o.Time)
+		binary.BigEndian.PutUint32(ret[5:], o.Memory)
+		ret[9] = o.Threads
+	case KDFScrypt:
+		ret[1] = o.LogN
+		binary.BigEndian.PutUint32(ret[2:], o.R)
+		binary.BigEndian.PutUint32(ret[6:], o.P)
+	}
+	return
+}
+
+func unmarshalKDF(data []byte) (ret *KDF, err error) {
+	if len(data) < kdfLength {
+		return nil, ErrInvalidKDF
+	}
+	ret = &KDF{Algorithm: KDFAlgorithm(data[0])}
+	switch ret.Algorithm {
+	case KDFArgon2id:
+		ret.Time = binary.BigEndian.Uint32(data[1:])
+		ret.Memory = binary.BigEndian.Uint32(data[5:])
+		ret.Threads = data[9]
+	case KDFScrypt:
+		ret.LogN = data[1]
+		ret.R = binary.BigEndian.Uint32(data[2:])
+		ret.P = binary.BigEndian.Uint32(data[6:])
+	}
+	err = ret.validate()
+	return
+}
@@ -0,0 +1,179 @@
+package encrypt
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Keyring holds encryptors by key id and the id of the active key, which encrypts new data.
+// Rotating the key is adding a new active key, the previous keys still decrypt existing data.
+type Keyring struct {
+	keys   map[string]*Encryptor
+	active string
+	mu     sync.RWMutex
+}
+
+func NewKeyring() *Keyring {
+	return &Keyring{keys: map[string]*Encryptor{}}
+}
+
+// NewKeyringPassphrase creates a keyring with the encryptor of the passphrase as active key.
+func NewKeyringPassphrase(keyID string, passphrase string) (ret *Keyring, err error) {
+	ret = NewKeyring()
+	if err = ret.AddPassphrase(keyID, passphrase, true); err != nil {
+		ret = nil
+	}
+	return
+}
+
+// Add adds the encryptor with the key id, optionally as active key.
+// The key id is written to the envelopes of the encryptor, if it has none.
+func (o *Keyring) Add(keyID string, encryptor *Encryptor, active bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if encryptor.KeyID == "" {
+		encryptor.KeyID = keyID
+	}
+	o.keys[keyID] = encryptor
+	if active {
+		o.active = keyID
+	}
+}
+
+// AddPassphrase adds the encryptor of the passphrase with the key id, optionally as active key.
+func (o *Keyring) AddPassphrase(keyID string, passphrase string, active bool) (err error) {
+	var encryptor *Encryptor
+	if encryptor, err = NewEncryptor(passphrase); err == nil {
+		o.Add(keyID, encryptor, active)
+	}
+	return
+}
+
+// Activate makes the key of the key id the active key.
+func (o *Keyring) Activate(keyID string) (err error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if _, ok := o.keys[keyID]; !ok {
+		return fmt.Errorf("%w: %v", ErrKeyNotFound, keyID)
+	}
+	o.active = keyID
+	return
+}
+
+// Active returns the key id and the encryptor of the active key.
+func (o *Keyring) Active() (keyID string, ret *Encryptor, err error) {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+
+	if o.active == "" {
+		err = fmt.Errorf("%w: no active key", ErrKeyNotFound)
+		return
+	}
+	return o.active, o.keys[o.active], nil
+}
+
+// Key returns the encryptor of the key id.
+func (o *Keyring) Key(keyID string) (ret *Encryptor, err error) {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+
+	var ok bool
+	if ret, ok = o.keys[keyID]; !ok {
+		err = fmt.Errorf("%w: %v", ErrKeyNotFound, keyID)
+	}
+	return
+}
+
+// Encrypt encrypts the data with the active key.
+func (o *Keyring) Encrypt(data []byte) (ret []byte, err error) {
+	return o.EncryptWithData(data, nil)
+}
+
+// Decrypt decrypts the data with the key of its envelope.
+func (o *Keyring) Decrypt(data []byte) (ret []byte, err error) {
+	return o.DecryptWithData(data, nil)
+}
+
+// EncryptWithData encrypts the data with the active key and authenticates the additional data.
+func (o *Keyring) EncryptWithData(data []byte, additionalData []byte) (ret []byte, err error) {
+	var encryptor *Encryptor
+	if _, encryptor, err = o.Active(); err == nil {
+		ret, err = encryptor.EncryptWithData(data, additionalData)
+	}
+	return
+}
+
+// DecryptWithData decrypts the data with the key of the key id of its envelope. Data without a known key id,
+// e.g. of the legacy format or of encryptors without key id, is decrypted by the first key, which succeeds.
+func (o *Keyring) DecryptWithData(data []byte, additionalData []byte) (ret []byte, err error) {
+	var keyID string
+	if keyID, err = EnvelopeKeyID(data); err == nil {
+		var encryptor *Encryptor
+		if encryptor, err = o.Key(keyID); err == nil {
+			return encryptor.DecryptWithData(data, additionalData)
+		}
+	} else if !errors.Is(err, ErrLegacyFormat) {
+		return
+	}
+
+	err = fmt.Errorf("%w: no key decrypts the data of the key id '%v'", ErrKeyNotFound, keyID)
+	for _, encryptor := range o.encryptors() {
+		if decrypted, decryptErr := encryptor.DecryptWithData(data, additionalData); decryptErr == nil {
+			return decrypted, nil
+		}
+	}
+	return
+}
+
+// NewWriter returns the writer, which encrypts the stream with the active key, see Encryptor.NewWriter.
+func (o *Keyring) NewWriter(w io.Writer) (ret io.WriteCloser, err error) {
+	var encryptor *Encryptor
+	if _, encryptor, err = o.Active(); err == nil {
+		ret, err = encryptor.NewWriter(w)
+	}
+	return
+}
+
+// NewReader returns the reader, which decrypts the stream with the key of the key id of its header.
+// A stream without a known key id is decrypted by the first key, which decrypts its first chunk.
+func (o *Keyring) NewReader(r io.Reader) (ret io.Reader, err error) {
+	reader := bufio.NewReader(r)
+	var header *streamHeader
+	if header, err = readStreamHeader(reader); err != nil {
+		return
+	}
+	var encryptor *Encryptor
+	if encryptor, err = o.Key(header.keyID); err == nil {
+		return encryptor.openStream(reader, header)
+	}
+
+	var chunkSize int
+	if chunkSize, err = header.chunkSize(); err != nil {
+		return
+	}
+	// buffers the first chunk to try the keys
+	reader = bufio.NewReaderSize(reader, chunkSize+maxOverhead+1)
+	err = fmt.Errorf("%w: no key decrypts the stream of the key id '%v'", ErrKeyNotFound, header.keyID)
+	for _, encryptor = range o.encryptors() {
+		if encryptor.decryptsStream(reader, header) {
+			return encryptor.openStream(reader, header)
+		}
+	}
+	return
+}
+
+func (o *Keyring) encryptors() (ret []*Encryptor) {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+
+	ret = make([]*Encryptor, 0, len(o.keys))
+	for _, encryptor := range o.keys {
+		ret = append(ret, encryptor)
+	}
+	return
+}
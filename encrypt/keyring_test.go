@@ -0,0 +1,140 @@
+package encrypt
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func newTestKeyring(t *testing.T, keyIDs ...string) *Keyring {
+	t.Helper()
+	keyring := NewKeyring()
+	for _, keyID := range keyIDs {
+		encryptor, err := NewEncryptorKDF("passphrase of "+keyID, testKDF)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keyring.Add(keyID, encryptor, true)
+	}
+	return keyring
+}
+
+func TestKeyringRotation(t *testing.T) {
+	keyring := newTestKeyring(t, "old")
+	encrypted, err := keyring.Encrypt([]byte("data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldKey, _ := keyring.Key("old")
+	legacy, _ := newGCM([]byte(createHash("passphrase of old")))
+	nonce := make([]byte, legacy.NonceSize())
+	legacyEncrypted := legacy.Seal(nonce, nonce, []byte("legacy"), nil)
+
+	rotated := newTestKeyring(t, "new")
+	rotated.Add("old", oldKey, false)
+	if decrypted, err := rotated.Decrypt(encrypted); err != nil || string(decrypted) != "data" {
+		t.Fatalf("expected data, got %s, %v", decrypted, err)
+	}
+	if decrypted, err := rotated.Decrypt(legacyEncrypted); err != nil || string(decrypted) != "legacy" {
+		t.Fatalf("expected legacy, got %s, %v", decrypted, err)
+	}
+	if _, err := newTestKeyring(t, "new").Decrypt(encrypted); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("expected key not found, got %v", err)
+	}
+}
+
+func TestKeyringReEncryptFolder(t *testing.T) {
+	folder := t.TempDir()
+	keyring := newTestKeyring(t, "old")
+	oldKey, _ := keyring.Key("old")
+
+	encrypted, _ := keyring.Encrypt([]byte("email"))
+	writeTestFile(t, filepath.Join(folder, "email.txt"), encrypted)
+	streamData := make([]byte, 2*DefaultChunkSize+1)
+	_, _ = rand.Read(streamData)
+	var stream bytes.Buffer
+	writer, _ := keyring.NewWriter(&stream)
+	_, _ = writer.Write(streamData)
+	_ = writer.Close()
+	writeTestFile(t, filepath.Join(folder, "sub", "export.bin"), stream.Bytes())
+	writeTestFile(t, filepath.Join(folder, "plain.txt"), []byte("plain"))
+
+	keyring = newTestKeyring(t, "new")
+	keyring.Add("old", oldKey, false)
+	result, err := keyring.ReEncryptFolder(folder, nil)
+	if err != nil || result.ReEncrypted != 2 || result.Skipped != 1 || len(result.Errors) != 0 {
+		t.Fatalf("expected 2 re-encrypted files, got %+v, %v", result, err)
+	}
+
+	// the files are readable without the old key
+	newOnly := NewKeyring()
+	newKey, _ := keyring.Key("new")
+	newOnly.Add("new", newKey, true)
+	data, _ := os.ReadFile(filepath.Join(folder, "email.txt"))
+	if decrypted, err := newOnly.Decrypt(data); err != nil || string(decrypted) != "email" {
+		t.Fatalf("expected email, got %s, %v", decrypted, err)
+	}
+	file, _ := os.Open(filepath.Join(folder, "sub", "export.bin"))
+	defer file.Close()
+	reader, err := newOnly.NewReader(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decrypted, err := io.ReadAll(reader); err != nil || !bytes.Equal(decrypted, streamData) {
+		t.Fatalf("expected the stream data, got %v bytes, %v", len(decrypted), err)
+	}
+
+	if result, err = keyring.ReEncryptFolder(folder, nil); err != nil || result.ReEncrypted != 0 || result.Skipped != 3 {
+		t.Fatalf("expected all files skipped, got %+v, %v", result, err)
+	}
+}
+
+func TestKeyringWithoutKeyID(t *testing.T) {
+	folder := t.TempDir()
+	// the envelopes of an encryptor, which is not in a keyring, have no key id
+	plain, _ := NewEncryptorKDF("passphrase of plain", testKDF)
+	encrypted, _ := plain.Encrypt([]byte("email"))
+	writeTestFile(t, filepath.Join(folder, "email.txt"), encrypted)
+	streamData := make([]byte, DefaultChunkSize+1)
+	_, _ = rand.Read(streamData)
+	var stream bytes.Buffer
+	writer, _ := plain.NewWriter(&stream)
+	_, _ = writer.Write(streamData)
+	_ = writer.Close()
+	writeTestFile(t, filepath.Join(folder, "export.bin"), stream.Bytes())
+
+	keyring := newTestKeyring(t, "other", "new")
+	keyring.Add("plain", plain, false)
+	if decrypted, err := keyring.Decrypt(encrypted); err != nil || string(decrypted) != "email" {
+		t.Fatalf("expected email, got %s, %v", decrypted, err)
+	}
+	reader, err := keyring.NewReader(bytes.NewReader(stream.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decrypted, err := io.ReadAll(reader); err != nil || !bytes.Equal(decrypted, streamData) {
+		t.Fatalf("expected the stream data, got %v bytes, %v", len(decrypted), err)
+	}
+
+	result, err := keyring.ReEncryptFolder(folder, nil)
+	if err != nil || result.ReEncrypted != 2 || len(result.Errors) != 0 {
+		t.Fatalf("expected 2 re-encrypted files, got %+v, %v", result, err)
+	}
+	if _, err = newTestKeyring(t, "other").Decrypt(encrypted); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("expected key not found, got %v", err)
+	}
+}
+
+func writeTestFile(t *testing.T, fileName string, data []byte) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(fileName), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(fileName, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,63 @@
+package encrypt
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+)
+
+// LoadPrivateKey loads the PEM encoded private key of the file, PKCS#8 or PKCS#1 of RSA,
+// e.g. of the files of net.RsaKeys. The key is *rsa.PrivateKey, ed25519.PrivateKey or *ecdh.PrivateKey.
+func LoadPrivateKey(fileName string) (ret interface{}, err error) {
+	var block *pem.Block
+	if block, err = loadPEM(fileName); err != nil {
+		return
+	}
+	if block.Type == "RSA PRIVATE KEY" {
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	}
+	return x509.ParsePKCS8PrivateKey(block.Bytes)
+}
+
+// LoadPublicKey loads the PEM encoded public key of the file, PKIX or PKCS#1 of RSA,
+// e.g. of the files of net.RsaKeys. The key is *rsa.PublicKey, ed25519.PublicKey or *ecdh.PublicKey.
+func LoadPublicKey(fileName string) (ret interface{}, err error) {
+	var block *pem.Block
+	if block, err = loadPEM(fileName); err != nil {
+		return
+	}
+	if ret, err = x509.ParsePKIXPublicKey(block.Bytes); err != nil && block.Type == "RSA PUBLIC KEY" {
+		ret, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	}
+	return
+}
+
+// SavePrivateKey writes the private key PEM encoded as PKCS#8, readable by the owner only.
+func SavePrivateKey(fileName string, privateKey interface{}) (err error) {
+	var data []byte
+	if data, err = x509.MarshalPKCS8PrivateKey(privateKey); err == nil {
+		err = os.WriteFile(fileName, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: data}), 0600)
+	}
+	return
+}
+
+// SavePublicKey writes the public key PEM encoded as PKIX.
+func SavePublicKey(fileName string, publicKey interface{}) (err error) {
+	var data []byte
+	if data, err = x509.MarshalPKIXPublicKey(publicKey); err == nil {
+		err = os.WriteFile(fileName, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: data}), 0644)
+	}
+	return
+}
+
+func loadPEM(fileName string) (ret *pem.Block, err error) {
+	var data []byte
+	if data, err = os.ReadFile(fileName); err != nil {
+		return
+	}
+	if ret, _ = pem.Decode(data); ret == nil {
+		err = fmt.Errorf("no PEM data in %v", fileName)
+	}
+	return
+}
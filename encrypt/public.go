@@ -0,0 +1,247 @@
+package encrypt
+
+import (
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// The sealed data for recipients is
+//
+//	magic "GEEP" | version | recipient count | (algorithm | length | wrapped data key)* | nonce | cipher text
+//
+// the data is encrypted by AES-GCM with a random data key, which is wrapped for each recipient.
+// The header up to the nonce is authenticated as additional data.
+var recipientsMagic = []byte("GEEP")
+
+const (
+	wrapX25519  byte = 1
+	wrapRSAOAEP byte = 2
+)
+
+var (
+	// ErrNoRecipient is returned by DecryptBy, if the identity is none of the recipients.
+	ErrNoRecipient = errors.New("not a recipient of the encrypted data")
+	// ErrUnsupportedKey is returned for keys of types, which are not supported.
+	ErrUnsupportedKey = errors.New("unsupported key type")
+)
+
+var (
+	x25519Info = []byte("go-ee/utils/encrypt x25519")
+	rsaLabel   = []byte("go-ee/utils/encrypt rsa-oaep")
+)
+
+// Recipient wraps the data keys for its private key, the Identity.
+type Recipient interface {
+	wrap(dataKey []byte) (algorithm byte, wrapped []byte, err error)
+}
+
+// Identity unwraps the data keys, which are wrapped for its Recipient.
+type Identity interface {
+	unwrap(algorithm byte, wrapped []byte) (dataKey []byte, err error)
+}
+
+// X25519Recipient wraps the data keys by the X25519 key agreement with an ephemeral key.
+type X25519Recipient struct {
+	PublicKey *ecdh.PublicKey
+}
+
+type X25519Identity struct {
+	PrivateKey *ecdh.PrivateKey
+}
+
+func GenerateX25519Identity() (ret *X25519Identity, err error) {
+	var key *ecdh.PrivateKey
+	if key, err = ecdh.X25519().GenerateKey(rand.Reader); err == nil {
+		ret = &X25519Identity{PrivateKey: key}
+	}
+	return
+}
+
+func (o *X25519Identity) Recipient() *X25519Recipient {
+	return &X25519Recipient{PublicKey: o.PrivateKey.PublicKey()}
+}
+
+// wrap encrypts the data key with the key derived from the shared secret, the wrapped key starts with the ephemeral
+// public key. The derived key is used once, so that the nonce is zero.
+func (o *X25519Recipient) wrap(dataKey []byte) (algorithm byte, wrapped []byte, err error) {
+	var ephemeral *ecdh.PrivateKey
+	if ephemeral, err = ecdh.X25519().GenerateKey(rand.Reader); err != nil {
+		return
+	}
+	var shared []byte
+	if shared, err = ephemeral.ECDH(o.PublicKey); err != nil {
+		return
+	}
+	var aead cipher.AEAD
+	if aead, err = x25519KeyWrap(shared, ephemeral.PublicKey(), o.PublicKey); err != nil {
+		return
+	}
+	wrapped = ephemeral.PublicKey().Bytes()
+	wrapped = aead.Seal(wrapped, make([]byte, aead.NonceSize()), dataKey, nil)
+	return wrapX25519, wrapped, nil
+}
+
+func (o *X25519Identity) unwrap(algorithm byte, wrapped []byte) (ret []byte, err error) {
+	if algorithm != wrapX25519 || len(wrapped) < 32 {
+		return nil, ErrNoRecipient
+	}
+	var ephemeral *ecdh.PublicKey
+	if ephemeral, err = ecdh.X25519().NewPublicKey(wrapped[:32]); err != nil {
+		return
+	}
+	var shared []byte
+	if shared, err = o.PrivateKey.ECDH(ephemeral); err != nil {
+		return
+	}
+	var aead cipher.AEAD
+	if aead, err = x25519KeyWrap(shared, ephemeral, o.PrivateKey.PublicKey()); err == nil {
+		ret, err = aead.Open(nil, make([]byte, aead.NonceSize()), wrapped[32:], nil)
+	}
+	return
+}
+
+// x25519KeyWrap returns the AEAD of the key derived from the shared secret, bound to both public keys.
+func x25519KeyWrap(shared []byte, ephemeral *ecdh.PublicKey, recipient *ecdh.PublicKey) (ret cipher.AEAD, err error) {
+	salt := append(append([]byte{}, ephemeral.Bytes()...), recipient.Bytes()...)
+	key := make([]byte, keyLength)
+	if _, err = io.ReadFull(hkdf.New(sha256.New, shared, salt, x25519Info), key); err == nil {
+		ret, err = newGCM(key)
+	}
+	return
+}
+
+// RSARecipient wraps the data keys by RSA-OAEP with SHA-256.
+type RSARecipient struct {
+	PublicKey *rsa.PublicKey
+}
+
+type RSAIdentity struct {
+	PrivateKey *rsa.PrivateKey
+}
+
+func (o *RSAIdentity) Recipient() *RSARecipient {
+	return &RSARecipient{PublicKey: &o.PrivateKey.PublicKey}
+}
+
+func (o *RSARecipient) wrap(dataKey []byte) (algorithm byte, wrapped []byte, err error) {
+	wrapped, err = rsa.EncryptOAEP(sha256.New(), rand.Reader, o.PublicKey, dataKey, rsaLabel)
+	return wrapRSAOAEP, wrapped, err
+}
+
+func (o *RSAIdentity) unwrap(algorithm byte, wrapped []byte) (ret []byte, err error) {
+	if algorithm != wrapRSAOAEP {
+		return nil, ErrNoRecipient
+	}
+	return rsa.DecryptOAEP(sha256.New(), nil, o.PrivateKey, wrapped, rsaLabel)
+}
+
+// NewRecipient returns the recipient of the public key, *ecdh.PublicKey of X25519 or *rsa.PublicKey.
+func NewRecipient(publicKey interface{}) (ret Recipient, err error) {
+	switch key := publicKey.(type) {
+	case *ecdh.PublicKey:
+		if key.Curve() == ecdh.X25519() {
+			return &X25519Recipient{PublicKey: key}, nil
+		}
+	case *rsa.PublicKey:
+		return &RSARecipient{PublicKey: key}, nil
+	}
+	return nil, fmt.Errorf("%w: %T", ErrUnsupportedKey, publicKey)
+}
+
+// NewIdentity returns the identity of the private key, *ecdh.PrivateKey of X25519 or *rsa.PrivateKey.
+func NewIdentity(privateKey interface{}) (ret Identity, err error) {
+	switch key := privateKey.(type) {
+	case *ecdh.PrivateKey:
+		if key.Curve() == ecdh.X25519() {
+			return &X25519Identity{PrivateKey: key}, nil
+		}
+	case *rsa.PrivateKey:
+		return &RSAIdentity{PrivateKey: key}, nil
+	}
+	return nil, fmt.Errorf("%w: %T", ErrUnsupportedKey, privateKey)
+}
+
+// EncryptFor encrypts the data for the recipients and authenticates the additional data,
+// each recipient decrypts it with its identity by DecryptBy, without a shared secret.
+func EncryptFor(data []byte, additionalData []byte, recipients ...Recipient) (ret []byte, err error) {
+	if len(recipients) == 0 || len(recipients) > 255 {
+		return nil, fmt.Errorf("encrypt for 1 to 255 recipients, not %v", len(recipients))
+	}
+	var dataKey []byte
+	if dataKey, err = randomBytes(keyLength); err != nil {
+		return
+	}
+
+	header := append(append([]byte{}, recipientsMagic...), envelopeVersion, byte(len(recipients)))
+	for _, recipient := range recipients {
+		var algorithm byte
+		var wrapped []byte
+		if algorithm, wrapped, err = recipient.wrap(dataKey); err != nil {
+			return
+		}
+		header = append(header, algorithm)
+		header = binary.BigEndian.AppendUint16(header, uint16(len(wrapped)))
+		header = append(header, wrapped...)
+	}
+
+	var aead cipher.AEAD
+	if aead, err = newGCM(dataKey); err != nil {
+		return
+	}
+	var nonce []byte
+	if nonce, err = randomBytes(aead.NonceSize()); err != nil {
+		return
+	}
+	ret = append(header, nonce...)
+	ret = aead.Seal(ret, nonce, data, append(header[:len(header):len(header)], additionalData...))
+	return
+}
+
+// DecryptBy decrypts the data of EncryptFor with the identity of one of the recipients.
+func DecryptBy(data []byte, additionalData []byte, identity Identity) (ret []byte, err error) {
+	pos := len(recipientsMagic) + 2
+	if len(data) < pos || string(data[:len(recipientsMagic)]) != string(recipientsMagic) ||
+		data[len(recipientsMagic)] != envelopeVersion {
+		return nil, fmt.Errorf("%w: no data encrypted for recipients", ErrInvalidEnvelope)
+	}
+
+	var dataKey []byte
+	for count := int(data[pos-1]); count > 0; count-- {
+		if pos+3 > len(data) {
+			return nil, fmt.Errorf("%w: truncated recipients", ErrInvalidEnvelope)
+		}
+		algorithm, length := data[pos], int(binary.BigEndian.Uint16(data[pos+1:]))
+		if pos += 3; pos+length > len(data) {
+			return nil, fmt.Errorf("%w: truncated recipients", ErrInvalidEnvelope)
+		}
+		if dataKey == nil {
+			if key, unwrapErr := identity.unwrap(algorithm, data[pos:pos+length]); unwrapErr == nil {
+				dataKey = key
+			}
+		}
+		pos += length
+	}
+	if dataKey == nil {
+		return nil, ErrNoRecipient
+	}
+
+	var aead cipher.AEAD
+	if aead, err = newGCM(dataKey); err != nil {
+		return
+	}
+	header := data[:pos]
+	if len(data) < pos+aead.NonceSize() {
+		return nil, ErrCipherTextTooShort
+	}
+	nonce := data[pos : pos+aead.NonceSize()]
+	return aead.Open(nil, nonce, data[pos+aead.NonceSize():], append(header[:len(header):len(header)], additionalData...))
+}
@@ -0,0 +1,142 @@
+package encrypt
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEncryptForRecipients(t *testing.T) {
+	x25519, err := GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaIdentity := &RSAIdentity{PrivateKey: rsaKey}
+
+	encrypted, err := EncryptFor([]byte("data"), []byte("name"), x25519.Recipient(), rsaIdentity.Recipient())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, identity := range []Identity{x25519, rsaIdentity} {
+		if decrypted, err := DecryptBy(encrypted, []byte("name"), identity); err != nil || string(decrypted) != "data" {
+			t.Fatalf("%T: expected data, got %s, %v", identity, decrypted, err)
+		}
+	}
+
+	other, _ := GenerateX25519Identity()
+	if _, err = DecryptBy(encrypted, []byte("name"), other); !errors.Is(err, ErrNoRecipient) {
+		t.Fatalf("expected no recipient, got %v", err)
+	}
+	if _, err = DecryptBy(encrypted, []byte("other"), x25519); err == nil {
+		t.Fatal("expected an error for other additional data")
+	}
+}
+
+func TestSignatures(t *testing.T) {
+	_, ed25519Key, _ := ed25519.GenerateKey(rand.Reader)
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	fileName := filepath.Join(t.TempDir(), "export.json")
+	if err := os.WriteFile(fileName, []byte("{}"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, privateKey := range []interface{}{ed25519Key, rsaKey} {
+		signer, err := NewSigner(privateKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		verifier, err := NewVerifier(privateKey.(crypto.Signer).Public())
+		if err != nil {
+			t.Fatal(err)
+		}
+		signature, _ := signer.Sign([]byte("config"))
+		if err = verifier.Verify([]byte("config"), signature); err != nil {
+			t.Fatalf("%T: %v", signer, err)
+		}
+		if err = verifier.Verify([]byte("changed"), signature); !errors.Is(err, ErrInvalidSignature) {
+			t.Fatalf("%T: expected invalid signature, got %v", signer, err)
+		}
+		if err = SignFile(fileName, signer); err != nil {
+			t.Fatal(err)
+		}
+		if err = VerifyFile(fileName, verifier); err != nil {
+			t.Fatalf("%T: %v", signer, err)
+		}
+
+		// the digest is signed once, by RSA-PSS like the data or by Ed25519ph
+		signature, err = SignReader(bytes.NewReader([]byte("{}")), signer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		switch key := privateKey.(type) {
+		case *rsa.PrivateKey:
+			err = verifier.Verify([]byte("{}"), signature)
+		case ed25519.PrivateKey:
+			digest := sha512.Sum512([]byte("{}"))
+			err = ed25519.VerifyWithOptions(key.Public().(ed25519.PublicKey), digest[:], signature,
+				&ed25519.Options{Hash: crypto.SHA512})
+		}
+		if err != nil {
+			t.Fatalf("%T: %v", signer, err)
+		}
+	}
+	if _, err := SignReader(bytes.NewReader(nil), &testSigner{}); !errors.Is(err, ErrUnsupportedKey) {
+		t.Fatalf("expected unsupported key, got %v", err)
+	}
+}
+
+type testSigner struct{}
+
+func (o *testSigner) Sign(data []byte) ([]byte, error) {
+	return data, nil
+}
+
+func TestLoadKeysOfRsaKeysFiles(t *testing.T) {
+	folder := t.TempDir()
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	// the encoding of net.RsaKeys
+	publicData, _ := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	writeTestFile(t, filepath.Join(folder, "app.rsa"),
+		pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)}))
+	writeTestFile(t, filepath.Join(folder, "app.rsa.pub"),
+		pem.EncodeToMemory(&pem.Block{Type: "RSA PUBLIC KEY", Bytes: publicData}))
+
+	privateKey, err := LoadPrivateKey(filepath.Join(folder, "app.rsa"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicKey, err := LoadPublicKey(filepath.Join(folder, "app.rsa.pub"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	recipient, _ := NewRecipient(publicKey)
+	identity, _ := NewIdentity(privateKey)
+	encrypted, _ := EncryptFor([]byte("data"), nil, recipient)
+	if decrypted, err := DecryptBy(encrypted, nil, identity); err != nil || string(decrypted) != "data" {
+		t.Fatalf("expected data, got %s, %v", decrypted, err)
+	}
+
+	x25519, _ := GenerateX25519Identity()
+	if err = SavePrivateKey(filepath.Join(folder, "x25519"), x25519.PrivateKey); err != nil {
+		t.Fatal(err)
+	}
+	if privateKey, err = LoadPrivateKey(filepath.Join(folder, "x25519")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = NewIdentity(privateKey); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,156 @@
+package encrypt
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/go-ee/utils/eio"
+)
+
+// ReEncryptOptions are the options of ReEncryptFolder.
+type ReEncryptOptions struct {
+	// Match selects the files by their path, all files if nil.
+	Match func(path string) bool
+	// Legacy re-encrypts the files without envelope as files of the legacy format, they are skipped otherwise,
+	// because they can't be told apart from plain files.
+	Legacy bool
+}
+
+// ReEncryptResult counts the files of ReEncryptFolder, with the errors of the files, which are not re-encrypted.
+type ReEncryptResult struct {
+	ReEncrypted int
+	Skipped     int
+	Errors      []error
+}
+
+// ReEncryptFolder re-encrypts the encrypted files of the folder and its sub folders with the active key,
+// e.g. after a key rotation. The files are encrypted without additional data, like by Encryptor.EncryptFile,
+// or as streams, like by Encryptor.EncryptFileStream. Files of the active key are skipped.
+// Each file is replaced atomically, the errors of the files don't stop the walk.
+func (o *Keyring) ReEncryptFolder(folder string, options *ReEncryptOptions) (ret *ReEncryptResult, err error) {
+	if options == nil {
+		options = &ReEncryptOptions{}
+	}
+	var activeKeyID string
+	if activeKeyID, _, err = o.Active(); err != nil {
+		return
+	}
+
+	ret = &ReEncryptResult{}
+	err = filepath.WalkDir(folder, func(path string, entry fs.DirEntry, walkErr error) error {
+		if walkErr != nil {
+			return walkErr
+		}
+		if !entry.Type().IsRegular() || (options.Match != nil && !options.Match(path)) {
+			return nil
+		}
+		if reEncrypted, fileErr := o.reEncryptFile(path, activeKeyID, options.Legacy); fileErr != nil {
+			ret.Errors = append(ret.Errors, fmt.Errorf("%v: %w", path, fileErr))
+		} else if reEncrypted {
+			ret.ReEncrypted++
+		} else {
+			ret.Skipped++
+		}
+		return nil
+	})
+	return
+}
+
+func (o *Keyring) reEncryptFile(fileName string, activeKeyID string, legacy bool) (ret bool, err error) {
+	var info os.FileInfo
+	if info, err = os.Stat(fileName); err != nil {
+		return
+	}
+	prefix := make([]byte, len(envelopeMagic)+1)
+	var file *os.File
+	if file, err = os.Open(fileName); err != nil {
+		return
+	}
+	n, _ := io.ReadFull(file, prefix)
+	file.Close()
+	prefix = prefix[:n]
+
+	if isStream(prefix) {
+		return o.reEncryptStream(fileName, info.Mode().Perm(), activeKeyID)
+	}
+	if !isEnvelope(prefix) && !legacy {
+		return
+	}
+
+	var data []byte
+	if data, err = os.ReadFile(fileName); err != nil {
+		return
+	}
+	if keyID, keyErr := EnvelopeKeyID(data); keyErr == nil && keyID == activeKeyID {
+		return
+	}
+	var plain []byte
+	if plain, err = o.Decrypt(data); err != nil {
+		return
+	}
+	if data, err = o.Encrypt(plain); err == nil {
+		err = eio.WriteFileAtomic(fileName, data, info.Mode().Perm())
+		ret = err == nil
+	}
+	return
+}
+
+// reEncryptStream re-encrypts the stream to a temporary file, which replaces the file.
+func (o *Keyring) reEncryptStream(fileName string, perm os.FileMode, activeKeyID string) (ret bool, err error) {
+	var source *os.File
+	if source, err = os.Open(fileName); err != nil {
+		return
+	}
+	defer source.Close()
+
+	var header *streamHeader
+	reader := &bytes.Buffer{}
+	if header, err = readStreamHeader(io.TeeReader(source, reader)); err != nil || header.keyID == activeKeyID {
+		return
+	}
+	var plain io.Reader
+	if plain, err = o.NewReader(io.MultiReader(reader, source)); err != nil {
+		return
+	}
+
+	var target *os.File
+	if target, err = os.CreateTemp(filepath.Dir(fileName), filepath.Base(fileName)+".*.tmp"); err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			target.Close()
+			os.Remove(target.Name())
+		}
+	}()
+
+	var writer io.WriteCloser
+	if writer, err = o.NewWriter(target); err != nil {
+		return
+	}
+	if _, err = io.Copy(writer, plain); err != nil {
+		return
+	}
+	if err = writer.Close(); err != nil {
+		return
+	}
+	if err = target.Chmod(perm); err != nil {
+		return
+	}
+	if err = target.Sync(); err != nil {
+		return
+	}
+	if err = target.Close(); err != nil {
+		return
+	}
+	source.Close()
+	if err = os.Rename(target.Name(), fileName); err == nil {
+		ret = true
+		err = eio.SyncFolder(filepath.Dir(fileName))
+	}
+	return
+}
@@ -0,0 +1,213 @@
+package encrypt
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// ErrInvalidSignature is returned, if a signature doesn't match the data.
+var ErrInvalidSignature = errors.New("invalid signature")
+
+// Signer creates detached signatures of data.
+type Signer interface {
+	Sign(data []byte) (signature []byte, err error)
+}
+
+// Verifier verifies detached signatures, the error is ErrInvalidSignature, if the signature doesn't match.
+type Verifier interface {
+	Verify(data []byte, signature []byte) error
+}
+
+// DigestSigner signs the digest of the data by its Hash, e.g. for data, which is not loaded at once.
+type DigestSigner interface {
+	Hash() crypto.Hash
+	SignDigest(digest []byte) (signature []byte, err error)
+}
+
+// DigestVerifier verifies the signatures of DigestSigner.
+type DigestVerifier interface {
+	Hash() crypto.Hash
+	VerifyDigest(digest []byte, signature []byte) error
+}
+
+// ed25519phOptions select Ed25519ph, the Ed25519 signature of the SHA-512 digest of the data.
+var ed25519phOptions = &ed25519.Options{Hash: crypto.SHA512}
+
+type Ed25519Signer struct {
+	PrivateKey ed25519.PrivateKey
+}
+
+func (o *Ed25519Signer) Sign(data []byte) ([]byte, error) {
+	return ed25519.Sign(o.PrivateKey, data), nil
+}
+
+func (o *Ed25519Signer) Hash() crypto.Hash {
+	return crypto.SHA512
+}
+
+// SignDigest signs the SHA-512 digest by Ed25519ph.
+func (o *Ed25519Signer) SignDigest(digest []byte) ([]byte, error) {
+	return o.PrivateKey.Sign(nil, digest, ed25519phOptions)
+}
+
+type Ed25519Verifier struct {
+	PublicKey ed25519.PublicKey
+}
+
+func (o *Ed25519Verifier) Verify(data []byte, signature []byte) (err error) {
+	if !ed25519.Verify(o.PublicKey, data, signature) {
+		err = ErrInvalidSignature
+	}
+	return
+}
+
+func (o *Ed25519Verifier) Hash() crypto.Hash {
+	return crypto.SHA512
+}
+
+// VerifyDigest verifies the Ed25519ph signature of the SHA-512 digest.
+func (o *Ed25519Verifier) VerifyDigest(digest []byte, signature []byte) (err error) {
+	if ed25519.VerifyWithOptions(o.PublicKey, digest, signature, ed25519phOptions) != nil {
+		err = ErrInvalidSignature
+	}
+	return
+}
+
+// RSASigner signs by RSA-PSS with SHA-256.
+type RSASigner struct {
+	PrivateKey *rsa.PrivateKey
+}
+
+func (o *RSASigner) Sign(data []byte) ([]byte, error) {
+	digest := sha256.Sum256(data)
+	return o.SignDigest(digest[:])
+}
+
+func (o *RSASigner) Hash() crypto.Hash {
+	return crypto.SHA256
+}
+
+// SignDigest signs the SHA-256 digest.
+func (o *RSASigner) SignDigest(digest []byte) ([]byte, error) {
+	return rsa.SignPSS(rand.Reader, o.PrivateKey, crypto.SHA256, digest, nil)
+}
+
+type RSAVerifier struct {
+	PublicKey *rsa.PublicKey
+}
+
+func (o *RSAVerifier) Verify(data []byte, signature []byte) (err error) {
+	digest := sha256.Sum256(data)
+	return o.VerifyDigest(digest[:], signature)
+}
+
+func (o *RSAVerifier) Hash() crypto.Hash {
+	return crypto.SHA256
+}
+
+// VerifyDigest verifies the signature of the SHA-256 digest.
+func (o *RSAVerifier) VerifyDigest(digest []byte, signature []byte) (err error) {
+	if rsa.VerifyPSS(o.PublicKey, crypto.SHA256, digest, signature, nil) != nil {
+		err = ErrInvalidSignature
+	}
+	return
+}
+
+// NewSigner returns the signer of the private key, ed25519.PrivateKey or *rsa.PrivateKey.
+func NewSigner(privateKey interface{}) (ret Signer, err error) {
+	switch key := privateKey.(type) {
+	case ed25519.PrivateKey:
+		return &Ed25519Signer{PrivateKey: key}, nil
+	case *ed25519.PrivateKey:
+		return &Ed25519Signer{PrivateKey: *key}, nil
+	case *rsa.PrivateKey:
+		return &RSASigner{PrivateKey: key}, nil
+	}
+	return nil, fmt.Errorf("%w: %T", ErrUnsupportedKey, privateKey)
+}
+
+// NewVerifier returns the verifier of the public key, ed25519.PublicKey or *rsa.PublicKey.
+func NewVerifier(publicKey interface{}) (ret Verifier, err error) {
+	switch key := publicKey.(type) {
+	case ed25519.PublicKey:
+		return &Ed25519Verifier{PublicKey: key}, nil
+	case *ed25519.PublicKey:
+		return &Ed25519Verifier{PublicKey: *key}, nil
+	case *rsa.PublicKey:
+		return &RSAVerifier{PublicKey: key}, nil
+	}
+	return nil, fmt.Errorf("%w: %T", ErrUnsupportedKey, publicKey)
+}
+
+// SignReader signs the digest of the data of the reader, so that large files are signed without loading them.
+// The signature is the one of Sign of the data for RSA-PSS and the Ed25519ph signature for Ed25519.
+// The signer must be a DigestSigner.
+func SignReader(r io.Reader, signer Signer) (ret []byte, err error) {
+	digestSigner, ok := signer.(DigestSigner)
+	if !ok {
+		return nil, fmt.Errorf("%w: %T doesn't sign digests", ErrUnsupportedKey, signer)
+	}
+	var digest []byte
+	if digest, err = readerDigest(r, digestSigner.Hash()); err == nil {
+		ret, err = digestSigner.SignDigest(digest)
+	}
+	return
+}
+
+// VerifyReader verifies the signature of SignReader of the data of the reader, the verifier must be a DigestVerifier.
+func VerifyReader(r io.Reader, signature []byte, verifier Verifier) (err error) {
+	digestVerifier, ok := verifier.(DigestVerifier)
+	if !ok {
+		return fmt.Errorf("%w: %T doesn't verify digests", ErrUnsupportedKey, verifier)
+	}
+	var digest []byte
+	if digest, err = readerDigest(r, digestVerifier.Hash()); err == nil {
+		err = digestVerifier.VerifyDigest(digest, signature)
+	}
+	return
+}
+
+// SignFile signs the file by SignReader and writes the detached signature to the file with the suffix ".sig".
+func SignFile(fileName string, signer Signer) (err error) {
+	var file *os.File
+	if file, err = os.Open(fileName); err != nil {
+		return
+	}
+	defer file.Close()
+
+	var signature []byte
+	if signature, err = SignReader(file, signer); err == nil {
+		err = os.WriteFile(fileName+".sig", signature, 0644)
+	}
+	return
+}
+
+// VerifyFile verifies the file by the detached signature of SignFile.
+func VerifyFile(fileName string, verifier Verifier) (err error) {
+	var signature []byte
+	if signature, err = os.ReadFile(fileName + ".sig"); err != nil {
+		return
+	}
+	var file *os.File
+	if file, err = os.Open(fileName); err != nil {
+		return
+	}
+	defer file.Close()
+	err = VerifyReader(file, signature, verifier)
+	return
+}
+
+func readerDigest(r io.Reader, hashType crypto.Hash) (ret []byte, err error) {
+	hash := hashType.New()
+	if _, err = io.Copy(hash, r); err == nil {
+		ret = hash.Sum(nil)
+	}
+	return
+}
@@ -0,0 +1,324 @@
+package encrypt
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// The stream of encrypted chunks, for data too large to encrypt in memory, is
+//
+//	magic "GEES" | version | KDF parameters | salt length | salt | key id length | key id | chunk size | nonce prefix
+//	chunk* | last chunk
+//
+// Each chunk is sealed with the header as additional data and the nonce: nonce prefix | counter | last flag,
+// so that chunks can't be reordered and a stream without its last chunk is detected as truncated.
+var streamMagic = []byte("GEES")
+
+const (
+	// DefaultChunkSize is the size of the plain chunks of the streams.
+	DefaultChunkSize = 64 * 1024
+	maxChunkSize     = 16 * 1024 * 1024
+	noncePrefixSize  = 7
+	// maxOverhead is the overhead of the AES-GCM of the chunks
+	maxOverhead = 16
+)
+
+var (
+	// ErrStreamCorrupted is returned for chunks, which are changed, reordered or missing, e.g. of truncated streams.
+	ErrStreamCorrupted = errors.New("encrypted stream corrupted or truncated")
+	ErrStreamClosed    = errors.New("encrypted stream closed")
+)
+
+// NewWriter returns the writer, which encrypts the written data in chunks to the writer.
+// Close writes the last chunk, it doesn't close the writer.
+func (o *Encryptor) NewWriter(w io.Writer) (ret io.WriteCloser, err error) {
+	var header []byte
+	if header, err = buildHeader(streamMagic, o.kdf, o.salt, o.KeyID); err != nil {
+		return
+	}
+	header = binary.BigEndian.AppendUint32(header, DefaultChunkSize)
+	var prefix []byte
+	if prefix, err = randomBytes(noncePrefixSize); err != nil {
+		return
+	}
+	header = append(header, prefix...)
+	if _, err = w.Write(header); err != nil {
+		return
+	}
+	ret = &streamWriter{stream: newStream(o.AEAD, header, prefix), w: w,
+		buffer: make([]byte, 0, DefaultChunkSize)}
+	return
+}
+
+// NewReader returns the reader, which decrypts the stream of NewWriter of the reader.
+// Reading fails with ErrStreamCorrupted, if the stream is changed or truncated.
+func (o *Encryptor) NewReader(r io.Reader) (ret io.Reader, err error) {
+	reader := bufio.NewReader(r)
+	var header *streamHeader
+	if header, err = readStreamHeader(reader); err == nil {
+		ret, err = o.openStream(reader, header)
+	}
+	return
+}
+
+// openStream returns the reader of the chunks of the stream after its header.
+func (o *Encryptor) openStream(reader *bufio.Reader, streamHeader *streamHeader) (ret io.Reader, err error) {
+	var chunkSize int
+	if chunkSize, err = streamHeader.chunkSize(); err != nil {
+		return
+	}
+	var aead cipher.AEAD
+	if aead, err = o.derive(streamHeader.kdf, streamHeader.salt); err != nil {
+		return
+	}
+	ret = &streamReader{stream: newStream(aead, streamHeader.data, streamHeader.noncePrefix()), r: reader,
+		chunk: make([]byte, chunkSize+aead.Overhead())}
+	return
+}
+
+// decryptsStream returns true, if the key decrypts the first chunk of the stream, without consuming it.
+// The reader must buffer more than a chunk.
+func (o *Encryptor) decryptsStream(reader *bufio.Reader, streamHeader *streamHeader) bool {
+	chunkSize, err := streamHeader.chunkSize()
+	if err != nil {
+		return false
+	}
+	var aead cipher.AEAD
+	if aead, err = o.derive(streamHeader.kdf, streamHeader.salt); err != nil {
+		return false
+	}
+	chunk, _ := reader.Peek(chunkSize + aead.Overhead() + 1)
+	last := len(chunk) <= chunkSize+aead.Overhead()
+	if !last {
+		chunk = chunk[:len(chunk)-1]
+	}
+	nonce, _ := newStream(aead, streamHeader.data, streamHeader.noncePrefix()).nextNonce(last)
+	_, err = aead.Open(nil, nonce, chunk, streamHeader.data)
+	return err == nil
+}
+
+// EncryptFileStream encrypts the file to the target file without loading it into memory.
+func (o *Encryptor) EncryptFileStream(fileName string, targetFileName string) (err error) {
+	return transformFile(fileName, targetFileName, func(target io.Writer, source io.Reader) (err error) {
+		var writer io.WriteCloser
+		if writer, err = o.NewWriter(target); err != nil {
+			return
+		}
+		if _, err = io.Copy(writer, source); err == nil {
+			err = writer.Close()
+		}
+		return
+	})
+}
+
+// DecryptFileStream decrypts the file of EncryptFileStream to the target file without loading it into memory.
+// The target file is removed, if the stream is corrupted.
+func (o *Encryptor) DecryptFileStream(fileName string, targetFileName string) (err error) {
+	return transformFile(fileName, targetFileName, func(target io.Writer, source io.Reader) (err error) {
+		var reader io.Reader
+		if reader, err = o.NewReader(source); err == nil {
+			_, err = io.Copy(target, reader)
+		}
+		return
+	})
+}
+
+func transformFile(fileName string, targetFileName string, transform func(io.Writer, io.Reader) error) (err error) {
+	var source, target *os.File
+	if source, err = os.Open(fileName); err != nil {
+		return
+	}
+	defer source.Close()
+	if target, err = os.Create(targetFileName); err != nil {
+		return
+	}
+	if err = transform(target, source); err == nil {
+		err = target.Close()
+	} else {
+		target.Close()
+	}
+	if err != nil {
+		os.Remove(targetFileName)
+	}
+	return
+}
+
+type stream struct {
+	aead    cipher.AEAD
+	header  []byte
+	nonce   []byte
+	counter uint32
+}
+
+func newStream(aead cipher.AEAD, header []byte, prefix []byte) *stream {
+	nonce := make([]byte, aead.NonceSize())
+	copy(nonce, prefix)
+	return &stream{aead: aead, header: header, nonce: nonce}
+}
+
+// nextNonce returns the nonce of the next chunk: nonce prefix | counter | last flag.
+func (o *stream) nextNonce(last bool) (ret []byte, err error) {
+	if o.counter == ^uint32(0) {
+		return nil, fmt.Errorf("encrypted stream too long")
+	}
+	binary.BigEndian.PutUint32(o.nonce[noncePrefixSize:], o.counter)
+	o.nonce[len(o.nonce)-1] = 0
+	if last {
+		o.nonce[len(o.nonce)-1] = 1
+	}
+	o.counter++
+	return o.nonce, nil
+}
+
+type streamWriter struct {
+	*stream
+	w      io.Writer
+	buffer []byte
+	closed bool
+}
+
+// Write buffers a chunk and writes it, when more data follows, so that the last chunk is written by Close.
+func (o *streamWriter) Write(data []byte) (n int, err error) {
+	if o.closed {
+		return 0, ErrStreamClosed
+	}
+	for len(data) > 0 {
+		if len(o.buffer) == cap(o.buffer) {
+			if err = o.writeChunk(false); err != nil {
+				return
+			}
+		}
+		copied := copy(o.buffer[len(o.buffer):cap(o.buffer)], data)
+		o.buffer = o.buffer[:len(o.buffer)+copied]
+		data = data[copied:]
+		n += copied
+	}
+	return
+}
+
+func (o *streamWriter) Close() (err error) {
+	if o.closed {
+		return
+	}
+	o.closed = true
+	return o.writeChunk(true)
+}
+
+func (o *streamWriter) writeChunk(last bool) (err error) {
+	var nonce []byte
+	if nonce, err = o.nextNonce(last); err != nil {
+		return
+	}
+	if _, err = o.w.Write(o.aead.Seal(nil, nonce, o.buffer, o.header)); err == nil {
+		o.buffer = o.buffer[:0]
+	}
+	return
+}
+
+type streamReader struct {
+	*stream
+	r     *bufio.Reader
+	chunk []byte
+	plain []byte
+	done  bool
+}
+
+func (o *streamReader) Read(data []byte) (n int, err error) {
+	for len(o.plain) == 0 {
+		if o.done {
+			return 0, io.EOF
+		}
+		if err = o.readChunk(); err != nil {
+			return
+		}
+	}
+	n = copy(data, o.plain)
+	o.plain = o.plain[n:]
+	return
+}
+
+// readChunk decrypts the next chunk, it is the last one, if no data follows it.
+func (o *streamReader) readChunk() (err error) {
+	var n int
+	n, err = io.ReadFull(o.r, o.chunk)
+	if err == io.ErrUnexpectedEOF || err == io.EOF {
+		o.done = true
+	} else if err != nil {
+		return
+	} else if _, peekErr := o.r.Peek(1); peekErr == io.EOF {
+		o.done = true
+	}
+
+	var nonce []byte
+	if nonce, err = o.nextNonce(o.done); err != nil {
+		return
+	}
+	if o.plain, err = o.aead.Open(o.chunk[:0], nonce, o.chunk[:n], o.header); err != nil {
+		err = ErrStreamCorrupted
+	}
+	return
+}
+
+type streamHeader struct {
+	data  []byte
+	kdf   *KDF
+	salt  []byte
+	keyID string
+}
+
+func (o *streamHeader) chunkSize() (ret int, err error) {
+	chunkSize := binary.BigEndian.Uint32(o.data[len(o.data)-noncePrefixSize-4:])
+	if chunkSize == 0 || chunkSize > maxChunkSize {
+		err = fmt.Errorf("%w: chunk size %v", ErrInvalidEnvelope, chunkSize)
+	}
+	return int(chunkSize), err
+}
+
+func (o *streamHeader) noncePrefix() []byte {
+	return o.data[len(o.data)-noncePrefixSize:]
+}
+
+// readStreamHeader reads the header of the stream, up to the nonce prefix.
+func readStreamHeader(r io.Reader) (ret *streamHeader, err error) {
+	ret = &streamHeader{}
+	read := func(length int) (data []byte) {
+		if err != nil {
+			return
+		}
+		data = make([]byte, length)
+		if _, err = io.ReadFull(r, data); err != nil {
+			err = fmt.Errorf("%w: truncated header", ErrInvalidEnvelope)
+		}
+		ret.data = append(ret.data, data...)
+		return
+	}
+
+	if magic := read(len(streamMagic) + 1); err == nil &&
+		(string(magic[:len(streamMagic)]) != string(streamMagic) || magic[len(streamMagic)] != envelopeVersion) {
+		err = fmt.Errorf("%w: no encrypted stream of a supported version", ErrInvalidEnvelope)
+	}
+	if params := read(kdfLength); err == nil {
+		ret.kdf, err = unmarshalKDF(params)
+	}
+	if length := read(1); err == nil {
+		ret.salt = read(int(length[0]))
+	}
+	if length := read(1); err == nil {
+		ret.keyID = string(read(int(length[0])))
+	}
+	read(4 + noncePrefixSize)
+	if err != nil {
+		ret = nil
+	}
+	return
+}
+
+func isStream(data []byte) bool {
+	return len(data) > len(streamMagic) && bytes.HasPrefix(data, streamMagic)
+}
@@ -0,0 +1,97 @@
+package encrypt
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func encryptTestStream(t *testing.T, encryptor *Encryptor, data []byte) []byte {
+	t.Helper()
+	var encrypted bytes.Buffer
+	writer, err := encryptor.NewWriter(&encrypted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// uneven writes over the chunk boundaries
+	for rest := data; len(rest) > 0; {
+		n := len(rest)
+		if n > 1000 {
+			n = 1000
+		}
+		if _, err = writer.Write(rest[:n]); err != nil {
+			t.Fatal(err)
+		}
+		rest = rest[n:]
+	}
+	if err = writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return encrypted.Bytes()
+}
+
+func decryptTestStream(encryptor *Encryptor, encrypted []byte) (ret []byte, err error) {
+	var reader io.Reader
+	if reader, err = encryptor.NewReader(bytes.NewReader(encrypted)); err == nil {
+		ret, err = io.ReadAll(reader)
+	}
+	return
+}
+
+func TestStream(t *testing.T) {
+	encryptor, _ := NewEncryptorKDF("secret", testKDF)
+	for _, size := range []int{0, 1, DefaultChunkSize, 3*DefaultChunkSize + 17} {
+		data := make([]byte, size)
+		_, _ = rand.Read(data)
+		encrypted := encryptTestStream(t, encryptor, data)
+
+		other, _ := NewEncryptorKDF("secret", testKDF)
+		if decrypted, err := decryptTestStream(other, encrypted); err != nil || !bytes.Equal(decrypted, data) {
+			t.Fatalf("%v: expected the data, got %v bytes, %v", size, len(decrypted), err)
+		}
+	}
+}
+
+func TestStreamCorrupted(t *testing.T) {
+	encryptor, _ := NewEncryptorKDF("secret", testKDF)
+	data := make([]byte, 2*DefaultChunkSize+100)
+	encrypted := encryptTestStream(t, encryptor, data)
+	headerSize := len(encrypted) - (len(data) + 3*encryptor.Overhead())
+	chunkSize := DefaultChunkSize + encryptor.Overhead()
+
+	truncated := encrypted[:headerSize+2*chunkSize]
+	reordered := append(append(append([]byte{}, encrypted[:headerSize]...),
+		encrypted[headerSize+chunkSize:headerSize+2*chunkSize]...), encrypted[headerSize:headerSize+chunkSize]...)
+	reordered = append(reordered, encrypted[headerSize+2*chunkSize:]...)
+	changed := append([]byte{}, encrypted...)
+	changed[len(changed)-1] ^= 1
+
+	for name, corrupted := range map[string][]byte{"truncated": truncated, "reordered": reordered, "changed": changed} {
+		if _, err := decryptTestStream(encryptor, corrupted); !errors.Is(err, ErrStreamCorrupted) {
+			t.Fatalf("%v: expected corrupted stream, got %v", name, err)
+		}
+	}
+}
+
+func TestFileStream(t *testing.T) {
+	folder := t.TempDir()
+	encryptor, _ := NewEncryptorKDF("secret", testKDF)
+	plain, encrypted, decrypted :=
+		filepath.Join(folder, "plain"), filepath.Join(folder, "encrypted"), filepath.Join(folder, "decrypted")
+	if err := os.WriteFile(plain, []byte("content"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := encryptor.EncryptFileStream(plain, encrypted); err != nil {
+		t.Fatal(err)
+	}
+	if err := encryptor.DecryptFileStream(encrypted, decrypted); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := os.ReadFile(decrypted); err != nil || string(data) != "content" {
+		t.Fatalf("expected content, got %s, %v", data, err)
+	}
+}
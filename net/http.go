@@ -19,6 +19,12 @@ const QueryTypeCount = "count"
 const QueryTypeExist = "exist"
 const QueryTypeFind = "find"
 
+const QueryFilter = "filter"
+const QuerySort = "sort"
+const QueryLimit = "limit"
+const QueryOffset = "offset"
+const QueryCursor = "cursor"
+
 const Command = "command"
 
 func ResponseJson(response interface{}, w http.ResponseWriter) error {
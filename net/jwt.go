@@ -1,6 +1,7 @@
 package net
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"strings"
@@ -8,8 +9,13 @@ import (
 
 	"github.com/dgrijalva/jwt-go"
 	"github.com/dgrijalva/jwt-go/request"
+	"github.com/go-ee/utils/crypt"
+	"github.com/go-ee/utils/lg"
 )
 
+// ErrWrongCredentials is returned by the password authenticator for unknown users and wrong passwords.
+var ErrWrongCredentials = errors.New("wrong credentials")
+
 type UserCredentials struct {
 	Username string
 	Password string
@@ -56,6 +62,52 @@ func NewJwtControllerApp(certsFolder string, appName string,
 	return
 }
 
+// NewPasswordAuthenticator creates an authenticator for the JwtController, which verifies the password by the hash
+// of the account. When the hasher reports, that the hash should be rehashed, the new hash is saved. A failed save
+// doesn't fail the login, the hash is upgraded at the next login then. Unknown users, wrong passwords and the errors
+// of finding the account or of verifying its hash, e.g. crypt.ErrUnknownAlgorithm, are ErrWrongCredentials.
+// For unknown users a dummy hash of the hasher is verified, so that the time of the login doesn't reveal
+// the existence of accounts.
+func NewPasswordAuthenticator(hasher crypt.Hasher,
+	findAccount func(username string) (account interface{}, hash string, err error),
+	saveHash func(account interface{}, hash string) error) func(UserCredentials) (ret interface{}, err error) {
+
+	dummyHash, err := hasher.Hash("dummy password of unknown users")
+	if err != nil {
+		lg.LOG.Warnf("could not hash the dummy password: %v", err)
+	}
+
+	return func(credentials UserCredentials) (ret interface{}, err error) {
+		// the errors are not returned, so that they don't reveal the existence of accounts or their hashes
+		var hash string
+		if ret, hash, err = findAccount(credentials.Username); err != nil || ret == nil {
+			if err != nil {
+				lg.LOG.Warnf("could not find the account of %v: %v", credentials.Username, err)
+			}
+			_, _, _ = hasher.Verify(credentials.Password, dummyHash)
+			return nil, ErrWrongCredentials
+		}
+
+		var ok, rehash bool
+		if ok, rehash, err = hasher.Verify(credentials.Password, hash); err != nil || !ok {
+			if err != nil {
+				lg.LOG.Warnf("could not verify the password of %v: %v", credentials.Username, err)
+			}
+			return nil, ErrWrongCredentials
+		}
+		if rehash {
+			if hash, err = hasher.Hash(credentials.Password); err == nil {
+				err = saveHash(ret, hash)
+			}
+			if err != nil {
+				lg.LOG.Warnf("could not rehash the password of %v: %v", credentials.Username, err)
+				err = nil
+			}
+		}
+		return
+	}
+}
+
 func (o *JwtController) Setup() (err error) {
 	err = o.rsaKeys.LoadOrCreate()
 	return
@@ -0,0 +1,109 @@
+package net
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/go-ee/utils/crypt"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type testAccount struct {
+	Name string
+	Hash string
+}
+
+func newTestAuthenticator(hasher crypt.Hasher, accounts map[string]*testAccount,
+	findErr error) func(UserCredentials) (interface{}, error) {
+
+	return NewPasswordAuthenticator(hasher,
+		func(username string) (account interface{}, hash string, err error) {
+			if findErr != nil {
+				return nil, "", findErr
+			}
+			if item, ok := accounts[username]; ok {
+				return item, item.Hash, nil
+			}
+			return
+		},
+		func(account interface{}, hash string) error {
+			account.(*testAccount).Hash = hash
+			return nil
+		})
+}
+
+func TestPasswordAuthenticatorRehash(t *testing.T) {
+	legacyHasher := crypt.NewBcryptHasher(bcrypt.MinCost)
+	legacy, _ := legacyHasher.Hash("secret")
+	anna := &testAccount{Name: "anna", Hash: legacy}
+	policy := crypt.NewPolicy(&crypt.ScryptHasher{LogN: 4, R: 8, P: 1, KeyLength: 32, SaltLength: 16}, legacyHasher)
+	authenticate := newTestAuthenticator(policy, map[string]*testAccount{"anna": anna}, nil)
+
+	if account, err := authenticate(UserCredentials{Username: "anna", Password: "secret"}); err != nil || account != anna {
+		t.Fatalf("expected anna, got %v, %v", account, err)
+	}
+	if !strings.HasPrefix(anna.Hash, "$scrypt$") {
+		t.Fatalf("expected the hash upgraded, got %v", anna.Hash)
+	}
+	if ok, rehash, err := policy.Verify("secret", anna.Hash); !ok || rehash || err != nil {
+		t.Fatalf("expected the current hash, got %v, %v, %v", ok, rehash, err)
+	}
+	if _, err := authenticate(UserCredentials{Username: "anna", Password: "secret"}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPasswordAuthenticatorWrongCredentials(t *testing.T) {
+	hasher := crypt.NewBcryptHasher(bcrypt.MinCost)
+	hash, _ := hasher.Hash("secret")
+	argon2Hash, _ := (&crypt.Argon2idHasher{Time: 1, Memory: 64, Threads: 1, KeyLength: 32, SaltLength: 16}).
+		Hash("secret")
+	accounts := map[string]*testAccount{
+		"anna":  {Name: "anna", Hash: hash},
+		"bernd": {Name: "bernd", Hash: argon2Hash},
+	}
+	policy := crypt.NewPolicy(hasher)
+
+	for _, item := range []struct {
+		name         string
+		credentials  UserCredentials
+		authenticate func(UserCredentials) (interface{}, error)
+	}{
+		{"wrong password", UserCredentials{Username: "anna", Password: "other"},
+			newTestAuthenticator(policy, accounts, nil)},
+		{"unknown user", UserCredentials{Username: "carl", Password: "secret"},
+			newTestAuthenticator(policy, accounts, nil)},
+		{"unknown algorithm", UserCredentials{Username: "bernd", Password: "secret"},
+			newTestAuthenticator(policy, accounts, nil)},
+		{"find error", UserCredentials{Username: "anna", Password: "secret"},
+			newTestAuthenticator(policy, accounts, errors.New("database down"))},
+	} {
+		if account, err := item.authenticate(item.credentials); account != nil || err != ErrWrongCredentials {
+			t.Fatalf("%v: expected wrong credentials, got %v, %v", item.name, account, err)
+		}
+	}
+}
+
+// verifyCounter counts the verified hashes of the hasher.
+type verifyCounter struct {
+	crypt.Hasher
+	hashes []string
+}
+
+func (o *verifyCounter) Verify(password string, hash string) (ok bool, rehash bool, err error) {
+	o.hashes = append(o.hashes, hash)
+	return o.Hasher.Verify(password, hash)
+}
+
+func TestPasswordAuthenticatorUnknownUserVerifiesDummyHash(t *testing.T) {
+	hasher := &verifyCounter{Hasher: crypt.NewBcryptHasher(bcrypt.MinCost)}
+	authenticate := newTestAuthenticator(hasher, map[string]*testAccount{}, nil)
+
+	if _, err := authenticate(UserCredentials{Username: "carl", Password: "secret"}); err != ErrWrongCredentials {
+		t.Fatalf("expected wrong credentials, got %v", err)
+	}
+	if len(hasher.hashes) != 1 || !strings.HasPrefix(hasher.hashes[0], "$2") {
+		t.Fatalf("expected a verified bcrypt hash for the unknown user, got %v", hasher.hashes)
+	}
+}
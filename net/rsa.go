@@ -5,12 +5,20 @@ import (
 	"crypto/rsa"
 	"crypto/x509"
 	"encoding/pem"
+	"errors"
 	"fmt"
 	"github.com/dgrijalva/jwt-go"
+	"github.com/go-ee/utils/encrypt"
 	"io/ioutil"
 	"os"
 )
 
+// ErrNoPrivateKey is returned for the operations of the private key, if it is not loaded.
+var ErrNoPrivateKey = errors.New("no private key loaded")
+
+// ErrNoPublicKey is returned for the operations of the public key, if it is not loaded.
+var ErrNoPublicKey = errors.New("no public key loaded")
+
 type RsaKeys struct {
 	rsaFileName    string
 	rsaPubFileName string
@@ -31,6 +39,38 @@ func (o *RsaKeys) Public() *rsa.PublicKey {
 	return o.public
 }
 
+// Recipient returns the recipient of the public key, to encrypt data for the owner of the keys by encrypt.EncryptFor.
+func (o *RsaKeys) Recipient() (ret *encrypt.RSARecipient, err error) {
+	if o.public == nil {
+		return nil, ErrNoPublicKey
+	}
+	return &encrypt.RSARecipient{PublicKey: o.public}, nil
+}
+
+// Identity returns the identity of the private key, to decrypt data by encrypt.DecryptBy.
+func (o *RsaKeys) Identity() (ret *encrypt.RSAIdentity, err error) {
+	if o.private == nil {
+		return nil, ErrNoPrivateKey
+	}
+	return &encrypt.RSAIdentity{PrivateKey: o.private}, nil
+}
+
+// Signer returns the RSA-PSS signer of the private key.
+func (o *RsaKeys) Signer() (ret *encrypt.RSASigner, err error) {
+	if o.private == nil {
+		return nil, ErrNoPrivateKey
+	}
+	return &encrypt.RSASigner{PrivateKey: o.private}, nil
+}
+
+// Verifier returns the RSA-PSS verifier of the public key.
+func (o *RsaKeys) Verifier() (ret *encrypt.RSAVerifier, err error) {
+	if o.public == nil {
+		return nil, ErrNoPublicKey
+	}
+	return &encrypt.RSAVerifier{PublicKey: o.public}, nil
+}
+
 func (o *RsaKeys) RsaFile() string {
 	return o.rsaFile
 }
@@ -0,0 +1,22 @@
+package net
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestRsaKeysWithoutKeys(t *testing.T) {
+	keys := RsaKeysNew(t.TempDir(), "app")
+	if _, err := keys.Identity(); !errors.Is(err, ErrNoPrivateKey) {
+		t.Fatalf("expected no private key, got %v", err)
+	}
+	if _, err := keys.Signer(); !errors.Is(err, ErrNoPrivateKey) {
+		t.Fatalf("expected no private key, got %v", err)
+	}
+	if _, err := keys.Recipient(); !errors.Is(err, ErrNoPublicKey) {
+		t.Fatalf("expected no public key, got %v", err)
+	}
+	if _, err := keys.Verifier(); !errors.Is(err, ErrNoPublicKey) {
+		t.Fatalf("expected no public key, got %v", err)
+	}
+}